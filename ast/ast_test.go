@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/kurarrr/monkey/token"
@@ -21,3 +22,205 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+		if integer.Value != 1 {
+			return node
+		}
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+			},
+		},
+		{
+			&WhileExpression{
+				Condition: one(),
+				Body: &BlockStatement{Statements: []Statement{
+					&AssignStatement{Value: one()},
+				}},
+			},
+			&WhileExpression{
+				Condition: two(),
+				Body: &BlockStatement{Statements: []Statement{
+					&AssignStatement{Value: two()},
+				}},
+			},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&LetStatement{Value: one()}, &LetStatement{Value: two()}},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+			},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+
+	hashLiteral := &HashLiteral{
+		Pairs: []HashPair{
+			{Key: one(), Value: one()},
+			{Key: one(), Value: one()},
+		},
+	}
+
+	Modify(hashLiteral, turnOneIntoTwo)
+
+	for _, pair := range hashLiteral.Pairs {
+		key, _ := pair.Key.(*IntegerLiteral)
+		if key.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, key.Value)
+		}
+		val, _ := pair.Value.(*IntegerLiteral)
+		if val.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, val.Value)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	original := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition: &InfixExpression{Left: &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}, Operator: "<", Right: &Identifier{Value: "x"}},
+			Consequence: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &CallExpression{
+					Function:  &Identifier{Value: "f"},
+					Arguments: []Expression{&IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}},
+				}},
+			}},
+		}},
+	}}
+	before := original.String()
+
+	copied := Copy(original)
+	if !reflect.DeepEqual(copied, original) {
+		t.Fatalf("copy differs from original. got=%#v", copied)
+	}
+
+	Modify(copied, func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2}
+		}
+		return node
+	})
+	if original.String() != before {
+		t.Errorf("original changed. want=%q, got=%q", before, original.String())
+	}
+	if copied.String() != "if(2 < x) f(2)" {
+		t.Errorf("copy not modified. got=%q", copied.String())
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	program := &Program{Statements: []Statement{
+		&LetStatement{Name: ident("f"), Value: &FunctionLiteral{
+			Parameters: []*Identifier{ident("a")},
+			Body: &BlockStatement{Statements: []Statement{
+				&AssignStatement{Name: ident("n"), Value: &InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")}},
+			}},
+		}},
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition:   &CallExpression{Function: ident("g"), Arguments: []Expression{ident("c")}},
+			Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("d")}}},
+		}},
+	}}
+
+	var all, outer []string
+	Inspect(program, func(node Node) bool {
+		if i, ok := node.(*Identifier); ok {
+			all = append(all, i.Value)
+		}
+		return true
+	})
+	// false を返したノードの子は辿らない
+	Inspect(program, func(node Node) bool {
+		if i, ok := node.(*Identifier); ok {
+			outer = append(outer, i.Value)
+		}
+		_, isFunction := node.(*FunctionLiteral)
+		return !isFunction
+	})
+
+	if !reflect.DeepEqual(all, []string{"f", "a", "n", "a", "b", "g", "c", "d"}) {
+		t.Errorf("wrong identifiers. got=%q", all)
+	}
+	if !reflect.DeepEqual(outer, []string{"f", "g", "c", "d"}) {
+		t.Errorf("wrong identifiers outside functions. got=%q", outer)
+	}
+}
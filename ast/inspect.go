@@ -0,0 +1,103 @@
+package ast
+
+// Inspect は node から深さ優先で木を辿り、各ノードを f に渡す。子より先に親を渡し、
+// f が false を返せばそのノードの子は辿らない。Modify と違って木を書き換えない
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+
+	case *ExpressionStatement:
+		inspectExpression(node.Expression, f)
+
+	case *InfixExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Right, f)
+
+	case *PrefixExpression:
+		inspectExpression(node.Right, f)
+
+	case *IndexExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Index, f)
+
+	case *IfExpression:
+		inspectExpression(node.Condition, f)
+		inspectBlock(node.Consequence, f)
+		inspectBlock(node.Alternative, f)
+
+	case *WhileExpression:
+		inspectExpression(node.Condition, f)
+		inspectBlock(node.Body, f)
+
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+
+	case *ReturnStatement:
+		inspectExpression(node.ReturnValue, f)
+
+	case *LetStatement:
+		inspectIdentifier(node.Name, f)
+		inspectExpression(node.Value, f)
+
+	case *AssignStatement:
+		inspectIdentifier(node.Name, f)
+		inspectExpression(node.Value, f)
+
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			inspectIdentifier(p, f)
+		}
+		inspectBlock(node.Body, f)
+
+	case *MacroLiteral:
+		for _, p := range node.Parameters {
+			inspectIdentifier(p, f)
+		}
+		inspectBlock(node.Body, f)
+
+	case *CallExpression:
+		inspectExpression(node.Function, f)
+		for _, a := range node.Arguments {
+			inspectExpression(a, f)
+		}
+
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			inspectExpression(e, f)
+		}
+
+	case *HashLiteral:
+		for _, pair := range node.Pairs {
+			inspectExpression(pair.Key, f)
+			inspectExpression(pair.Value, f)
+		}
+	}
+}
+
+// inspectExpression, inspectBlock, inspectIdentifier は構文エラーで欠けたノード (nil) を飛ばす
+func inspectExpression(exp Expression, f func(Node) bool) {
+	if exp != nil {
+		Inspect(exp, f)
+	}
+}
+
+func inspectBlock(block *BlockStatement, f func(Node) bool) {
+	if block != nil {
+		Inspect(block, f)
+	}
+}
+
+func inspectIdentifier(ident *Identifier, f func(Node) bool) {
+	if ident != nil {
+		Inspect(ident, f)
+	}
+}
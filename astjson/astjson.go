@@ -0,0 +1,432 @@
+// Package astjson は AST を JSON に書き出し、JSON から AST を組み立て直す。
+//
+// ノードは "type" にノード名、"token" に元のトークンの種類・字面・位置を持つオブジェクトになる。
+// 例えば 1 + x は次のようになる(token は一部省略)。
+//
+//	{"type": "InfixExpression", "token": {"type": "+", "literal": "+", "line": 1, "column": 3},
+//	 "operator": "+",
+//	 "left": {"type": "IntegerLiteral", "token": {...}, "value": 1},
+//	 "right": {"type": "Identifier", "token": {...}, "value": "x"}}
+//
+// 子ノードのフィールド名は evaluator の parse 組み込み関数が返すハッシュと同じ。
+// ただし let・代入の name と関数の parameters は位置を残すため Identifier ノードにしている。
+package astjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/token"
+)
+
+// Marshal は node を JSON にする
+func Marshal(node ast.Node) ([]byte, error) {
+	return json.Marshal(encode(node))
+}
+
+// MarshalIndent は Marshal と同じだが、json.MarshalIndent と同じように字下げする
+func MarshalIndent(node ast.Node, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(encode(node), prefix, indent)
+}
+
+// Unmarshal は Marshal が書き出した JSON から AST を組み立てる
+func Unmarshal(data []byte) (ast.Node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// 整数を float64 に丸めないよう数値は json.Number のまま受け取る
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	d := &decoder{}
+	node := d.node(v)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+type jsonNode = map[string]interface{}
+
+func encode(node ast.Node) interface{} {
+	switch node := node.(type) {
+	case *ast.Program:
+		return jsonNode{"type": "Program", "statements": encodeStatements(node.Statements)}
+	case *ast.LetStatement:
+		return newNode("LetStatement", node.Token,
+			"name", encode(node.Name),
+			"value", encode(node.Value))
+	case *ast.AssignStatement:
+		return newNode("AssignStatement", node.Token,
+			"name", encode(node.Name),
+			"value", encode(node.Value))
+	case *ast.ReturnStatement:
+		return newNode("ReturnStatement", node.Token, "value", encode(node.ReturnValue))
+	case *ast.ExpressionStatement:
+		return newNode("ExpressionStatement", node.Token, "expression", encode(node.Expression))
+	case *ast.BlockStatement:
+		return newNode("BlockStatement", node.Token, "statements", encodeStatements(node.Statements))
+	case *ast.Identifier:
+		return newNode("Identifier", node.Token, "value", node.Value)
+	case *ast.IntegerLiteral:
+		return newNode("IntegerLiteral", node.Token, "value", node.Value)
+	case *ast.FloatLiteral:
+		return newNode("FloatLiteral", node.Token, "value", node.Value)
+	case *ast.StringLiteral:
+		return newNode("StringLiteral", node.Token, "value", node.Value)
+	case *ast.Boolean:
+		return newNode("Boolean", node.Token, "value", node.Value)
+	case *ast.PrefixExpression:
+		return newNode("PrefixExpression", node.Token,
+			"operator", node.Operator,
+			"right", encode(node.Right))
+	case *ast.InfixExpression:
+		return newNode("InfixExpression", node.Token,
+			"operator", node.Operator,
+			"left", encode(node.Left),
+			"right", encode(node.Right))
+	case *ast.IfExpression:
+		var alternative interface{}
+		if node.Alternative != nil {
+			alternative = encode(node.Alternative)
+		}
+		return newNode("IfExpression", node.Token,
+			"condition", encode(node.Condition),
+			"consequence", encode(node.Consequence),
+			"alternative", alternative)
+	case *ast.WhileExpression:
+		return newNode("WhileExpression", node.Token,
+			"condition", encode(node.Condition),
+			"body", encode(node.Body))
+	case *ast.FunctionLiteral:
+		params := make([]interface{}, len(node.Parameters))
+		for i, p := range node.Parameters {
+			params[i] = encode(p)
+		}
+		return newNode("FunctionLiteral", node.Token,
+			"parameters", params,
+			"body", encode(node.Body),
+			"name", node.Name)
+	case *ast.MacroLiteral:
+		params := make([]interface{}, len(node.Parameters))
+		for i, p := range node.Parameters {
+			params[i] = encode(p)
+		}
+		return newNode("MacroLiteral", node.Token,
+			"parameters", params,
+			"body", encode(node.Body))
+	case *ast.CallExpression:
+		return newNode("CallExpression", node.Token,
+			"function", encode(node.Function),
+			"arguments", encodeExpressions(node.Arguments))
+	case *ast.ArrayLiteral:
+		return newNode("ArrayLiteral", node.Token, "elements", encodeExpressions(node.Elements))
+	case *ast.IndexExpression:
+		return newNode("IndexExpression", node.Token,
+			"left", encode(node.Left),
+			"index", encode(node.Index))
+	case *ast.HashLiteral:
+		return newNode("HashLiteral", node.Token, "pairs", encodePairs(node))
+	default:
+		return nil
+	}
+}
+
+func newNode(nodeType string, tok token.Token, fields ...interface{}) jsonNode {
+	n := jsonNode{
+		"type": nodeType,
+		"token": jsonNode{
+			"type":    string(tok.Type),
+			"literal": tok.Literal,
+			"line":    tok.Line,
+			"column":  tok.Column,
+		},
+	}
+	for i := 0; i < len(fields); i += 2 {
+		n[fields[i].(string)] = fields[i+1]
+	}
+	return n
+}
+
+func encodeStatements(stmts []ast.Statement) []interface{} {
+	out := make([]interface{}, len(stmts))
+	for i, s := range stmts {
+		out[i] = encode(s)
+	}
+	return out
+}
+
+func encodeExpressions(exps []ast.Expression) []interface{} {
+	out := make([]interface{}, len(exps))
+	for i, e := range exps {
+		out[i] = encode(e)
+	}
+	return out
+}
+
+// encodePairs はハッシュリテラルのペアをソースの順に [key, value] の配列にする
+func encodePairs(hl *ast.HashLiteral) []interface{} {
+	pairs := make([]interface{}, len(hl.Pairs))
+	for i, pair := range hl.Pairs {
+		pairs[i] = []interface{}{encode(pair.Key), encode(pair.Value)}
+	}
+	return pairs
+}
+
+// decoder は encode の逆変換を行う。最初に見つけた不正な箇所を err に残す
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("astjson: "+format, a...)
+	}
+}
+
+func (d *decoder) field(n jsonNode, nodeType, name string) interface{} {
+	v, ok := n[name]
+	if !ok {
+		d.fail("missing field %q in %s", name, nodeType)
+	}
+	return v
+}
+
+func (d *decoder) stringField(n jsonNode, nodeType, name string) string {
+	s, ok := d.field(n, nodeType, name).(string)
+	if !ok {
+		d.fail("field %q in %s must be a string", name, nodeType)
+	}
+	return s
+}
+
+func (d *decoder) numberField(n jsonNode, nodeType, name string) json.Number {
+	num, ok := d.field(n, nodeType, name).(json.Number)
+	if !ok {
+		d.fail("field %q in %s must be a number", name, nodeType)
+	}
+	return num
+}
+
+func (d *decoder) arrayField(n jsonNode, nodeType, name string) []interface{} {
+	v := d.field(n, nodeType, name)
+	if v == nil {
+		return nil
+	}
+	arr, ok := v.([]interface{})
+	if !ok {
+		d.fail("field %q in %s must be an array", name, nodeType)
+	}
+	return arr
+}
+
+func (d *decoder) token(n jsonNode, nodeType string) token.Token {
+	t, ok := d.field(n, nodeType, "token").(jsonNode)
+	if !ok {
+		d.fail("field %q in %s must be an object", "token", nodeType)
+		return token.Token{}
+	}
+	line, _ := d.numberField(t, "token", "line").Int64()
+	column, _ := d.numberField(t, "token", "column").Int64()
+	return token.Token{
+		Type:    token.TokenType(d.stringField(t, "token", "type")),
+		Literal: d.stringField(t, "token", "literal"),
+		Line:    int(line),
+		Column:  int(column),
+	}
+}
+
+func (d *decoder) node(v interface{}) ast.Node {
+	if v == nil {
+		return nil
+	}
+	n, ok := v.(jsonNode)
+	if !ok {
+		d.fail("AST node must be an object, got %T", v)
+		return nil
+	}
+	nodeType, ok := n["type"].(string)
+	if !ok {
+		d.fail("missing node type")
+		return nil
+	}
+	if nodeType == "Program" {
+		return &ast.Program{Statements: d.statements(d.arrayField(n, nodeType, "statements"))}
+	}
+
+	tok := d.token(n, nodeType)
+	switch nodeType {
+	case "LetStatement":
+		return &ast.LetStatement{
+			Token: tok,
+			Name:  d.identifier(d.field(n, nodeType, "name")),
+			Value: d.expression(d.field(n, nodeType, "value")),
+		}
+	case "AssignStatement":
+		return &ast.AssignStatement{
+			Token: tok,
+			Name:  d.identifier(d.field(n, nodeType, "name")),
+			Value: d.expression(d.field(n, nodeType, "value")),
+		}
+	case "ReturnStatement":
+		return &ast.ReturnStatement{Token: tok, ReturnValue: d.expression(d.field(n, nodeType, "value"))}
+	case "ExpressionStatement":
+		return &ast.ExpressionStatement{Token: tok, Expression: d.expression(d.field(n, nodeType, "expression"))}
+	case "BlockStatement":
+		return &ast.BlockStatement{Token: tok, Statements: d.statements(d.arrayField(n, nodeType, "statements"))}
+	case "Identifier":
+		return &ast.Identifier{Token: tok, Value: d.stringField(n, nodeType, "value")}
+	case "IntegerLiteral":
+		value, err := d.numberField(n, nodeType, "value").Int64()
+		if err != nil {
+			d.fail("field %q in %s must be an integer", "value", nodeType)
+		}
+		return &ast.IntegerLiteral{Token: tok, Value: value}
+	case "FloatLiteral":
+		value, err := d.numberField(n, nodeType, "value").Float64()
+		if err != nil {
+			d.fail("field %q in %s must be a number", "value", nodeType)
+		}
+		return &ast.FloatLiteral{Token: tok, Value: value}
+	case "StringLiteral":
+		return &ast.StringLiteral{Token: tok, Value: d.stringField(n, nodeType, "value")}
+	case "Boolean":
+		value, ok := d.field(n, nodeType, "value").(bool)
+		if !ok {
+			d.fail("field %q in %s must be a boolean", "value", nodeType)
+		}
+		return &ast.Boolean{Token: tok, Value: value}
+	case "PrefixExpression":
+		return &ast.PrefixExpression{
+			Token:    tok,
+			Operator: d.stringField(n, nodeType, "operator"),
+			Right:    d.expression(d.field(n, nodeType, "right")),
+		}
+	case "InfixExpression":
+		return &ast.InfixExpression{
+			Token:    tok,
+			Operator: d.stringField(n, nodeType, "operator"),
+			Left:     d.expression(d.field(n, nodeType, "left")),
+			Right:    d.expression(d.field(n, nodeType, "right")),
+		}
+	case "IfExpression":
+		ie := &ast.IfExpression{
+			Token:       tok,
+			Condition:   d.expression(d.field(n, nodeType, "condition")),
+			Consequence: d.block(d.field(n, nodeType, "consequence")),
+		}
+		if alt := n["alternative"]; alt != nil {
+			ie.Alternative = d.block(alt)
+		}
+		return ie
+	case "WhileExpression":
+		return &ast.WhileExpression{
+			Token:     tok,
+			Condition: d.expression(d.field(n, nodeType, "condition")),
+			Body:      d.block(d.field(n, nodeType, "body")),
+		}
+	case "FunctionLiteral":
+		fl := &ast.FunctionLiteral{
+			Token: tok,
+			Body:  d.block(d.field(n, nodeType, "body")),
+			Name:  d.stringField(n, nodeType, "name"),
+		}
+		for _, p := range d.arrayField(n, nodeType, "parameters") {
+			fl.Parameters = append(fl.Parameters, d.identifier(p))
+		}
+		return fl
+	case "MacroLiteral":
+		ml := &ast.MacroLiteral{Token: tok, Body: d.block(d.field(n, nodeType, "body"))}
+		for _, p := range d.arrayField(n, nodeType, "parameters") {
+			ml.Parameters = append(ml.Parameters, d.identifier(p))
+		}
+		return ml
+	case "CallExpression":
+		return &ast.CallExpression{
+			Token:     tok,
+			Function:  d.expression(d.field(n, nodeType, "function")),
+			Arguments: d.expressions(d.arrayField(n, nodeType, "arguments")),
+		}
+	case "ArrayLiteral":
+		return &ast.ArrayLiteral{Token: tok, Elements: d.expressions(d.arrayField(n, nodeType, "elements"))}
+	case "IndexExpression":
+		return &ast.IndexExpression{
+			Token: tok,
+			Left:  d.expression(d.field(n, nodeType, "left")),
+			Index: d.expression(d.field(n, nodeType, "index")),
+		}
+	case "HashLiteral":
+		hl := &ast.HashLiteral{Token: tok}
+		for _, p := range d.arrayField(n, nodeType, "pairs") {
+			pair, ok := p.([]interface{})
+			if !ok || len(pair) != 2 {
+				d.fail("pairs in %s must be [key, value] arrays", nodeType)
+				return nil
+			}
+			hl.Pairs = append(hl.Pairs, ast.HashPair{Key: d.expression(pair[0]), Value: d.expression(pair[1])})
+		}
+		return hl
+	default:
+		d.fail("unknown AST node type: %s", nodeType)
+		return nil
+	}
+}
+
+func (d *decoder) expression(v interface{}) ast.Expression {
+	node := d.node(v)
+	if node == nil {
+		return nil
+	}
+	exp, ok := node.(ast.Expression)
+	if !ok {
+		d.fail("expected an expression node, got %T", node)
+		return nil
+	}
+	return exp
+}
+
+func (d *decoder) expressions(vs []interface{}) []ast.Expression {
+	exps := []ast.Expression{}
+	for _, v := range vs {
+		exps = append(exps, d.expression(v))
+	}
+	return exps
+}
+
+func (d *decoder) statements(vs []interface{}) []ast.Statement {
+	stmts := []ast.Statement{}
+	for _, v := range vs {
+		node := d.node(v)
+		stmt, ok := node.(ast.Statement)
+		if !ok {
+			d.fail("expected a statement node, got %T", node)
+			return stmts
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+func (d *decoder) identifier(v interface{}) *ast.Identifier {
+	node := d.node(v)
+	ident, ok := node.(*ast.Identifier)
+	if !ok {
+		d.fail("expected an Identifier node, got %T", node)
+		return nil
+	}
+	return ident
+}
+
+func (d *decoder) block(v interface{}) *ast.BlockStatement {
+	node := d.node(v)
+	block, ok := node.(*ast.BlockStatement)
+	if !ok {
+		d.fail("expected a BlockStatement node, got %T", node)
+		return nil
+	}
+	return block
+}
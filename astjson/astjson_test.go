@@ -0,0 +1,103 @@
+package astjson
+
+import (
+	"testing"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/parser"
+	"github.com/kurarrr/monkey/printer"
+)
+
+func TestMarshal(t *testing.T) {
+	input := "-x"
+
+	expected := `{"statements":[{"expression":{"operator":"-",` +
+		`"right":{"token":{"column":2,"line":1,"literal":"x","type":"IDENT"},"type":"Identifier","value":"x"},` +
+		`"token":{"column":1,"line":1,"literal":"-","type":"-"},"type":"PrefixExpression"},` +
+		`"token":{"column":1,"line":1,"literal":"-","type":"-"},"type":"ExpressionStatement"}],"type":"Program"}`
+
+	out, err := Marshal(parse(t, input))
+	if err != nil {
+		t.Fatalf("Marshal error: %s", err)
+	}
+	if string(out) != expected {
+		t.Errorf("wrong JSON.\nwant=%s\ngot =%s", expected, out)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		"let x = 5; x = x + 1; return x;",
+		"let add = fn(a, b) { a + b }; add(1, 2 * 3);",
+		"if (x > 1) { true } else { !false }",
+		"if (x) { 1 }",
+		"let i = 0; while (i < 3) { i = i + 1; }",
+		`[1, 2.5, "three"][0]`,
+		`{"b": 1, "a": 2, 3: 4 + 5}`,
+		"9223372036854775807",
+		"let unless = macro(cond, body) { quote(if (!(unquote(cond))) { unquote(body) }) };",
+	}
+
+	for _, input := range tests {
+		program := parse(t, input)
+
+		out, err := Marshal(program)
+		if err != nil {
+			t.Fatalf("%q: Marshal error: %s", input, err)
+		}
+		node, err := Unmarshal(out)
+		if err != nil {
+			t.Fatalf("%q: Unmarshal error: %s", input, err)
+		}
+		// ハッシュリテラルの String() はペアの順序が決まらないので、ソース順に並べる printer で比べる
+		if printer.Format(node) != printer.Format(program) {
+			t.Errorf("%q: wrong AST. want=%q, got=%q", input, printer.Format(program), printer.Format(node))
+		}
+
+		again, err := Marshal(node)
+		if err != nil {
+			t.Fatalf("%q: Marshal error: %s", input, err)
+		}
+		if string(again) != string(out) {
+			t.Errorf("%q: JSON changed after round trip.\nwant=%s\ngot =%s", input, out, again)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"type": "Loop"}`, `astjson: missing field "token" in Loop`},
+		{`{"type": "Program", "statements": [{"type": "Identifier", "token": {"type": "IDENT", "literal": "x", "line": 1, "column": 1}, "value": "x"}]}`,
+			"astjson: expected a statement node, got *ast.Identifier"},
+		{`{"type": "Program", "statements": [1]}`, "astjson: AST node must be an object, got json.Number"},
+		{`{"type": "IntegerLiteral", "token": {"type": "INT", "literal": "1", "line": 1, "column": 1}, "value": "1"}`,
+			`astjson: field "value" in IntegerLiteral must be a number`},
+		{`[`, "unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		_, err := Unmarshal([]byte(tt.input))
+		if err == nil {
+			t.Errorf("%s: expected error, got nil", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: parser errors: %v", input, p.Errors())
+	}
+	return program
+}
@@ -0,0 +1,124 @@
+package code
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// レジスタ VM (--engine=rvm) の命令。スタック VM の命令とは別の実験的な命令セット。
+// 値は関数呼び出しごとのレジスタ R[0], R[1], ... に置く。引数は R[0] から順に入り、
+// その後ろに局所変数、さらに後ろに式の途中の値を置く一時レジスタが続く。
+// 命令は固定長の構造体なので、バイト列を読み解く手間がない。
+
+type RegisterOpcode byte
+
+const (
+	RLoadConstant RegisterOpcode = iota // R[A] = K[B]
+	RLoadTrue                           // R[A] = true
+	RLoadFalse                          // R[A] = false
+	RLoadNull                           // R[A] = null
+	RMove                               // R[A] = R[B]
+
+	RGetGlobal      // R[A] = G[B]
+	RSetGlobal      // G[A] = R[B]
+	RGetBuiltin     // R[A] = 組み込み関数 B
+	RGetFree        // R[A] = 自由変数 B
+	RCurrentClosure // R[A] = 実行中のクロージャ
+
+	RAdd         // R[A] = R[B] + R[C]
+	RSub         // R[A] = R[B] - R[C]
+	RMul         // R[A] = R[B] * R[C]
+	RDiv         // R[A] = R[B] / R[C]
+	REqual       // R[A] = R[B] == R[C]
+	RNotEqual    // R[A] = R[B] != R[C]
+	RGreaterThan // R[A] = R[B] > R[C]
+	RLessThan    // R[A] = R[B] < R[C]
+	RBang        // R[A] = !R[B]
+	RMinus       // R[A] = -R[B]
+
+	RJump        // A 番目の命令へ飛ぶ
+	RJumpIfFalse // R[A] が偽なら B 番目の命令へ飛ぶ
+
+	RArray // R[A] = [R[B], ..., R[B+C-1]]
+	RHash  // R[A] = {R[B]: R[B+1], ...}。C はキーと値を合わせた数
+	RIndex // R[A] = R[B][R[C]]
+
+	RCall       // R[A] = R[A](R[A+1], ..., R[A+B])
+	RReturn     // R[A] を返す
+	RReturnNull // null を返す
+	RClosure    // R[A] = 定数 B の関数と自由変数 R[A+1], ..., R[A+C] のクロージャ
+
+	RMakeCell    // R[A] をセルに入れる。引数は渡された値、それ以外は null で始まる
+	RGetCell     // R[A] = セル R[B] の値
+	RSetCell     // セル R[A] の値 = R[B]
+	RGetFreeCell // R[A] = 自由変数 B のセルの値
+	RSetFreeCell // 自由変数 A のセルの値 = R[B]
+
+	RSetLast // トップレベルの式文の値 R[A] を、最後に評価した値として残す
+)
+
+var registerOpcodeNames = [...]string{
+	RLoadConstant:   "RLoadConstant",
+	RLoadTrue:       "RLoadTrue",
+	RLoadFalse:      "RLoadFalse",
+	RLoadNull:       "RLoadNull",
+	RMove:           "RMove",
+	RGetGlobal:      "RGetGlobal",
+	RSetGlobal:      "RSetGlobal",
+	RGetBuiltin:     "RGetBuiltin",
+	RGetFree:        "RGetFree",
+	RCurrentClosure: "RCurrentClosure",
+	RAdd:            "RAdd",
+	RSub:            "RSub",
+	RMul:            "RMul",
+	RDiv:            "RDiv",
+	REqual:          "REqual",
+	RNotEqual:       "RNotEqual",
+	RGreaterThan:    "RGreaterThan",
+	RLessThan:       "RLessThan",
+	RBang:           "RBang",
+	RMinus:          "RMinus",
+	RJump:           "RJump",
+	RJumpIfFalse:    "RJumpIfFalse",
+	RArray:          "RArray",
+	RHash:           "RHash",
+	RIndex:          "RIndex",
+	RCall:           "RCall",
+	RReturn:         "RReturn",
+	RReturnNull:     "RReturnNull",
+	RClosure:        "RClosure",
+	RMakeCell:       "RMakeCell",
+	RGetCell:        "RGetCell",
+	RSetCell:        "RSetCell",
+	RGetFreeCell:    "RGetFreeCell",
+	RSetFreeCell:    "RSetFreeCell",
+	RSetLast:        "RSetLast",
+}
+
+func (op RegisterOpcode) String() string {
+	if int(op) < len(registerOpcodeNames) {
+		return registerOpcodeNames[op]
+	}
+	return fmt.Sprintf("RegisterOpcode(%d)", op)
+}
+
+// RegisterInstruction はレジスタ VM の1命令。使わないオペランドは 0
+type RegisterInstruction struct {
+	Op      RegisterOpcode
+	A, B, C int
+}
+
+func (ins RegisterInstruction) String() string {
+	return fmt.Sprintf("%s %d %d %d", ins.Op, ins.A, ins.B, ins.C)
+}
+
+// RegisterInstructions は命令列を1行に1命令で書き出せるようにしたもの
+type RegisterInstructions []RegisterInstruction
+
+func (ins RegisterInstructions) String() string {
+	var out bytes.Buffer
+	for i, in := range ins {
+		fmt.Fprintf(&out, "%04d %s\n", i, in)
+	}
+	return out.String()
+}
@@ -0,0 +1,113 @@
+package compiler
+
+import "github.com/kurarrr/monkey/ast"
+
+// 捕捉される局所変数のセル。
+//
+// 評価器のクロージャは定義された環境そのものを持つので、外側の関数とクロージャ、
+// 同じ変数を捕捉したクロージャどうしで代入が見える。VM で同じ意味にするため、
+// 入れ子の関数に捕捉される局所変数は関数の先頭でセルに入れ、読み書きはセルを通す。
+// クロージャには値ではなくセルを写す。
+
+// defineFunction は関数 fn の本体を s でコンパイルする前に、引数と関数名を定義し、
+// セルに入れる局所変数を決める。戻り値はセルに入れる局所変数で、関数の先頭でセルを作るのに使う。
+// セルに入れる let の変数はここで先に定義しておき、let の前に捕捉されても同じセルになるようにする
+func (s *SymbolTable) defineFunction(fn *ast.FunctionLiteral) []Symbol {
+	s.captured = capturedNames(fn)
+
+	// 関数名は、外側の変数がセルに入っているか本体で代入されるなら外側の変数として解決する
+	if fn.Name != "" && !s.Outer.isCell(fn.Name) && !assignsTo(fn.Body, fn.Name) {
+		s.DefineFunctionName(fn.Name)
+	}
+
+	cells := []Symbol{}
+	defined := map[int]bool{}
+	add := func(symbol Symbol) {
+		if symbol.Cell && !defined[symbol.Index] {
+			defined[symbol.Index] = true
+			cells = append(cells, symbol)
+		}
+	}
+	for _, p := range fn.Parameters {
+		add(s.Define(p.Value))
+	}
+	for _, name := range localLets(fn.Body) {
+		if s.captured[name] {
+			add(s.Define(name))
+		}
+	}
+	return cells
+}
+
+// isCell は name がこの表でセルに入った局所変数として定義されているかどうかを返す
+func (s *SymbolTable) isCell(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && symbol.Scope == LocalScope && symbol.Cell
+}
+
+// capturedNames は fn の本体の中の関数リテラルが外側から参照しうる名前を返す。
+// 入れ子の関数が自分で let した名前も含むので多めになるが、余分なセルは遅くなるだけで意味は変えない
+func capturedNames(fn *ast.FunctionLiteral) map[string]bool {
+	names := map[string]bool{}
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		if inner, ok := node.(*ast.FunctionLiteral); ok {
+			for name := range referencedNames(inner) {
+				names[name] = true
+			}
+			return false
+		}
+		return true
+	})
+	return names
+}
+
+// referencedNames は関数リテラル fn の中で、fn 自身の引数と関数名以外として使われる名前を返す
+func referencedNames(fn *ast.FunctionLiteral) map[string]bool {
+	names := map[string]bool{}
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			names[node.Value] = true
+		case *ast.FunctionLiteral:
+			for name := range referencedNames(node) {
+				names[name] = true
+			}
+			return false
+		}
+		return true
+	})
+	for _, p := range fn.Parameters {
+		delete(names, p.Value)
+	}
+	if fn.Name != "" && !assignsTo(fn.Body, fn.Name) {
+		delete(names, fn.Name)
+	}
+	return names
+}
+
+// localLets は本体で let する名前を返す。入れ子の関数の中の let は含めない
+func localLets(body *ast.BlockStatement) []string {
+	names := []string{}
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			names = append(names, node.Name.Value)
+		case *ast.FunctionLiteral:
+			return false
+		}
+		return true
+	})
+	return names
+}
+
+// assignsTo は node の中に name への代入文があるかどうかを返す。入れ子の関数の中も見る
+func assignsTo(node ast.Node, name string) bool {
+	found := false
+	ast.Inspect(node, func(node ast.Node) bool {
+		if as, ok := node.(*ast.AssignStatement); ok && as.Name.Value == name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,617 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/object"
+)
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	pool *ConstantPool // nil なら定数をまとめない
+
+	noSuperinstructions bool
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope は関数本体ごとに分けて命令列を溜めておくための領域
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	lastJumpTarget      int // 書き換えた飛び先のうち最も後ろの位置
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTableWithBuiltins(),
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// NewSymbolTableWithBuiltins は object.Builtins の全ての組み込み関数を定義したシンボルテーブルを作る。
+// 埋め込み先が RegisterBuiltin で追加した関数もここで OpGetBuiltin の添字に結び付く。
+// 本の Monkey と同じ振る舞いにしているときは、本にない組み込み関数は定義しない
+func NewSymbolTableWithBuiltins() *SymbolTable {
+	return NewSymbolTableWithCompat(object.CompatNone)
+}
+
+// NewSymbolTableWithCompat は compat の振る舞いで使える組み込み関数だけを定義した表を作る。
+// 使えない組み込み関数は未定義の識別子になるが、番号は object.Builtins のまま
+func NewSymbolTableWithCompat(compat object.Compat) *SymbolTable {
+	symbolTable := NewSymbolTable()
+	symbolTable.compat = compat
+	for i, v := range object.Builtins {
+		if !compat.BuiltinAvailable(v.Name) {
+			continue
+		}
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	return symbolTable
+}
+
+// NewWithState は REPL のように複数回のコンパイルでグローバル変数と定数を引き継ぐときに使う
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// SetCompat は compat の振る舞いでコンパイルするようにする。シンボルテーブルを作り直すので、Compile の前に呼ぶ
+func (c *Compiler) SetCompat(compat object.Compat) {
+	c.symbolTable = NewSymbolTableWithCompat(compat)
+}
+
+// SetConstantPool は整数・文字列定数を p から取るようにする。
+// 同じ p を使うコンパイラどうしで同じ値の定数が共有される。
+func (c *Compiler) SetConstantPool(p *ConstantPool) {
+	c.pool = p
+}
+
+// SetSuperinstructions はスーパー命令への融合を有効・無効にする。既定では有効
+func (c *Compiler) SetSuperinstructions(enabled bool) {
+	c.noSuperinstructions = !enabled
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		symbol, bind := c.symbolTable.DefineLet(node.Name.Value, node.Value)
+		err := c.Compile(node.Value)
+		bind()
+		if err != nil {
+			return err
+		}
+		switch {
+		case symbol.Scope == GlobalScope:
+			c.emit(code.OpSetGlobal, symbol.Index)
+		case symbol.Cell:
+			c.emit(code.OpSetLocalCell, symbol.Index)
+		default:
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
+	case *ast.AssignStatement:
+		symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+		if !ok {
+			return fmt.Errorf("identifier not found: %s%s", node.Name.Value, c.symbolTable.didYouMean(node.Name.Value))
+		}
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		switch {
+		case symbol.Scope == GlobalScope:
+			c.emit(code.OpSetGlobal, symbol.Index)
+		case symbol.Scope == LocalScope && symbol.Cell:
+			c.emit(code.OpSetLocalCell, symbol.Index)
+		case symbol.Scope == LocalScope:
+			c.emit(code.OpSetLocal, symbol.Index)
+		case symbol.Scope == FreeScope && symbol.Cell:
+			c.emit(code.OpSetFreeCell, symbol.Index)
+		case symbol.Scope == BuiltinScope:
+			return fmt.Errorf("cannot assign to builtin: %s", node.Name.Value)
+		default:
+			// セルに入っていない自由変数はクロージャに値が写されているので、書き換えても外側に届かない
+			return fmt.Errorf("cannot assign to captured variable: %s", node.Name.Value)
+		}
+
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emitBinary(code.OpAdd)
+		case "-":
+			c.emitBinary(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.IfExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// 飛び先はまだ分からないのでダミーの値を入れておき、後で書き換える
+		jumpNotTruthyPos := c.emitJumpNotTruthy(9999)
+
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+		if c.lastInstructionIs(code.OpPop) {
+			c.removeLastPop()
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			err := c.Compile(node.Alternative)
+			if err != nil {
+				return err
+			}
+			if c.lastInstructionIs(code.OpPop) {
+				c.removeLastPop()
+			}
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+
+	case *ast.WhileExpression:
+		loopStartPos := len(c.currentInstructions())
+
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emitJumpNotTruthy(9999)
+
+		// 本体の文はそれぞれ OpPop で値を捨てるので、スタックは伸びない
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loopStartPos)
+
+		afterBodyPos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterBodyPos)
+		c.emit(code.OpNull)
+
+	case *ast.IntegerLiteral:
+		var integer *object.Integer
+		if c.pool != nil {
+			integer = c.pool.Integer(node.Value)
+		} else {
+			integer = &object.Integer{Value: node.Value}
+		}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		var str *object.String
+		if c.pool != nil {
+			str = c.pool.String(node.Value)
+		} else {
+			str = &object.String{Value: node.Value}
+		}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("identifier not found: %s%s", node.Value, c.symbolTable.didYouMean(node.Value))
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		// 書いた順に積み、同じキーは後のものが勝つ
+		for _, pair := range node.Pairs {
+			err := c.Compile(pair.Key)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(pair.Value)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		c.enterScope()
+
+		for _, s := range c.symbolTable.defineFunction(node) {
+			c.emit(code.OpMakeCell, s.Index)
+		}
+
+		err := c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		instructions := c.leaveScope()
+
+		for _, s := range freeSymbols {
+			c.captureSymbol(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			Literal:       node,
+		}
+
+		fnIndex := c.addConstant(compiledFn)
+		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	case *ast.CallExpression:
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		if c.positioned(node) {
+			c.emit(code.OpConstant, c.addConstant(object.CallPosition(node)))
+			c.emit(code.OpCall, len(node.Arguments)+1)
+			break
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+	}
+
+	return nil
+}
+
+// positioned は call が Positioned な組み込み関数を名前で直接呼ぶかどうかを返す。
+// そのときは評価器と同じく呼び出しの位置を最後の引数に足す
+func (c *Compiler) positioned(call *ast.CallExpression) bool {
+	return positionedCall(c.symbolTable, call)
+}
+
+func positionedCall(s *SymbolTable, call *ast.CallExpression) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return false
+	}
+	symbol, ok := s.Resolve(ident.Value)
+	return ok && symbol.Scope == BuiltinScope && object.Builtins[symbol.Index].Builtin.Positioned
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// constantSuperinstructions は直前の OpConstant とまとめられる演算
+var constantSuperinstructions = map[code.Opcode]code.Opcode{
+	code.OpAdd: code.OpAddConstant,
+	code.OpSub: code.OpSubConstant,
+}
+
+// jumpSuperinstructions は直後の OpJumpNotTruthy とまとめられる比較
+var jumpSuperinstructions = map[code.Opcode]code.Opcode{
+	code.OpEqual:       code.OpEqualJumpNotTruthy,
+	code.OpNotEqual:    code.OpNotEqualJumpNotTruthy,
+	code.OpGreaterThan: code.OpGreaterThanJumpNotTruthy,
+	code.OpLessThan:    code.OpLessThanJumpNotTruthy,
+}
+
+// emitBinary は op を出力する。直前が OpConstant なら OpAddConstant などにまとめる
+func (c *Compiler) emitBinary(op code.Opcode) int {
+	if superOp, ok := constantSuperinstructions[op]; ok && c.canFuseLastInstruction() && c.lastInstructionIs(code.OpConstant) {
+		last := c.scopes[c.scopeIndex].lastInstruction
+		constIndex := int(code.ReadUint16(c.currentInstructions()[last.Position+1:]))
+		c.removeLastInstruction()
+		return c.emit(superOp, constIndex)
+	}
+	return c.emit(op)
+}
+
+// emitJumpNotTruthy は OpJumpNotTruthy を出力する。直前が比較なら比較と分岐をまとめる
+func (c *Compiler) emitJumpNotTruthy(pos int) int {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	if superOp, ok := jumpSuperinstructions[last.Opcode]; ok && c.canFuseLastInstruction() && len(c.currentInstructions()) > 0 {
+		c.removeLastInstruction()
+		return c.emit(superOp, pos)
+	}
+	return c.emit(code.OpJumpNotTruthy, pos)
+}
+
+// canFuseLastInstruction は直前の命令を次の命令と融合してよいかを返す。
+// if 式の分岐の終わりのように、直前の命令の後ろへ飛ぶジャンプがあると融合できない
+func (c *Compiler) canFuseLastInstruction() bool {
+	if c.noSuperinstructions {
+		return false
+	}
+	scope := c.scopes[c.scopeIndex]
+	return scope.lastJumpTarget <= scope.lastInstruction.Position
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	c.removeLastInstruction()
+}
+
+func (c *Compiler) removeLastInstruction() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+
+	// 書き換えるのはジャンプの飛び先だけ
+	if operand > c.scopes[c.scopeIndex].lastJumpTarget {
+		c.scopes[c.scopeIndex].lastJumpTarget = operand
+	}
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		if s.Cell {
+			c.emit(code.OpGetLocalCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		if s.Cell {
+			c.emit(code.OpGetFreeCell, s.Index)
+		} else {
+			c.emit(code.OpGetFree, s.Index)
+		}
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// captureSymbol はクロージャに写す自由変数を積む。セルに入った変数は値ではなくセルを積む
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+	}
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+}
@@ -0,0 +1,746 @@
+package compiler
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/parser"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAddConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 * 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSuperinstructions(t *testing.T) {
+	input := "let x = 1; if (x == 1) { x - 1 }"
+
+	fused := []code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 0),
+		// 0006
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpEqualJumpNotTruthy, 24),
+		// 0015
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpSubConstant, 2),
+		code.Make(code.OpJump, 25),
+		// 0024
+		code.Make(code.OpNull),
+		// 0025
+		code.Make(code.OpPop),
+	}
+	plain := []code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpEqual),
+		code.Make(code.OpJumpNotTruthy, 26),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpSub),
+		code.Make(code.OpJump, 27),
+		// 0026
+		code.Make(code.OpNull),
+		// 0027
+		code.Make(code.OpPop),
+	}
+
+	for _, enabled := range []bool{true, false} {
+		compiler := New()
+		compiler.SetSuperinstructions(enabled)
+		if err := compiler.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		expected := fused
+		if !enabled {
+			expected = plain
+		}
+		if err := testInstructions(expected, compiler.Bytecode().Instructions); err != nil {
+			t.Errorf("superinstructions=%t: %s", enabled, err)
+		}
+	}
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; one;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; one = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: "fn(a) { a = 1 }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 捕捉される変数はセルに入れ、外側とクロージャの代入を共有する
+			input: "fn() { let n = 0; fn() { n = n + 1 }; n }",
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpAddConstant, 1),
+					code.Make(code.OpSetFreeCell, 0),
+					code.Make(code.OpReturn),
+				},
+				[]code.Instructions{
+					code.Make(code.OpMakeCell, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocalCell, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1", "identifier not found: x"},
+		{"let count = 0; cuont = 1", "identifier not found: cuont; did you mean 'count'?"},
+		{"let total = 0; fn(n) { n + totl }", "identifier not found: totl; did you mean 'total'?"},
+		{"lne([])", "identifier not found: lne; did you mean 'len'?"},
+		{"len = 1", "cannot assign to builtin: len"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected error for %q, got nil", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestWhileExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let i = 0; while (i < 3) { i = i + 1; }",
+			expectedConstants: []interface{}{0, 3, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpLessThanJumpNotTruthy, 27),
+				// 0015
+				code.Make(code.OpGetGlobal, 0),
+				// 0018
+				code.Make(code.OpAddConstant, 2),
+				// 0021
+				code.Make(code.OpSetGlobal, 0),
+				// 0024
+				code.Make(code.OpJump, 6),
+				// 0027
+				code.Make(code.OpNull),
+				// 0028
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { let b = a; b }(1)",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpMakeCell, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let f = fn() { f() };",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "len([]);",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestRegisteredBuiltinSymbols(t *testing.T) {
+	object.RegisterBuiltin("hostNoop", func(args ...object.Object) object.Object { return nil })
+
+	table := NewSymbolTableWithBuiltins()
+
+	expected := map[string]int{
+		"len":      0,
+		"hostNoop": len(object.Builtins) - 1,
+	}
+	for name, index := range expected {
+		sym, ok := table.Resolve(name)
+		if !ok {
+			t.Fatalf("builtin %s not defined", name)
+		}
+		if sym.Scope != BuiltinScope || sym.Index != index {
+			t.Errorf("wrong symbol for %s. got=%+v, want index %d", name, sym, index)
+		}
+	}
+}
+
+func TestConstantPool(t *testing.T) {
+	pool := NewConstantPool()
+
+	compile := func(input string, pool *ConstantPool) []object.Object {
+		compiler := New()
+		compiler.SetConstantPool(pool)
+		if err := compiler.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		return compiler.Bytecode().Constants
+	}
+
+	first := compile(`let a = 42; "hello"`, pool)
+	second := compile(`"hello" + "world"; 42`, pool)
+
+	if first[0] != second[2] {
+		t.Errorf("integer constant 42 not shared between compilations")
+	}
+	if first[1] != second[0] {
+		t.Errorf("string constant \"hello\" not shared between compilations")
+	}
+	if pool.Len() != 3 {
+		t.Errorf("wrong pool size. want=3, got=%d", pool.Len())
+	}
+
+	// プールを使わなければ別々のオブジェクトになる
+	third := compile(`42`, nil)
+	if third[0] == first[0] {
+		t.Errorf("constant shared without a pool")
+	}
+}
+
+func TestUndefinedIdentifier(t *testing.T) {
+	program := parse("x")
+
+	compiler := New()
+	err := compiler.Compile(program)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if err.Error() != "identifier not found: x" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+}
+
+func TestBookCompat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 本にない組み込み関数は未定義になり、候補の名前も付けない
+		{"sort([2, 1])", "identifier not found: sort"},
+		{"lne([])", "identifier not found: lne"},
+		{"let f = fn() { ptus(1) }", "identifier not found: ptus"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		compiler.SetCompat(object.CompatBook)
+		register := NewRegisterCompiler()
+		register.SetCompat(object.CompatBook)
+		for _, err := range []error{compiler.Compile(parse(tt.input)), register.Compile(parse(tt.input))} {
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+			}
+		}
+	}
+
+	// 本にある組み込み関数の番号は object.Builtins のまま
+	symbol, ok := NewSymbolTableWithCompat(object.CompatBook).Resolve("puts")
+	if !ok || object.Builtins[symbol.Index].Name != "puts" {
+		t.Errorf("wrong symbol for puts: %+v, %t", symbol, ok)
+	}
+}
+
+func TestResolveScopes(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("b")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("c")
+
+	expected := []Symbol{
+		Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+		Symbol{Name: "c", Scope: LocalScope, Index: 0},
+		Symbol{Name: "b", Scope: FreeScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0].Name != "b" {
+		t.Errorf("wrong free symbols. got=%+v", secondLocal.FreeSymbols)
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q",
+			concatted, actual)
+	}
+
+	for i, ins := range concatted {
+		if actual[i] != ins {
+			return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q",
+				i, concatted, actual)
+		}
+	}
+
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d",
+			len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok {
+				return fmt.Errorf("constant %d - object is not Integer. got=%T (%+v)",
+					i, actual[i], actual[i])
+			}
+			if integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d - wrong value. got=%d, want=%d",
+					i, integer.Value, constant)
+			}
+
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+			err := testInstructions(constant, fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// 読まれない unused と g への代入も、値の 5 と g の関数も消える
+			input: "let f = fn() { let unused = 5; let g = fn() { 1 }; 2 }; f();",
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 副作用のある呼び出しは残し、値だけ捨てる
+			input: "fn() { let x = len([]); 2 }",
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// if の後ろへの飛び先になっている代入は OpPop にして、後ろの命令へのジャンプを詰める
+			input: "fn(c) { let x = if (c) { 1 } else { 2 }; let y = 3; if (c) { 4 } }",
+			expectedConstants: []interface{}{
+				1, 2, 4,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJumpNotTruthy, 11),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpJump, 14),
+					// 0011
+					code.Make(code.OpConstant, 1),
+					// 0014
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJumpNotTruthy, 26),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpJump, 27),
+					// 0026
+					code.Make(code.OpNull),
+					// 0027
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		original := compiler.Bytecode()
+		before := original.Instructions.String()
+
+		bytecode := Optimize(original)
+		if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+		if err := testConstants(tt.expectedConstants, bytecode.Constants); err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+		if original.Instructions.String() != before {
+			t.Errorf("%q: Optimize modified the original bytecode", tt.input)
+		}
+	}
+}
+
+func TestRegisterCompiler(t *testing.T) {
+	tests := []struct {
+		input    string
+		main     string
+		function string
+	}{
+		{
+			// 引数は R0, R1、局所変数 c は R2。局所変数は RMove なしでそのまま使う
+			input: "let f = fn(a, b) { let c = a + b; c * 2 }; f(1, 2);",
+			main: "0000 RClosure 0 1 0\n" +
+				"0001 RSetGlobal 0 0 0\n" +
+				"0002 RGetGlobal 0 0 0\n" +
+				"0003 RLoadConstant 1 2 0\n" +
+				"0004 RLoadConstant 2 3 0\n" +
+				"0005 RCall 0 2 0\n" +
+				"0006 RSetLast 0 0 0\n",
+			function: "0000 RAdd 2 0 1\n" +
+				"0001 RLoadConstant 3 0 0\n" +
+				"0002 RMul 3 2 3\n" +
+				"0003 RReturn 3 0 0\n",
+		},
+		{
+			// if の両方の枝が同じレジスタに値を置く
+			input: "let f = fn(n) { if (n < 2) { n } else { n - 1 } };",
+			main: "0000 RClosure 0 2 0\n" +
+				"0001 RSetGlobal 0 0 0\n",
+			function: "0000 RLoadConstant 2 0 0\n" +
+				"0001 RLessThan 2 0 2\n" +
+				"0002 RJumpIfFalse 2 5 0\n" +
+				"0003 RMove 1 0 0\n" +
+				"0004 RJump 7 0 0\n" +
+				"0005 RLoadConstant 2 1 0\n" +
+				"0006 RSub 1 0 2\n" +
+				"0007 RReturn 1 0 0\n",
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := NewRegisterCompiler()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		program := compiler.Program()
+
+		if got := program.Main.RegisterCode.String(); got != tt.main {
+			t.Errorf("%q: wrong main instructions.\nwant=\n%s\ngot=\n%s", tt.input, tt.main, got)
+		}
+
+		var fn *object.CompiledFunction
+		for _, c := range program.Constants {
+			if f, ok := c.(*object.CompiledFunction); ok {
+				fn = f
+			}
+		}
+		if fn == nil {
+			t.Fatalf("%q: no function in constants", tt.input)
+		}
+		if got := fn.RegisterCode.String(); got != tt.function {
+			t.Errorf("%q: wrong function instructions.\nwant=\n%s\ngot=\n%s", tt.input, tt.function, got)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package compiler
+
+import (
+	"sync"
+
+	"github.com/kurarrr/monkey/logging"
+	"github.com/kurarrr/monkey/metrics"
+	"github.com/kurarrr/monkey/object"
+)
+
+// ConstantPool は同じ値の整数・文字列定数を1つのオブジェクトにまとめる。
+// 多数のスクリプトを1つのプロセスでコンパイルするとき、コンパイラ間で共有すると
+// 同じ値の定数がメモリ上で1つで済む。定数は書き換えられないので共有しても問題ない。
+// 複数のゴルーチンから同時に使ってよい。
+type ConstantPool struct {
+	mu       sync.Mutex
+	integers map[int64]*object.Integer
+	strings  map[string]*object.String
+}
+
+// GlobalConstantPool はプロセス全体で共有するためのプール。
+// 取り除く手段はないので、スクリプトの集合が増え続ける用途では専用のプールを使うこと。
+var GlobalConstantPool = NewConstantPool()
+
+func NewConstantPool() *ConstantPool {
+	return &ConstantPool{
+		integers: make(map[int64]*object.Integer),
+		strings:  make(map[string]*object.String),
+	}
+}
+
+func (p *ConstantPool) Integer(value int64) *object.Integer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if obj, ok := p.integers[value]; ok {
+		metrics.ConstantPoolHits.Inc()
+		return obj
+	}
+	metrics.ConstantPoolMisses.Inc()
+	if logging.Enabled() {
+		logging.Debug("compiler: constant pool miss", "type", object.INTEGER_OBJ, "value", value)
+	}
+	obj := &object.Integer{Value: value}
+	p.integers[value] = obj
+	return obj
+}
+
+func (p *ConstantPool) String(value string) *object.String {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if obj, ok := p.strings[value]; ok {
+		metrics.ConstantPoolHits.Inc()
+		return obj
+	}
+	metrics.ConstantPoolMisses.Inc()
+	if logging.Enabled() {
+		logging.Debug("compiler: constant pool miss", "type", object.STRING_OBJ, "value", value)
+	}
+	obj := &object.String{Value: value}
+	p.strings[value] = obj
+	return obj
+}
+
+// Len はプールに入っている定数の数を返す
+func (p *ConstantPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.integers) + len(p.strings)
+}
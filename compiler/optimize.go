@@ -0,0 +1,200 @@
+package compiler
+
+import (
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/object"
+)
+
+// Optimize はコンパイル済みのバイトコードから、読まれない局所変数への代入と
+// どこからも参照されない定数を取り除いたものを返す。元の bytecode は書き換えない。
+//
+// 定数の番号が変わるので、REPL のように定数を次のコンパイルに引き継ぐときには使えない。
+func Optimize(bytecode *Bytecode) *Bytecode {
+	main := removeDeadStores(bytecode.Instructions)
+
+	functions := make([]*object.CompiledFunction, len(bytecode.Constants))
+	for i, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			copied := *fn
+			copied.Instructions = removeDeadStores(fn.Instructions)
+			functions[i] = &copied
+		}
+	}
+
+	// main から辿れる定数だけを残す。関数の定数は、その関数の命令が参照する定数も辿る
+	used := make([]bool, len(bytecode.Constants))
+	var mark func(ins code.Instructions)
+	mark = func(ins code.Instructions) {
+		for _, idx := range constantReferences(ins) {
+			if used[idx] {
+				continue
+			}
+			used[idx] = true
+			if fn := functions[idx]; fn != nil {
+				mark(fn.Instructions)
+			}
+		}
+	}
+	mark(main)
+
+	newIndex := make([]int, len(bytecode.Constants))
+	constants := []object.Object{}
+	for i, c := range bytecode.Constants {
+		if !used[i] {
+			continue
+		}
+		newIndex[i] = len(constants)
+		if fn := functions[i]; fn != nil {
+			c = fn
+		}
+		constants = append(constants, c)
+	}
+
+	for _, c := range constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			fn.Instructions = renumberConstants(fn.Instructions, newIndex)
+		}
+	}
+
+	return &Bytecode{
+		Instructions: renumberConstants(main, newIndex),
+		Constants:    constants,
+	}
+}
+
+// decodedInstruction は命令列を並べ替えるために1命令ずつ読み出したもの
+type decodedInstruction struct {
+	pos      int
+	op       code.Opcode
+	operands []int
+}
+
+func decodeInstructions(ins code.Instructions) []decodedInstruction {
+	decoded := []decodedInstruction{}
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			// 知らない命令が混ざっていたら、以降はそのまま残せないので読むのをやめる
+			return nil
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		decoded = append(decoded, decodedInstruction{pos: i, op: code.Opcode(ins[i]), operands: operands})
+		i += 1 + read
+	}
+	return decoded
+}
+
+func isJump(op code.Opcode) bool {
+	switch op {
+	case code.OpJump, code.OpJumpNotTruthy,
+		code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy, code.OpGreaterThanJumpNotTruthy,
+		code.OpLessThanJumpNotTruthy:
+		return true
+	}
+	return false
+}
+
+func referencesConstant(op code.Opcode) bool {
+	switch op {
+	case code.OpConstant, code.OpClosure, code.OpAddConstant, code.OpSubConstant:
+		return true
+	}
+	return false
+}
+
+// pushesWithoutSideEffect は、値を1つ積むだけで取り除いても結果が変わらない命令かどうかを返す
+func pushesWithoutSideEffect(in decodedInstruction) bool {
+	switch in.op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetLocal, code.OpGetGlobal, code.OpGetBuiltin, code.OpGetFree, code.OpCurrentClosure,
+		code.OpGetLocalCell, code.OpGetFreeCell:
+		return true
+	case code.OpClosure:
+		return in.operands[1] == 0
+	}
+	return false
+}
+
+// removeDeadStores は一度も OpGetLocal で読まれない局所変数への OpSetLocal を取り除く。
+// 代入する値を積む命令が副作用を持たなければそれも取り除き、そうでなければ OpPop で値を捨てる
+func removeDeadStores(ins code.Instructions) code.Instructions {
+	decoded := decodeInstructions(ins)
+	if decoded == nil {
+		return ins
+	}
+
+	read := map[int]bool{}
+	jumpTargets := map[int]bool{}
+	for _, in := range decoded {
+		if in.op == code.OpGetLocal {
+			read[in.operands[0]] = true
+		}
+		if isJump(in.op) {
+			jumpTargets[in.operands[0]] = true
+		}
+	}
+
+	removed := make([]bool, len(decoded))
+	changed := false
+	for i, in := range decoded {
+		if in.op != code.OpSetLocal || read[in.operands[0]] {
+			continue
+		}
+		changed = true
+		if i > 0 && !removed[i-1] && !jumpTargets[in.pos] && pushesWithoutSideEffect(decoded[i-1]) {
+			removed[i-1] = true
+			removed[i] = true
+			continue
+		}
+		decoded[i].op = code.OpPop
+		decoded[i].operands = nil
+	}
+	if !changed {
+		return ins
+	}
+
+	// 取り除いた命令への飛び先は、その後ろで最初に残る命令に付け替える
+	newPos := make(map[int]int, len(decoded)+1)
+	out := code.Instructions{}
+	for i, in := range decoded {
+		newPos[in.pos] = len(out)
+		if !removed[i] {
+			out = append(out, code.Make(in.op, in.operands...)...)
+		}
+	}
+	newPos[len(ins)] = len(out)
+
+	for i, in := range decoded {
+		if removed[i] || !isJump(in.op) {
+			continue
+		}
+		target := newPos[in.operands[0]]
+		at := newPos[in.pos]
+		copy(out[at:], code.Make(in.op, target))
+	}
+	return out
+}
+
+func constantReferences(ins code.Instructions) []int {
+	refs := []int{}
+	for _, in := range decodeInstructions(ins) {
+		if referencesConstant(in.op) {
+			refs = append(refs, in.operands[0])
+		}
+	}
+	return refs
+}
+
+// renumberConstants は定数を参照する命令のオペランドを newIndex で付け替えた命令列を返す
+func renumberConstants(ins code.Instructions, newIndex []int) code.Instructions {
+	out := make(code.Instructions, len(ins))
+	copy(out, ins)
+	for _, in := range decodeInstructions(ins) {
+		if !referencesConstant(in.op) {
+			continue
+		}
+		operands := append([]int{newIndex[in.operands[0]]}, in.operands[1:]...)
+		copy(out[in.pos:], code.Make(in.op, operands...))
+	}
+	return out
+}
@@ -0,0 +1,576 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/object"
+)
+
+// RegisterCompiler は AST をレジスタ VM (--engine=rvm) の命令列にコンパイルする。
+// スタック VM と比べるための実験的なバックエンドで、シンボルテーブルと定数の扱いは Compiler と同じ。
+//
+// 式は値を置いたレジスタの番号を返す。局所変数はそのレジスタをそのまま使うので、
+// スタック VM の OpGetLocal に当たる命令が要らない。
+type RegisterCompiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+	scope       *registerScope
+}
+
+// registerScope は関数本体1つ分のコンパイル状態
+type registerScope struct {
+	code      code.RegisterInstructions
+	numLocals int // 引数と局所変数のレジスタの数。一時レジスタはこの後ろから使う
+	top       int // 次に使える一時レジスタ
+	maxTop    int
+	main      bool
+	outer     *registerScope
+}
+
+// RegisterProgram はレジスタ VM に渡すコンパイル結果
+type RegisterProgram struct {
+	Main      *object.CompiledFunction
+	Constants []object.Object
+}
+
+func NewRegisterCompiler() *RegisterCompiler {
+	return &RegisterCompiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTableWithBuiltins(),
+		scope:       &registerScope{main: true},
+	}
+}
+
+// NewRegisterCompilerWithState は REPL のように複数回のコンパイルでグローバル変数と定数を引き継ぐときに使う
+func NewRegisterCompilerWithState(s *SymbolTable, constants []object.Object) *RegisterCompiler {
+	c := NewRegisterCompiler()
+	c.symbolTable = s
+	c.constants = constants
+	return c
+}
+
+// SetCompat は compat の振る舞いでコンパイルするようにする。シンボルテーブルを作り直すので、Compile の前に呼ぶ
+func (c *RegisterCompiler) SetCompat(compat object.Compat) {
+	c.symbolTable = NewSymbolTableWithCompat(compat)
+}
+
+func (c *RegisterCompiler) Compile(program *ast.Program) error {
+	for _, s := range program.Statements {
+		if err := c.statement(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RegisterCompiler) Program() *RegisterProgram {
+	return &RegisterProgram{
+		Main: &object.CompiledFunction{
+			RegisterCode: c.scope.code,
+			NumRegisters: c.scope.maxTop,
+		},
+		Constants: c.constants,
+	}
+}
+
+func (c *RegisterCompiler) emit(op code.RegisterOpcode, a, b, cc int) int {
+	c.scope.code = append(c.scope.code, code.RegisterInstruction{Op: op, A: a, B: b, C: cc})
+	return len(c.scope.code) - 1
+}
+
+func (c *RegisterCompiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// alloc は一時レジスタを1つ確保する。文の終わりでまとめて解放される
+func (c *RegisterCompiler) alloc() int {
+	r := c.scope.top
+	c.scope.top++
+	if c.scope.top > c.scope.maxTop {
+		c.scope.maxTop = c.scope.top
+	}
+	return r
+}
+
+// target は dst が指定されていなければ一時レジスタを確保して返す
+func (c *RegisterCompiler) target(dst int) int {
+	if dst < 0 {
+		return c.alloc()
+	}
+	return dst
+}
+
+func (c *RegisterCompiler) statement(s ast.Statement) error {
+	mark := c.scope.top
+	defer func() { c.scope.top = mark }()
+
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		r, err := c.expression(s.Expression, -1)
+		if err != nil {
+			return err
+		}
+		if c.scope.main {
+			c.emit(code.RSetLast, r, 0, 0)
+		}
+
+	case *ast.LetStatement:
+		symbol, bind := c.symbolTable.DefineLet(s.Name.Value, s.Value)
+		defer bind()
+		switch {
+		case symbol.Scope == GlobalScope:
+			r, err := c.expression(s.Value, -1)
+			if err != nil {
+				return err
+			}
+			c.emit(code.RSetGlobal, symbol.Index, r, 0)
+		case symbol.Cell:
+			r, err := c.expression(s.Value, -1)
+			if err != nil {
+				return err
+			}
+			c.emit(code.RSetCell, symbol.Index, r, 0)
+		default:
+			if _, err := c.expression(s.Value, symbol.Index); err != nil {
+				return err
+			}
+		}
+
+	case *ast.AssignStatement:
+		symbol, ok := c.symbolTable.Resolve(s.Name.Value)
+		if !ok {
+			return fmt.Errorf("identifier not found: %s%s", s.Name.Value, c.symbolTable.didYouMean(s.Name.Value))
+		}
+		switch {
+		case symbol.Scope == GlobalScope:
+			r, err := c.expression(s.Value, -1)
+			if err != nil {
+				return err
+			}
+			c.emit(code.RSetGlobal, symbol.Index, r, 0)
+		case symbol.Scope == LocalScope && symbol.Cell:
+			r, err := c.expression(s.Value, -1)
+			if err != nil {
+				return err
+			}
+			c.emit(code.RSetCell, symbol.Index, r, 0)
+		case symbol.Scope == LocalScope:
+			if _, err := c.expression(s.Value, symbol.Index); err != nil {
+				return err
+			}
+		case symbol.Scope == FreeScope && symbol.Cell:
+			r, err := c.expression(s.Value, -1)
+			if err != nil {
+				return err
+			}
+			c.emit(code.RSetFreeCell, symbol.Index, r, 0)
+		case symbol.Scope == BuiltinScope:
+			return fmt.Errorf("cannot assign to builtin: %s", s.Name.Value)
+		default:
+			return fmt.Errorf("cannot assign to captured variable: %s", s.Name.Value)
+		}
+
+	case *ast.ReturnStatement:
+		r, err := c.expression(s.ReturnValue, -1)
+		if err != nil {
+			return err
+		}
+		c.emit(code.RReturn, r, 0, 0)
+
+	case *ast.BlockStatement:
+		for _, stmt := range s.Statements {
+			if err := c.statement(stmt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// block はブロックを式として評価し、最後の式文の値を dst に入れる。式文で終わらなければ null
+func (c *RegisterCompiler) block(block *ast.BlockStatement, dst int) error {
+	n := len(block.Statements)
+	for i, s := range block.Statements {
+		if es, ok := s.(*ast.ExpressionStatement); ok && i == n-1 {
+			mark := c.scope.top
+			_, err := c.expression(es.Expression, dst)
+			c.scope.top = mark
+			return err
+		}
+		if err := c.statement(s); err != nil {
+			return err
+		}
+	}
+	c.emit(code.RLoadNull, dst, 0, 0)
+	return nil
+}
+
+// expression は node を評価する命令を出し、値の入ったレジスタを返す。
+// dst が 0 以上なら必ずそのレジスタに入れる。負なら局所変数のレジスタか新しい一時レジスタを返す
+func (c *RegisterCompiler) expression(node ast.Expression, dst int) (int, error) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		r := c.target(dst)
+		c.emit(code.RLoadConstant, r, c.addConstant(&object.Integer{Value: node.Value}), 0)
+		return r, nil
+
+	case *ast.FloatLiteral:
+		r := c.target(dst)
+		c.emit(code.RLoadConstant, r, c.addConstant(&object.Float{Value: node.Value}), 0)
+		return r, nil
+
+	case *ast.StringLiteral:
+		r := c.target(dst)
+		c.emit(code.RLoadConstant, r, c.addConstant(&object.String{Value: node.Value}), 0)
+		return r, nil
+
+	case *ast.Boolean:
+		r := c.target(dst)
+		if node.Value {
+			c.emit(code.RLoadTrue, r, 0, 0)
+		} else {
+			c.emit(code.RLoadFalse, r, 0, 0)
+		}
+		return r, nil
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return 0, fmt.Errorf("identifier not found: %s%s", node.Value, c.symbolTable.didYouMean(node.Value))
+		}
+		if symbol.Scope == LocalScope && !symbol.Cell && dst < 0 {
+			return symbol.Index, nil
+		}
+		r := c.target(dst)
+		c.loadSymbol(symbol, r)
+		return r, nil
+
+	case *ast.PrefixExpression:
+		mark := c.scope.top
+		right, err := c.expression(node.Right, -1)
+		if err != nil {
+			return 0, err
+		}
+		c.scope.top = mark
+		r := c.target(dst)
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.RBang, r, right, 0)
+		case "-":
+			c.emit(code.RMinus, r, right, 0)
+		default:
+			return 0, fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		return r, nil
+
+	case *ast.InfixExpression:
+		var op code.RegisterOpcode
+		switch node.Operator {
+		case "+":
+			op = code.RAdd
+		case "-":
+			op = code.RSub
+		case "*":
+			op = code.RMul
+		case "/":
+			op = code.RDiv
+		case "==":
+			op = code.REqual
+		case "!=":
+			op = code.RNotEqual
+		case ">":
+			op = code.RGreaterThan
+		case "<":
+			op = code.RLessThan
+		default:
+			return 0, fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+		mark := c.scope.top
+		l, r, err := c.operands(node.Left, node.Right)
+		if err != nil {
+			return 0, err
+		}
+		c.scope.top = mark
+		result := c.target(dst)
+		c.emit(op, result, l, r)
+		return result, nil
+
+	case *ast.IndexExpression:
+		mark := c.scope.top
+		l, i, err := c.operands(node.Left, node.Index)
+		if err != nil {
+			return 0, err
+		}
+		c.scope.top = mark
+		r := c.target(dst)
+		c.emit(code.RIndex, r, l, i)
+		return r, nil
+
+	case *ast.IfExpression:
+		r := c.target(dst)
+		mark := c.scope.top
+		cond, err := c.expression(node.Condition, -1)
+		if err != nil {
+			return 0, err
+		}
+		c.scope.top = mark
+		jumpIfFalse := c.emit(code.RJumpIfFalse, cond, 0, 0)
+
+		if err := c.block(node.Consequence, r); err != nil {
+			return 0, err
+		}
+		jump := c.emit(code.RJump, 0, 0, 0)
+
+		c.scope.code[jumpIfFalse].B = len(c.scope.code)
+		if node.Alternative == nil {
+			c.emit(code.RLoadNull, r, 0, 0)
+		} else if err := c.block(node.Alternative, r); err != nil {
+			return 0, err
+		}
+		c.scope.code[jump].A = len(c.scope.code)
+		return r, nil
+
+	case *ast.WhileExpression:
+		r := c.target(dst)
+		loopStart := len(c.scope.code)
+
+		mark := c.scope.top
+		cond, err := c.expression(node.Condition, -1)
+		if err != nil {
+			return 0, err
+		}
+		c.scope.top = mark
+		jumpIfFalse := c.emit(code.RJumpIfFalse, cond, 0, 0)
+
+		if err := c.statement(node.Body); err != nil {
+			return 0, err
+		}
+		c.emit(code.RJump, loopStart, 0, 0)
+
+		c.scope.code[jumpIfFalse].B = len(c.scope.code)
+		c.emit(code.RLoadNull, r, 0, 0)
+		return r, nil
+
+	case *ast.ArrayLiteral:
+		mark := c.scope.top
+		first, err := c.consecutive(node.Elements)
+		if err != nil {
+			return 0, err
+		}
+		c.scope.top = mark
+		r := c.target(dst)
+		c.emit(code.RArray, r, first, len(node.Elements))
+		return r, nil
+
+	case *ast.HashLiteral:
+		// 書いた順に並べ、同じキーは後のものが勝つ
+		elements := []ast.Expression{}
+		for _, pair := range node.Pairs {
+			elements = append(elements, pair.Key, pair.Value)
+		}
+
+		mark := c.scope.top
+		first, err := c.consecutive(elements)
+		if err != nil {
+			return 0, err
+		}
+		c.scope.top = mark
+		r := c.target(dst)
+		c.emit(code.RHash, r, first, len(elements))
+		return r, nil
+
+	case *ast.CallExpression:
+		mark := c.scope.top
+		callee := c.alloc()
+		if _, err := c.expression(node.Function, callee); err != nil {
+			return 0, err
+		}
+		numArgs := len(node.Arguments)
+		var extra []object.Object
+		if positionedCall(c.symbolTable, node) {
+			extra = append(extra, object.CallPosition(node))
+			numArgs++
+		}
+		if _, err := c.consecutive(node.Arguments, extra...); err != nil {
+			return 0, err
+		}
+		c.emit(code.RCall, callee, numArgs, 0)
+		c.scope.top = mark
+
+		if dst < 0 {
+			// 結果の入った callee のレジスタはそのまま返り値として使う
+			return c.alloc(), nil
+		}
+		c.emit(code.RMove, dst, callee, 0)
+		return dst, nil
+
+	case *ast.FunctionLiteral:
+		return c.functionLiteral(node, dst)
+
+	default:
+		return 0, fmt.Errorf("cannot compile %T", node)
+	}
+}
+
+// operands は二項演算の左右を評価する。右辺が局所変数に代入しうるときは、
+// 左辺の局所変数のレジスタを直接使うと値が変わってしまうので一時レジスタに写す
+func (c *RegisterCompiler) operands(left, right ast.Expression) (int, int, error) {
+	l, err := c.expression(left, -1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if l < c.scope.numLocals && assigns(right) {
+		tmp := c.alloc()
+		c.emit(code.RMove, tmp, l, 0)
+		l = tmp
+	}
+	r, err := c.expression(right, -1)
+	if err != nil {
+		return 0, 0, err
+	}
+	return l, r, nil
+}
+
+// consecutive は exps を連続した一時レジスタに評価し、先頭のレジスタを返す。
+// constants があれば exps の後ろのレジスタに読み込む
+func (c *RegisterCompiler) consecutive(exps []ast.Expression, constants ...object.Object) (int, error) {
+	regs := make([]int, len(exps)+len(constants))
+	for i := range regs {
+		regs[i] = c.alloc()
+	}
+	for i, e := range exps {
+		if _, err := c.expression(e, regs[i]); err != nil {
+			return 0, err
+		}
+	}
+	for i, obj := range constants {
+		c.emit(code.RLoadConstant, regs[len(exps)+i], c.addConstant(obj), 0)
+	}
+	if len(regs) == 0 {
+		return c.scope.top, nil
+	}
+	return regs[0], nil
+}
+
+func (c *RegisterCompiler) functionLiteral(node *ast.FunctionLiteral, dst int) (int, error) {
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+	c.scope = &registerScope{outer: c.scope}
+
+	cells := c.symbolTable.defineFunction(node)
+	// 局所変数の数は本体を数えて先に決めておき、一時レジスタと重ならないようにする
+	c.scope.numLocals = len(node.Parameters) + countLets(node.Body)
+	c.scope.top = c.scope.numLocals
+	c.scope.maxTop = c.scope.numLocals
+	for _, s := range cells {
+		c.emit(code.RMakeCell, s.Index, 0, 0)
+	}
+
+	n := len(node.Body.Statements)
+	for i, s := range node.Body.Statements {
+		if es, ok := s.(*ast.ExpressionStatement); ok && i == n-1 {
+			r, err := c.expression(es.Expression, -1)
+			if err != nil {
+				return 0, err
+			}
+			c.emit(code.RReturn, r, 0, 0)
+			break
+		}
+		if err := c.statement(s); err != nil {
+			return 0, err
+		}
+	}
+	if n == 0 || c.scope.code[len(c.scope.code)-1].Op != code.RReturn {
+		c.emit(code.RReturnNull, 0, 0, 0)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	fn := &object.CompiledFunction{
+		RegisterCode:  c.scope.code,
+		NumRegisters:  c.scope.maxTop,
+		NumLocals:     c.scope.numLocals,
+		NumParameters: len(node.Parameters),
+		Literal:       node,
+	}
+	c.symbolTable = c.symbolTable.Outer
+	c.scope = c.scope.outer
+
+	mark := c.scope.top
+	r := c.alloc()
+	for _, s := range freeSymbols {
+		c.captureSymbol(s, c.alloc())
+	}
+	c.emit(code.RClosure, r, c.addConstant(fn), len(freeSymbols))
+	c.scope.top = mark
+
+	if dst < 0 {
+		return c.alloc(), nil
+	}
+	c.emit(code.RMove, dst, r, 0)
+	return dst, nil
+}
+
+func (c *RegisterCompiler) loadSymbol(s Symbol, dst int) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.RGetGlobal, dst, s.Index, 0)
+	case LocalScope:
+		if s.Cell {
+			c.emit(code.RGetCell, dst, s.Index, 0)
+		} else {
+			c.emit(code.RMove, dst, s.Index, 0)
+		}
+	case BuiltinScope:
+		c.emit(code.RGetBuiltin, dst, s.Index, 0)
+	case FreeScope:
+		if s.Cell {
+			c.emit(code.RGetFreeCell, dst, s.Index, 0)
+		} else {
+			c.emit(code.RGetFree, dst, s.Index, 0)
+		}
+	case FunctionScope:
+		c.emit(code.RCurrentClosure, dst, 0, 0)
+	}
+}
+
+// captureSymbol はクロージャに写す自由変数を dst に入れる。セルに入った変数は値ではなくセルを入れる
+func (c *RegisterCompiler) captureSymbol(s Symbol, dst int) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.RMove, dst, s.Index, 0)
+	case FreeScope:
+		c.emit(code.RGetFree, dst, s.Index, 0)
+	default:
+		c.loadSymbol(s, dst)
+	}
+}
+
+// countLets は node の中の let 文を数える。入れ子の関数の中も数えるので多めになるが、
+// レジスタが余るだけで害はない
+func countLets(node ast.Node) int {
+	n := 0
+	ast.Modify(node, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.LetStatement); ok {
+			n++
+		}
+		return node
+	})
+	return n
+}
+
+// assigns は node の中に代入文があるかどうかを返す
+func assigns(node ast.Node) bool {
+	found := false
+	ast.Modify(node, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.AssignStatement); ok {
+			found = true
+		}
+		return node
+	})
+	return found
+}
@@ -0,0 +1,158 @@
+package compiler
+
+import (
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/diag"
+	"github.com/kurarrr/monkey/object"
+)
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	// Cell が true なら、変数はセルに入っていて読み書きはセルを通す。
+	// 入れ子の関数に捕捉される局所変数と、それを捕捉した自由変数がそうなる
+	Cell bool
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	FreeSymbols []Symbol
+
+	// captured は入れ子の関数に捕捉される名前。ここで定義する局所変数のうち、これに含まれるものをセルに入れる
+	captured map[string]bool
+
+	// compat はどの Monkey と同じに振る舞うか。一番外側の表にだけ付ける
+	compat object.Compat
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{store: s, FreeSymbols: free}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func (s *SymbolTable) Define(name string) Symbol {
+	// セルに入れた変数を let し直したときは、捕捉したクロージャにも見えるよう同じセルを使う
+	if existing, ok := s.store[name]; ok && existing.Scope == LocalScope && existing.Cell {
+		return existing
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+		symbol.Cell = s.captured[name]
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// DefineLet は let の名前を定義する。値が関数リテラルでなければ、返した関数を呼ぶまで
+// 名前を定義する前の状態に戻しておき、let x = x + 1 や let y = y の右辺が前の束縛を読むようにする。
+// 関数リテラルは自分の名前で再帰できるよう、すぐに見えるようにする
+func (s *SymbolTable) DefineLet(name string, value ast.Expression) (Symbol, func()) {
+	previous, defined := s.store[name]
+	symbol := s.Define(name)
+	if _, ok := value.(*ast.FunctionLiteral); ok {
+		return symbol, func() {}
+	}
+
+	if defined {
+		s.store[name] = previous
+	} else {
+		delete(s.store, name)
+	}
+	return symbol, func() { s.store[name] = symbol }
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName は関数が自分自身の名前で再帰呼び出しできるようにする
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Cell: original.Cell}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Names はこの表と外側の表で解決できる全ての名前を返す。順序は決まっていない
+func (s *SymbolTable) Names() []string {
+	names := []string{}
+	for ; s != nil; s = s.Outer {
+		for name := range s.store {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Compat は一番外側の表に設定された振る舞いを返す
+func (s *SymbolTable) Compat() object.Compat {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s.compat
+}
+
+// didYouMean は表が候補を付ける設定なら diag.DidYouMean の文を返す
+func (s *SymbolTable) didYouMean(name string) string {
+	if !s.Compat().Suggestions() {
+		return ""
+	}
+	return diag.DidYouMean(name, s.Names())
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+	return obj, ok
+}
@@ -0,0 +1,204 @@
+package diag
+
+// 構文エラーのコード。構文解析器はメッセージから判定せず、エラーを作るときに直接付ける
+const (
+	UnexpectedToken    = "E1001"
+	ExpressionExpected = "E1002"
+	InvalidNumber      = "E1003"
+	IllegalCharacter   = "E1004"
+)
+
+// Catalog は全てのコードをコード順に並べたもの
+var Catalog = []Entry{
+	{
+		Code:  UnexpectedToken,
+		Title: "unexpected token",
+		Explanation: `The parser needed a particular token next, such as a closing parenthesis
+or the "=" of a let statement, and found something else.`,
+		Example: `let x 5;           // expected next token to be =, got INT instead
+if (x > 1 { x }    // expected next token to be ), got { instead`,
+	},
+	{
+		Code:  ExpressionExpected,
+		Title: "expression expected",
+		Explanation: `An expression had to start here, but the token cannot begin one. This is
+usually an operator with a missing left operand or a stray closing bracket.`,
+		Example: `let x = * 2;       // no prefix parse function for * found`,
+	},
+	{
+		Code:  InvalidNumber,
+		Title: "invalid number literal",
+		Explanation: `A number literal does not fit the type it is read as, most often an
+integer literal outside the 64-bit signed range.`,
+		Example: `let big = 9223372036854775808;   // could not parse "9223372036854775808" as integer`,
+	},
+	{
+		Code:  IllegalCharacter,
+		Title: "illegal character",
+		Explanation: `The lexer met a character that is not part of the language, or a string
+or block comment that is never closed. The token is reported as ILLEGAL.`,
+		Example: `let x = 1 @ 2;     // no prefix parse function for ILLEGAL found
+let s = "open;     // the string runs to the end of the input`,
+	},
+	{
+		Code:        "E2001",
+		Title:       "cannot assign to builtin",
+		Prefixes:    []string{"cannot assign to builtin"},
+		Explanation: `Builtin functions such as len and puts cannot be reassigned. Bind the new value to another name with let.`,
+		Example: `len = fn(x) { 0 };   // cannot assign to builtin: len (vm and rvm engines)
+let myLen = fn(x) { 0 };`,
+	},
+	{
+		Code:     "E2002",
+		Title:    "cannot assign to captured variable",
+		Prefixes: []string{"cannot assign to captured variable"},
+		Explanation: `Earlier versions of the vm and rvm engines copied the variables a closure
+uses from the enclosing function, so a closure could not reassign them. Every
+engine now shares captured variables between the function and its closures,
+and this error is no longer reported.`,
+		Example: `let counter = fn() { let n = 0; fn() { n = n + 1; n } };
+let c = counter(); c(); c();   // 2 on every engine`,
+	},
+	{
+		Code:     "E2003",
+		Title:    "undefined variable",
+		Prefixes: []string{"identifier not found"},
+		Explanation: `The name is not bound in the current scope or any enclosing one. Check the
+spelling, and that the let comes before the use. Assignment with = also needs
+an earlier let.`,
+		Example: `let total = 1;
+puts(totl);        // identifier not found: totl
+count = 1;         // identifier not found: count`,
+	},
+	{
+		Code:     "E3001",
+		Title:    "type mismatch",
+		Prefixes: []string{"type mismatch"},
+		Explanation: `The two operands of an infix operator have types that cannot be combined.
+Convert one side first, for example with str, int or float.`,
+		Example: `1 + "2";           // type mismatch: INTEGER + STRING
+str(1) + "2";      // "12"`,
+	},
+	{
+		Code:        "E3002",
+		Title:       "unknown operator",
+		Prefixes:    []string{"unknown operator"},
+		Explanation: `The operator is not defined for the operand types.`,
+		Example: `-true;             // unknown operator: -BOOLEAN
+"a" - "b";         // unknown operator: STRING - STRING`,
+	},
+	{
+		Code:        "E3003",
+		Title:       "division by zero",
+		Prefixes:    []string{"division by zero"},
+		Explanation: `Dividing an integer, float or decimal by zero is an error.`,
+		Example: `10 / 0;            // division by zero: 10 / 0
+10.0 / 0.0;        // division by zero: 10.0 / 0.0`,
+	},
+	{
+		Code:        "E3004",
+		Title:       "index operator not supported",
+		Prefixes:    []string{"index operator not supported"},
+		Explanation: `Only arrays can be indexed with integers and only hashes with keys.`,
+		Example:     `let n = 5; n[0];   // index operator not supported: INTEGER`,
+	},
+	{
+		Code:        "E3005",
+		Title:       "unusable as hash key",
+		Prefixes:    []string{"unusable as hash key"},
+		Explanation: `Hash keys must be integers, strings or booleans.`,
+		Example:     `{[1, 2]: "pair"};  // unusable as hash key: ARRAY`,
+	},
+	{
+		Code:        "E3006",
+		Title:       "not a function",
+		Prefixes:    []string{"not a function"},
+		Explanation: `Only functions, closures and builtins can be called.`,
+		Example:     `let x = 5; x(1);   // not a function: INTEGER`,
+	},
+	{
+		Code:        "E3007",
+		Title:       "wrong number of arguments",
+		Prefixes:    []string{"wrong number of arguments:"},
+		Explanation: `A function was called with a different number of arguments than it has parameters.`,
+		Example: `let add = fn(a, b) { a + b };
+add(1);            // wrong number of arguments: want=2, got=1`,
+	},
+	{
+		Code:        "E4001",
+		Title:       "wrong number of arguments to builtin",
+		Prefixes:    []string{"wrong number of arguments."},
+		Explanation: `A builtin function was called with a number of arguments it does not accept.`,
+		Example:     `len("a", "b");     // wrong number of arguments. got=2, want=1`,
+	},
+	{
+		Code:  "E4002",
+		Title: "wrong argument type for builtin",
+		Prefixes: []string{
+			"argument to `", "base for `", "message for `",
+			"environment option for `", "unknown environment option for `",
+		},
+		Explanation: `A builtin function was given an argument of a type it does not handle.`,
+		Example: `first(1);          // argument to ` + "`first`" + ` must be ARRAY, got INTEGER
+assert(false, 1);  // message for ` + "`assert`" + ` must be STRING, got INTEGER`,
+	},
+	{
+		Code:     "E4003",
+		Title:    "conversion failed",
+		Prefixes: []string{"could not parse", "invalid base for", "invalid decimal literal", "invalid semantic version", "float "},
+		Explanation: `int, float, parseInt, decimal or semverCompare could not convert the value,
+because the string is not a number or version in the requested form or the
+float is outside the integer range.`,
+		Example: `int("12a");        // could not parse "12a" as integer in base 10
+parseInt("z", 40); // invalid base for ` + "`parseInt`" + `: 40
+int(100000000000000000000.0);   // float 1e+20 out of integer range
+semverCompare("1.2", "1.2.0");  // invalid semantic version for ` + "`semverCompare`" + `: "1.2"`,
+	},
+	{
+		Code:     "E4004",
+		Title:    "syntax error in evaluated code",
+		Prefixes: []string{"eval: ", "parse: ", "evalAst: "},
+		Explanation: `The source given to eval or parse, or the syntax tree given to evalAst, is not
+a valid program. The message lists the parser's errors for that source.`,
+		Example: `eval("let = 1");   // eval: parse error at 1:5: expected next token to be IDENT, got = instead`,
+	},
+	{
+		Code:     "E4005",
+		Title:    "contract failed",
+		Prefixes: []string{"assertion failed", "precondition failed", "postcondition failed"},
+		Explanation: `assert, require or ensure was called with a false or null condition. The
+message gives the line and column of the call, and the optional second argument
+is appended to it.`,
+		Example: `require(n > 0, "n must be positive");   // precondition failed at 1:1: n must be positive`,
+	},
+	{
+		Code:     "E5001",
+		Title:    "stack overflow",
+		Prefixes: []string{"stack overflow"},
+		Explanation: `The program ran out of call frames or stack slots, almost always because
+of recursion that never reaches its base case. Every engine allows 1024 nested
+calls.`,
+		Example: `let f = fn(n) { f(n + 1) };
+f(0);              // stack overflow: more than 1024 nested calls`,
+	},
+	{
+		Code:     "E6001",
+		Title:    "macro expansion failed",
+		Prefixes: []string{"macro ", "wrong number of arguments to macro", "wrong number of arguments to quote"},
+		Explanation: `A macro call could not be expanded: the macro got the wrong number of
+arguments, failed while running, or returned something other than a quote.`,
+		Example: `let unless = macro(cond, body) { quote(if (!(unquote(cond))) { unquote(body) }) };
+unless(true);      // wrong number of arguments to macro unless: want=2, got=1`,
+	},
+	{
+		Code:  "E9001",
+		Title: "internal error",
+		Prefixes: []string{
+			"cannot compile", "unknown register opcode", "unknown opcode",
+			"internal error", "poisoned by an earlier internal error",
+		},
+		Explanation: `The compiler, the evaluator or a VM reached a state that should not be
+possible, or panicked. After a panic the interpreter refuses to run anything
+more, because its state may be broken. Please report the program that caused it.`,
+	},
+}
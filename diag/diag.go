@@ -0,0 +1,48 @@
+// Package diag は構文エラーと実行時エラーに付ける安定したコードの一覧を持つ。
+//
+// コードは E と4桁の数字で、頭の桁で種類を分ける。一度割り当てたコードの意味は変えない。
+//
+//	E1xxx  字句と構文
+//	E2xxx  名前と束縛
+//	E3xxx  演算と呼び出し
+//	E4xxx  組み込み関数
+//	E5xxx  実行時の上限
+//	E6xxx  マクロ
+//	E9xxx  処理系の内部エラー
+package diag
+
+import "strings"
+
+// Entry はコード1つ分の説明
+type Entry struct {
+	Code  string
+	Title string
+	// Prefixes はこのコードに当たるエラーメッセージの書き出し。Classify が使う
+	Prefixes    []string
+	Explanation string
+	Example     string
+}
+
+// Lookup は code の説明を返す
+func Lookup(code string) (Entry, bool) {
+	for _, e := range Catalog {
+		if e.Code == code {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Classify は実行時エラーやコンパイルエラーのメッセージからコードを決める。
+// 書き出しが最も長く一致する項目を選ぶ。どれにも当たらなければ空文字列
+func Classify(msg string) string {
+	code, longest := "", 0
+	for _, e := range Catalog {
+		for _, prefix := range e.Prefixes {
+			if len(prefix) > longest && strings.HasPrefix(msg, prefix) {
+				code, longest = e.Code, len(prefix)
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,152 @@
+package diag
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	format := regexp.MustCompile(`^E[1-9]\d{3}$`)
+	prev := ""
+	for _, e := range Catalog {
+		if !format.MatchString(e.Code) {
+			t.Errorf("malformed code %q", e.Code)
+		}
+		if e.Code <= prev {
+			t.Errorf("%s is out of order or duplicated after %s", e.Code, prev)
+		}
+		if e.Title == "" || e.Explanation == "" {
+			t.Errorf("%s has no title or explanation", e.Code)
+		}
+		prev = e.Code
+	}
+
+	if e, ok := Lookup("E2003"); !ok || e.Title != "undefined variable" {
+		t.Errorf("wrong entry for E2003: %+v", e)
+	}
+	if _, ok := Lookup("E0000"); ok {
+		t.Errorf("expected no entry for E0000")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		msg  string
+		code string
+	}{
+		{"identifier not found: x", "E2003"},
+		{"cannot assign to captured variable: n", "E2002"},
+		{"type mismatch: INTEGER + BOOLEAN", "E3001"},
+		{"unknown operator: -BOOLEAN", "E3002"},
+		{"unknown operator !", "E3002"},
+		{"wrong number of arguments: want=2, got=1", "E3007"},
+		{"wrong number of arguments. got=2, want=1", "E4001"},
+		// 長い書き出しが優先される
+		{"wrong number of arguments to macro m: want=1, got=2", "E6001"},
+		{"unknown environment option for `eval`: \"x\"", "E4002"},
+		{"could not parse \"x\" as integer in base 10", "E4003"},
+		{"invalid semantic version for `semverCompare`: \"1.2\"", "E4003"},
+		{"stack overflow: more than 1024 nested calls", "E5001"},
+		{"unknown register opcode: RMOD", "E9001"},
+		{"internal error: runtime error: index out of range [3] with length 2", "E9001"},
+		{"poisoned by an earlier internal error: boom", "E9001"},
+		{"something else entirely", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Classify(tt.msg); got != tt.code {
+			t.Errorf("Classify(%q) wrong. want=%q, got=%q", tt.msg, tt.code, got)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		msg      string
+		lang     string
+		expected string
+	}{
+		{"type mismatch: INTEGER + BOOLEAN", "ja", "型が合いません: INTEGER + BOOLEAN"},
+		{"unknown operator: -BOOLEAN", "ja", "使えない演算子です: -BOOLEAN"},
+		{"wrong number of arguments: want=2, got=1", "ja", "引数の数が違います: 2 個のはずが 1 個でした"},
+		{"argument to `first` must be ARRAY, got INTEGER", "ja", "`first` の引数は ARRAY でなければなりませんが INTEGER でした"},
+		{"precondition failed: n must be positive", "ja", "事前条件が満たされていません: n must be positive"},
+		{"precondition failed at 3:5: n must be positive", "ja", "事前条件が満たされていません (3:5): n must be positive"},
+		// 入れ子になったメッセージは中身も訳す
+		{"macro m: identifier not found: x", "ja", "マクロ m: 識別子が見つかりません: x"},
+		{
+			"eval: parse error at 1:5: expected next token to be IDENT, got = instead; parse error at 1:5: no prefix parse function for = found",
+			"ja",
+			"eval: 1:5 で構文エラー: 次のトークンは IDENT のはずですが = でした; 1:5 で構文エラー: = で始まる式はありません",
+		},
+		{"poisoned by an earlier internal error: boom", "ja", "前に起きたエラーのため実行できません: 内部エラー: boom"},
+		{"warning: add is deprecated: use add2", "ja", "警告: add は非推奨です: use add2"},
+		// 埋め込んだ値の中の $1 はそのまま残る
+		{"assertion failed: costs $1", "ja", "アサーションが失敗しました: costs $1"},
+		// 訳のないメッセージと英語はそのまま
+		{"something else", "ja", "something else"},
+		{"type mismatch: INTEGER + BOOLEAN", "en", "type mismatch: INTEGER + BOOLEAN"},
+		{"type mismatch: INTEGER + BOOLEAN", "fr", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		if got := Translate(tt.msg, tt.lang); got != tt.expected {
+			t.Errorf("Translate(%q, %q) wrong.\nwant=%q\ngot =%q", tt.msg, tt.lang, tt.expected, got)
+		}
+	}
+}
+
+func TestLanguageFromEnv(t *testing.T) {
+	tests := []struct {
+		lcAll, lcMessages, lang string
+		expected                string
+	}{
+		{"", "", "", "en"},
+		{"", "", "ja_JP.UTF-8", "ja"},
+		{"", "", "ja", "ja"},
+		{"", "", "fr_FR.UTF-8", "en"},
+		{"", "C", "ja_JP.UTF-8", "en"},
+		{"ja_JP.eucJP", "en_US.UTF-8", "", "ja"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("LC_ALL", tt.lcAll)
+		t.Setenv("LC_MESSAGES", tt.lcMessages)
+		t.Setenv("LANG", tt.lang)
+		if got := LanguageFromEnv(); got != tt.expected {
+			t.Errorf("LC_ALL=%q LC_MESSAGES=%q LANG=%q: want=%q, got=%q", tt.lcAll, tt.lcMessages, tt.lang, tt.expected, got)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"length", "len", "puts", "total", "totals", "x"}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"lenght", "length"},
+		{"lne", "len"},
+		{"totl", "total"},
+		{"Puts", "puts"},
+		// 距離が同じなら辞書順で先のもの
+		{"totalz", "total"},
+		// 短い名前や遠い名前には候補を出さない
+		{"y", ""},
+		{"ab", ""},
+		{"foobar", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Suggest(tt.name, candidates); got != tt.expected {
+			t.Errorf("Suggest(%q) wrong. want=%q, got=%q", tt.name, tt.expected, got)
+		}
+	}
+
+	if got := DidYouMean("lenght", candidates); got != "; did you mean 'length'?" {
+		t.Errorf("wrong DidYouMean: %q", got)
+	}
+	if got := Translate("identifier not found: lenght; did you mean 'length'?", "ja"); got != "識別子が見つかりません: lenght; 'length' のことですか?" {
+		t.Errorf("wrong translation: %q", got)
+	}
+}
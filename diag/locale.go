@@ -0,0 +1,143 @@
+package diag
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Languages は Translate が扱える言語
+var Languages = []string{"en", "ja"}
+
+// translation は英語のメッセージ1種類を別の言語に置き換える規則。
+// template の $1 などは pattern の部分一致に置き換わる。
+// nested が true なら、部分一致はそれ自体がメッセージなので再帰的に訳してから埋め込む
+type translation struct {
+	pattern  *regexp.Regexp
+	template string
+	nested   bool
+}
+
+func rule(pattern, template string) translation {
+	return translation{pattern: regexp.MustCompile("^" + pattern + "$"), template: template}
+}
+
+func nestedRule(pattern, template string) translation {
+	t := rule(pattern, template)
+	t.nested = true
+	return t
+}
+
+// catalogs は言語ごとの規則。上から順に試し、最初に一致したものを使う
+var catalogs = map[string][]translation{
+	"ja": {
+		// eval や parse は構文エラーを "; " でつないで返す
+		nestedRule(`(.+?); (.+)`, "$1; $2"),
+
+		// 構文
+		rule(`expected next token to be (.+), got (.+) instead`, "次のトークンは $1 のはずですが $2 でした"),
+		rule(`no prefix parse function for (.+) found`, "$1 で始まる式はありません"),
+		rule(`could not parse (".*") as integer in base (\d+)`, "$1 を $2 進数の整数として解釈できません"),
+		rule(`could not parse (".*") as integer`, "$1 を整数として解釈できません"),
+		rule(`could not parse (".*") as float`, "$1 を浮動小数点数として解釈できません"),
+		nestedRule(`parse error at (\d+:\d+): (.+)`, "$1 で構文エラー: $2"),
+
+		// 名前
+		rule(`identifier not found: (.*)`, "識別子が見つかりません: $1"),
+		rule(`did you mean (.+)\?`, "$1 のことですか?"),
+		rule(`cannot assign to builtin: (.+)`, "組み込み関数には代入できません: $1"),
+		rule(`cannot assign to captured variable: (.+)`, "クロージャが捕捉した変数には代入できません: $1"),
+
+		// 演算と呼び出し
+		rule(`type mismatch: (.+)`, "型が合いません: $1"),
+		rule(`unknown operator:? (.+)`, "使えない演算子です: $1"),
+		rule(`division by zero: (.+)`, "ゼロで割りました: $1"),
+		rule(`index operator not supported: (.+)`, "添字で取り出せない型です: $1"),
+		rule(`unusable as hash key: (.+)`, "ハッシュのキーにできない型です: $1"),
+		rule(`not a function: (.+)`, "関数ではありません: $1"),
+		rule(`wrong number of arguments: want=(\d+), got=(\d+)`, "引数の数が違います: $1 個のはずが $2 個でした"),
+
+		// 組み込み関数
+		rule(`wrong number of arguments\. got=(\d+), want=(.+)`, "引数の数が違います: $2 個のはずが $1 個でした"),
+		rule("argument to (`.+`) must be (.+), got (.+)", "$1 の引数は $2 でなければなりませんが $3 でした"),
+		rule("argument to (`.+`) not supported, got (.+)", "$1 の引数に $2 は使えません"),
+		rule("base for (`.+`) must be (.+), got (.+)", "$1 の基数は $2 でなければなりませんが $3 でした"),
+		rule("message for (`.+`) must be (.+), got (.+)", "$1 のメッセージは $2 でなければなりませんが $3 でした"),
+		rule("environment option for (`.+`) must be (.+), got (.+)", "$1 の環境の指定は $2 でなければなりませんが $3 でした"),
+		rule("unknown environment option for (`.+`): (.+)", "$1 の環境の指定が不明です: $2"),
+		rule("invalid base for (`.+`): (.+)", "$1 の基数が不正です: $2"),
+		rule(`invalid decimal literal: (.+)`, "10進数として不正な値です: $1"),
+		rule("invalid semantic version for (`.+`): (.+)", "$1 に渡したバージョンが不正です: $2"),
+		rule(`float (.+) out of integer range`, "浮動小数点数 $1 は整数の範囲を超えています"),
+		nestedRule(`(eval|parse|evalAst): (.+)`, "$1: $2"),
+		rule(`assertion failed at (\d+:\d+)(.*)`, "アサーションが失敗しました ($1)$2"),
+		rule(`precondition failed at (\d+:\d+)(.*)`, "事前条件が満たされていません ($1)$2"),
+		rule(`postcondition failed at (\d+:\d+)(.*)`, "事後条件が満たされていません ($1)$2"),
+		rule(`assertion failed(.*)`, "アサーションが失敗しました$1"),
+		rule(`precondition failed(.*)`, "事前条件が満たされていません$1"),
+		rule(`postcondition failed(.*)`, "事後条件が満たされていません$1"),
+
+		// 上限
+		rule(`stack overflow: more than (\d+) nested calls`, "スタックが溢れました: 呼び出しの入れ子が $1 を超えました"),
+		rule(`stack overflow`, "スタックが溢れました"),
+
+		// 内部エラー
+		rule(`internal error: (.+)`, "内部エラー: $1"),
+		nestedRule(`poisoned by an earlier (.+)`, "前に起きたエラーのため実行できません: $1"),
+
+		// 警告
+		rule(`warning: (.+) is deprecated: (.*)`, "警告: $1 は非推奨です: $2"),
+
+		// マクロ
+		rule(`wrong number of arguments to macro (.+): want=(\d+), got=(\d+)`, "マクロ $1 の引数の数が違います: $2 個のはずが $3 個でした"),
+		rule(`wrong number of arguments to quote: want=1, got=(\d+)`, "quote の引数は1個のはずが $1 個でした"),
+		rule(`macro (.+) must return a QUOTE, got (.+)`, "マクロ $1 は QUOTE を返さなければなりませんが $2 でした"),
+		nestedRule(`macro (\S+): (.+)`, "マクロ $1: $2"),
+	},
+}
+
+var placeholder = regexp.MustCompile(`\$\d`)
+
+// Translate は英語のメッセージ msg を lang の言語に訳す。
+// 訳がなければ、あるいは lang が英語か未知の言語なら msg をそのまま返す
+func Translate(msg, lang string) string {
+	for _, t := range catalogs[lang] {
+		groups := t.pattern.FindStringSubmatch(msg)
+		if groups == nil {
+			continue
+		}
+		// 埋め込んだ部分一致の中の $1 を置き換えないよう、テンプレートだけを1度なめる
+		return placeholder.ReplaceAllStringFunc(t.template, func(ref string) string {
+			i, _ := strconv.Atoi(ref[1:])
+			if t.nested {
+				return Translate(groups[i], lang)
+			}
+			return groups[i]
+		})
+	}
+	return msg
+}
+
+// LanguageFromEnv は LC_ALL, LC_MESSAGES, LANG の順に見て、最初に設定されているものから
+// Translate に渡す言語を決める。対応していない言語なら "en"
+func LanguageFromEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		// ja_JP.UTF-8 のような形から言語の部分だけを取り出す
+		lang := strings.ToLower(value)
+		if i := strings.IndexAny(lang, "_.@"); i >= 0 {
+			lang = lang[:i]
+		}
+		for _, supported := range Languages {
+			if lang == supported {
+				return lang
+			}
+		}
+		return "en"
+	}
+	return "en"
+}
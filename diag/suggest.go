@@ -0,0 +1,66 @@
+package diag
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Suggest は candidates の中から name の打ち間違いと思われる名前を選ぶ。
+// 編集距離 (隣り合う2文字の入れ替えも1回と数える) が名前の長さの 1/3 以下で最も近いもの。
+// 同じ距離なら辞書順で先のものを返す。見つからなければ空文字列
+func Suggest(name string, candidates []string) string {
+	limit := len([]rune(name)) / 3
+	if limit == 0 {
+		return ""
+	}
+
+	sorted := append([]string{}, candidates...)
+	sort.Strings(sorted)
+
+	best, bestDist := "", limit+1
+	for _, c := range sorted {
+		if c == name {
+			continue
+		}
+		if d := editDistance(name, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// DidYouMean は Suggest で候補が見つかればメッセージの後ろに付ける文を返す
+func DidYouMean(name string, candidates []string) string {
+	if s := Suggest(name, candidates); s != "" {
+		return fmt.Sprintf("; did you mean '%s'?", s)
+	}
+	return ""
+}
+
+// editDistance は a と b の編集距離 (optimal string alignment distance) を返す
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// d[i][j] は s[:i] と t[:j] の距離
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
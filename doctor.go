@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kurarrr/monkey/diag"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/mkc"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/parser"
+	"github.com/kurarrr/monkey/spec"
+	"github.com/kurarrr/monkey/usagestats"
+	"github.com/kurarrr/monkey/vm"
+)
+
+// doctorReport は monkey doctor が JSON で書き出す結果
+type doctorReport struct {
+	OK              bool          `json:"ok"`
+	FormatVersion   int           `json:"mkcFormatVersion"`
+	LanguageVersion string        `json:"mkcLanguageVersion"`
+	Engines         []string      `json:"engines"`
+	Languages       []string      `json:"languages"`
+	Checks          []doctorCheck `json:"checks"`
+}
+
+// doctorCheck は確認1つの結果。失敗したときは Detail に理由を書く
+type doctorCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// selfTests は全てのエンジンで同じ結果になるはずのプログラム
+var selfTests = []spec.Case{
+	{Name: "arithmetic", Input: "1 + 2 * 3 - 4 / 2", Result: "5"},
+	{Name: "conditionals", Input: `if (1 < 2) { "yes" } else { "no" }`, Result: "yes"},
+	{Name: "closures", Input: "let add = fn(a) { fn(b) { a + b } }; add(2)(3)", Result: "5"},
+	{Name: "recursion", Input: "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", Result: "610"},
+	{Name: "collections", Input: `let h = {"a": [1, 2, 3]}; len(h["a"]) + len("ab")`, Result: "5"},
+	{Name: "builtins", Input: "let a = push([1, 2], 3); first(a) + last(a) + len(rest(a))", Result: "6"},
+}
+
+// doctor は monkey doctor の本体。エンジンの自己テスト、.mkc の読み書き、組み込み関数と
+// エラーコードの表、今の設定 (--dialect, MONKEY_USAGE_FILE) を確かめ、結果を JSON で出す。
+// CI のイメージに monkey を入れたときの確認に使う。1つでも失敗すれば 1 を返す
+func doctor(stdout io.Writer) int {
+	r := doctorReport{
+		OK:              true,
+		FormatVersion:   mkc.FormatVersion,
+		LanguageVersion: mkc.LanguageVersion,
+		Engines:         spec.Engines,
+		Languages:       diag.Languages,
+	}
+	add := func(name string, err error) {
+		c := doctorCheck{Name: name, OK: err == nil}
+		if err != nil {
+			c.Detail = err.Error()
+			r.OK = false
+		}
+		r.Checks = append(r.Checks, c)
+	}
+
+	for _, engine := range spec.Engines {
+		add("engine "+engine, checkEngine(engine))
+	}
+	add("mkc round trip", checkMKC())
+
+	add("builtins", checkBuiltins())
+	add("error catalog", checkCatalog())
+	if dialect != nil {
+		add("dialect", parser.New(lexer.New("")).SetDialect(dialect))
+	}
+	if path := os.Getenv("MONKEY_USAGE_FILE"); path != "" {
+		_, err := usagestats.ReadStats(path)
+		add("usage file", err)
+	}
+
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stdout, "monkey: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s\n", out)
+	if !r.OK {
+		return 1
+	}
+	return 0
+}
+
+// checkEngine は selfTests を engine で実行し、最初に結果が違ったものをエラーにする
+func checkEngine(engine string) error {
+	for _, c := range selfTests {
+		if err := spec.Run(c, engine); err != nil {
+			return fmt.Errorf("%s: %s", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkMKC は自己テストの1つを .mkc に書き出して読み戻し、スタック VM で実行する
+func checkMKC() error {
+	c := selfTests[len(selfTests)-1]
+	bytecode, err := mkc.Compile(c.Input)
+	if err != nil {
+		return err
+	}
+	data, err := mkc.Encode(bytecode, c.Input)
+	if err != nil {
+		return err
+	}
+	decoded, err := mkc.Decode(data)
+	if err != nil {
+		return err
+	}
+	machine := vm.New(decoded)
+	if err := machine.Run(); err != nil {
+		return err
+	}
+	if got := machine.LastPoppedStackElem().Inspect(); got != c.Result {
+		return fmt.Errorf("got %s, want %s", got, c.Result)
+	}
+	return nil
+}
+
+// checkBuiltins は組み込み関数の名前が重複しておらず、全てに関数があることを確かめる
+func checkBuiltins() error {
+	seen := map[string]bool{}
+	for _, b := range object.Builtins {
+		if seen[b.Name] {
+			return fmt.Errorf("duplicate builtin %s", b.Name)
+		}
+		seen[b.Name] = true
+		if b.Builtin == nil || b.Builtin.Fn == nil {
+			return fmt.Errorf("builtin %s has no function", b.Name)
+		}
+	}
+	return nil
+}
+
+// checkCatalog はエラーコードがコード順に並び、重複していないことを確かめる
+func checkCatalog() error {
+	prev := ""
+	for _, e := range diag.Catalog {
+		if e.Code <= prev {
+			return fmt.Errorf("%s listed after %s", e.Code, prev)
+		}
+		prev = e.Code
+	}
+	return nil
+}
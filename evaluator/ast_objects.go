@@ -0,0 +1,422 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/token"
+)
+
+// AST のノードは "type" キーにノード名を持つハッシュとしてスクリプトに渡す。
+// 例えば 1 + x は次のようになる。
+//
+//	{"type": "InfixExpression", "operator": "+",
+//	 "left": {"type": "IntegerLiteral", "value": 1},
+//	 "right": {"type": "Identifier", "value": "x"}}
+//
+// evalAst は同じ形のハッシュを AST に戻して評価する。
+
+// astToObject はノードをハッシュに変換する。nil は null になる
+func astToObject(node ast.Node) object.Object {
+	switch node := node.(type) {
+	case *ast.Program:
+		return newNodeHash("Program", "statements", statementsToArray(node.Statements))
+	case *ast.LetStatement:
+		return newNodeHash("LetStatement",
+			"name", &object.String{Value: node.Name.Value},
+			"value", astToObject(node.Value))
+	case *ast.AssignStatement:
+		return newNodeHash("AssignStatement",
+			"name", &object.String{Value: node.Name.Value},
+			"value", astToObject(node.Value))
+	case *ast.ReturnStatement:
+		return newNodeHash("ReturnStatement", "value", astToObject(node.ReturnValue))
+	case *ast.ExpressionStatement:
+		return newNodeHash("ExpressionStatement", "expression", astToObject(node.Expression))
+	case *ast.BlockStatement:
+		return newNodeHash("BlockStatement", "statements", statementsToArray(node.Statements))
+	case *ast.Identifier:
+		return newNodeHash("Identifier", "value", &object.String{Value: node.Value})
+	case *ast.IntegerLiteral:
+		return newNodeHash("IntegerLiteral", "value", &object.Integer{Value: node.Value})
+	case *ast.FloatLiteral:
+		return newNodeHash("FloatLiteral", "value", &object.Float{Value: node.Value})
+	case *ast.StringLiteral:
+		return newNodeHash("StringLiteral", "value", &object.String{Value: node.Value})
+	case *ast.Boolean:
+		return newNodeHash("Boolean", "value", nativeBoolToBooleanObject(node.Value))
+	case *ast.PrefixExpression:
+		return newNodeHash("PrefixExpression",
+			"operator", &object.String{Value: node.Operator},
+			"right", astToObject(node.Right))
+	case *ast.InfixExpression:
+		return newNodeHash("InfixExpression",
+			"operator", &object.String{Value: node.Operator},
+			"left", astToObject(node.Left),
+			"right", astToObject(node.Right))
+	case *ast.IfExpression:
+		var alternative object.Object = NULL
+		if node.Alternative != nil {
+			alternative = astToObject(node.Alternative)
+		}
+		return newNodeHash("IfExpression",
+			"condition", astToObject(node.Condition),
+			"consequence", astToObject(node.Consequence),
+			"alternative", alternative)
+	case *ast.WhileExpression:
+		return newNodeHash("WhileExpression",
+			"condition", astToObject(node.Condition),
+			"body", astToObject(node.Body))
+	case *ast.FunctionLiteral:
+		params := make([]object.Object, len(node.Parameters))
+		for i, p := range node.Parameters {
+			params[i] = &object.String{Value: p.Value}
+		}
+		return newNodeHash("FunctionLiteral",
+			"parameters", &object.Array{Elements: params},
+			"body", astToObject(node.Body),
+			"name", &object.String{Value: node.Name})
+	case *ast.MacroLiteral:
+		params := make([]object.Object, len(node.Parameters))
+		for i, p := range node.Parameters {
+			params[i] = &object.String{Value: p.Value}
+		}
+		return newNodeHash("MacroLiteral",
+			"parameters", &object.Array{Elements: params},
+			"body", astToObject(node.Body))
+	case *ast.CallExpression:
+		return newNodeHash("CallExpression",
+			"function", astToObject(node.Function),
+			"arguments", expressionsToArray(node.Arguments))
+	case *ast.ArrayLiteral:
+		return newNodeHash("ArrayLiteral", "elements", expressionsToArray(node.Elements))
+	case *ast.IndexExpression:
+		return newNodeHash("IndexExpression",
+			"left", astToObject(node.Left),
+			"index", astToObject(node.Index))
+	case *ast.HashLiteral:
+		pairs := make([]object.Object, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			pairs[i] = &object.Array{Elements: []object.Object{
+				astToObject(pair.Key), astToObject(pair.Value),
+			}}
+		}
+		return newNodeHash("HashLiteral", "pairs", &object.Array{Elements: pairs})
+	default:
+		return NULL
+	}
+}
+
+func newNodeHash(nodeType string, fields ...interface{}) *object.Hash {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	set := func(name string, value object.Object) {
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	set("type", &object.String{Value: nodeType})
+	for i := 0; i < len(fields); i += 2 {
+		set(fields[i].(string), fields[i+1].(object.Object))
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+func statementsToArray(stmts []ast.Statement) *object.Array {
+	elements := make([]object.Object, len(stmts))
+	for i, s := range stmts {
+		elements[i] = astToObject(s)
+	}
+	return &object.Array{Elements: elements}
+}
+
+func expressionsToArray(exps []ast.Expression) *object.Array {
+	elements := make([]object.Object, len(exps))
+	for i, e := range exps {
+		elements[i] = astToObject(e)
+	}
+	return &object.Array{Elements: elements}
+}
+
+// astReader は astToObject の逆変換を行う。最初に見つけた不正な箇所を err に残す
+type astReader struct {
+	err error
+}
+
+func (r *astReader) fail(format string, a ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, a...)
+	}
+}
+
+func (r *astReader) field(h *object.Hash, nodeType, name string) object.Object {
+	key := &object.String{Value: name}
+	pair, ok := h.Pairs[key.HashKey()]
+	if !ok {
+		r.fail("missing field %q in %s", name, nodeType)
+		return NULL
+	}
+	return pair.Value
+}
+
+func (r *astReader) stringField(h *object.Hash, nodeType, name string) string {
+	value := r.field(h, nodeType, name)
+	str, ok := value.(*object.String)
+	if !ok {
+		if r.err == nil {
+			r.fail("field %q in %s must be STRING, got %s", name, nodeType, value.Type())
+		}
+		return ""
+	}
+	return str.Value
+}
+
+func (r *astReader) arrayField(h *object.Hash, nodeType, name string) []object.Object {
+	value := r.field(h, nodeType, name)
+	arr, ok := value.(*object.Array)
+	if !ok {
+		if r.err == nil {
+			r.fail("field %q in %s must be ARRAY, got %s", name, nodeType, value.Type())
+		}
+		return nil
+	}
+	return arr.Elements
+}
+
+func (r *astReader) node(obj object.Object) ast.Node {
+	h, ok := obj.(*object.Hash)
+	if !ok {
+		r.fail("AST node must be HASH, got %s", obj.Type())
+		return nil
+	}
+	nodeType := r.stringField(h, "node", "type")
+	if r.err != nil {
+		return nil
+	}
+
+	switch nodeType {
+	case "Program":
+		return &ast.Program{Statements: r.statements(r.arrayField(h, nodeType, "statements"))}
+	case "LetStatement":
+		name := r.stringField(h, nodeType, "name")
+		return &ast.LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let"},
+			Name:  newIdentifier(name),
+			Value: r.expression(r.field(h, nodeType, "value")),
+		}
+	case "AssignStatement":
+		name := r.stringField(h, nodeType, "name")
+		return &ast.AssignStatement{
+			Token: token.Token{Type: token.ASSIGN, Literal: "="},
+			Name:  newIdentifier(name),
+			Value: r.expression(r.field(h, nodeType, "value")),
+		}
+	case "ReturnStatement":
+		return &ast.ReturnStatement{
+			Token:       token.Token{Type: token.RETURN, Literal: "return"},
+			ReturnValue: r.expression(r.field(h, nodeType, "value")),
+		}
+	case "ExpressionStatement":
+		return &ast.ExpressionStatement{Expression: r.expression(r.field(h, nodeType, "expression"))}
+	case "BlockStatement":
+		return r.block(h)
+	case "Identifier":
+		return newIdentifier(r.stringField(h, nodeType, "value"))
+	case "IntegerLiteral":
+		value, ok := r.field(h, nodeType, "value").(*object.Integer)
+		if !ok {
+			r.fail("field %q in %s must be INTEGER", "value", nodeType)
+			return nil
+		}
+		return &ast.IntegerLiteral{
+			Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value.Value, 10)},
+			Value: value.Value,
+		}
+	case "FloatLiteral":
+		value, ok := r.field(h, nodeType, "value").(*object.Float)
+		if !ok {
+			r.fail("field %q in %s must be FLOAT", "value", nodeType)
+			return nil
+		}
+		return &ast.FloatLiteral{
+			Token: token.Token{Type: token.FLOAT, Literal: strconv.FormatFloat(value.Value, 'f', -1, 64)},
+			Value: value.Value,
+		}
+	case "StringLiteral":
+		value := r.stringField(h, nodeType, "value")
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: value}, Value: value}
+	case "Boolean":
+		value, ok := r.field(h, nodeType, "value").(*object.Boolean)
+		if !ok {
+			r.fail("field %q in %s must be BOOLEAN", "value", nodeType)
+			return nil
+		}
+		literal := "false"
+		if value.Value {
+			literal = "true"
+		}
+		return &ast.Boolean{Token: token.Token{Type: token.LookupIdent(literal), Literal: literal}, Value: value.Value}
+	case "PrefixExpression":
+		operator := r.stringField(h, nodeType, "operator")
+		return &ast.PrefixExpression{
+			Token:    token.Token{Type: token.TokenType(operator), Literal: operator},
+			Operator: operator,
+			Right:    r.expression(r.field(h, nodeType, "right")),
+		}
+	case "InfixExpression":
+		operator := r.stringField(h, nodeType, "operator")
+		return &ast.InfixExpression{
+			Token:    token.Token{Type: token.TokenType(operator), Literal: operator},
+			Operator: operator,
+			Left:     r.expression(r.field(h, nodeType, "left")),
+			Right:    r.expression(r.field(h, nodeType, "right")),
+		}
+	case "IfExpression":
+		ie := &ast.IfExpression{
+			Token:       token.Token{Type: token.IF, Literal: "if"},
+			Condition:   r.expression(r.field(h, nodeType, "condition")),
+			Consequence: r.blockObject(r.field(h, nodeType, "consequence")),
+		}
+		if alt := r.field(h, nodeType, "alternative"); alt != NULL {
+			ie.Alternative = r.blockObject(alt)
+		}
+		return ie
+	case "WhileExpression":
+		return &ast.WhileExpression{
+			Token:     token.Token{Type: token.WHILE, Literal: "while"},
+			Condition: r.expression(r.field(h, nodeType, "condition")),
+			Body:      r.blockObject(r.field(h, nodeType, "body")),
+		}
+	case "FunctionLiteral":
+		fl := &ast.FunctionLiteral{
+			Token: token.Token{Type: token.FUNCTION, Literal: "fn"},
+			Body:  r.blockObject(r.field(h, nodeType, "body")),
+		}
+		for _, p := range r.arrayField(h, nodeType, "parameters") {
+			name, ok := p.(*object.String)
+			if !ok {
+				r.fail("parameters in %s must be STRING, got %s", nodeType, p.Type())
+				return nil
+			}
+			fl.Parameters = append(fl.Parameters, newIdentifier(name.Value))
+		}
+		return fl
+	case "MacroLiteral":
+		ml := &ast.MacroLiteral{
+			Token: token.Token{Type: token.MACRO, Literal: "macro"},
+			Body:  r.blockObject(r.field(h, nodeType, "body")),
+		}
+		for _, p := range r.arrayField(h, nodeType, "parameters") {
+			name, ok := p.(*object.String)
+			if !ok {
+				r.fail("parameters in %s must be STRING, got %s", nodeType, p.Type())
+				return nil
+			}
+			ml.Parameters = append(ml.Parameters, newIdentifier(name.Value))
+		}
+		return ml
+	case "CallExpression":
+		return &ast.CallExpression{
+			Token:     token.Token{Type: token.LPAREN, Literal: "("},
+			Function:  r.expression(r.field(h, nodeType, "function")),
+			Arguments: r.expressions(r.arrayField(h, nodeType, "arguments")),
+		}
+	case "ArrayLiteral":
+		return &ast.ArrayLiteral{
+			Token:    token.Token{Type: token.LBRACKET, Literal: "["},
+			Elements: r.expressions(r.arrayField(h, nodeType, "elements")),
+		}
+	case "IndexExpression":
+		return &ast.IndexExpression{
+			Token: token.Token{Type: token.LBRACKET, Literal: "["},
+			Left:  r.expression(r.field(h, nodeType, "left")),
+			Index: r.expression(r.field(h, nodeType, "index")),
+		}
+	case "HashLiteral":
+		hl := &ast.HashLiteral{Token: token.Token{Type: token.LBRACE, Literal: "{"}}
+		for _, p := range r.arrayField(h, nodeType, "pairs") {
+			pair, ok := p.(*object.Array)
+			if !ok || len(pair.Elements) != 2 {
+				r.fail("pairs in %s must be [key, value] arrays", nodeType)
+				return nil
+			}
+			hl.Pairs = append(hl.Pairs, ast.HashPair{
+				Key:   r.expression(pair.Elements[0]),
+				Value: r.expression(pair.Elements[1]),
+			})
+		}
+		return hl
+	default:
+		r.fail("unknown AST node type: %s", nodeType)
+		return nil
+	}
+}
+
+func (r *astReader) expression(obj object.Object) ast.Expression {
+	node := r.node(obj)
+	if node == nil {
+		return nil
+	}
+	exp, ok := node.(ast.Expression)
+	if !ok {
+		r.fail("expected an expression node, got %T", node)
+		return nil
+	}
+	return exp
+}
+
+func (r *astReader) expressions(objs []object.Object) []ast.Expression {
+	exps := []ast.Expression{}
+	for _, o := range objs {
+		exps = append(exps, r.expression(o))
+	}
+	return exps
+}
+
+func (r *astReader) statements(objs []object.Object) []ast.Statement {
+	stmts := []ast.Statement{}
+	for _, o := range objs {
+		node := r.node(o)
+		if node == nil {
+			return stmts
+		}
+		switch node := node.(type) {
+		case ast.Statement:
+			stmts = append(stmts, node)
+		case ast.Expression:
+			// 式がそのまま渡されたら式文として扱う
+			stmts = append(stmts, &ast.ExpressionStatement{Expression: node})
+		default:
+			r.fail("expected a statement node, got %T", node)
+			return stmts
+		}
+	}
+	return stmts
+}
+
+func (r *astReader) block(h *object.Hash) *ast.BlockStatement {
+	return &ast.BlockStatement{
+		Token:      token.Token{Type: token.LBRACE, Literal: "{"},
+		Statements: r.statements(r.arrayField(h, "BlockStatement", "statements")),
+	}
+}
+
+func (r *astReader) blockObject(obj object.Object) *ast.BlockStatement {
+	node := r.node(obj)
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*ast.BlockStatement)
+	if !ok {
+		r.fail("expected a BlockStatement node, got %T", node)
+		return nil
+	}
+	return block
+}
+
+func newIdentifier(name string) *ast.Identifier {
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
@@ -0,0 +1,162 @@
+package evaluator
+
+import (
+	"strings"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/parser"
+)
+
+// AllowEval が true のときだけ eval(code, envOption) が使える。
+// 任意のコードを実行できてしまうので既定では無効にしておく。
+var AllowEval = false
+
+// RegisterBuiltin は埋め込み先から Go の関数を組み込み関数として公開する。
+// 登録先は VM と共有の object.Builtins なので、どちらのエンジンからも呼べる。
+func RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	object.RegisterBuiltin(name, fn)
+}
+
+// builtins は評価器にだけある組み込み関数
+var builtins = map[string]*object.Builtin{
+	"parse": {Fn: parseBuiltin},
+}
+
+// envBuiltins は呼び出し元の環境を必要とする組み込み関数。
+// 識別子を解決するたびに、その時点の環境を捕まえた Builtin を作る。
+var envBuiltins = map[string]func(env *object.Environment) *object.Builtin{
+	"bindings": func(env *object.Environment) *object.Builtin {
+		return &object.Builtin{
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return namesToArray(env.Names())
+			},
+		}
+	},
+	"globalBindings": func(env *object.Environment) *object.Builtin {
+		return &object.Builtin{
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return namesToArray(env.Global().Names())
+			},
+		}
+	},
+	"deleteBinding": func(env *object.Environment) *object.Builtin {
+		return &object.Builtin{
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				name, ok := args[0].(*object.String)
+				if !ok {
+					return newError("argument to `deleteBinding` must be STRING, got %s", args[0].Type())
+				}
+				return nativeBoolToBooleanObject(env.Delete(name.Value))
+			},
+		}
+	},
+}
+
+func namesToArray(names []string) *object.Array {
+	elements := make([]object.Object, len(names))
+	for i, name := range names {
+		elements[i] = &object.String{Value: name}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// newEvalBuiltin は呼び出し元の環境 env を捕まえた eval 組み込み関数を作る。
+// envOption が "current"(既定) なら env で、"isolated" なら新しい環境で評価する。
+func newEvalBuiltin(env *object.Environment) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			src, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `eval` must be STRING, got %s", args[0].Type())
+			}
+
+			target := env
+			if len(args) == 2 {
+				opt, ok := args[1].(*object.String)
+				if !ok {
+					return newError("environment option for `eval` must be STRING, got %s", args[1].Type())
+				}
+				switch opt.Value {
+				case "current":
+				case "isolated":
+					target = object.NewEnvironment()
+					target.SetCompat(env.Compat())
+				default:
+					return newError("unknown environment option for `eval`: %q", opt.Value)
+				}
+			}
+
+			program, errObj := parseSource("eval", src.Value)
+			if errObj != nil {
+				return errObj
+			}
+
+			return Eval(program, target)
+		},
+	}
+}
+
+// parseSource は src を構文解析する。構文エラーがあれば name を頭に付けたエラーを返す
+func parseSource(name, src string) (*ast.Program, *object.Error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		msgs := []string{}
+		for _, err := range p.Errors() {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, newError("%s: %s", name, strings.Join(msgs, "; "))
+	}
+	return program, nil
+}
+
+// parseBuiltin は parse(code) の実装。AST をハッシュとして返す
+func parseBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	src, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `parse` must be STRING, got %s", args[0].Type())
+	}
+
+	program, errObj := parseSource("parse", src.Value)
+	if errObj != nil {
+		return errObj
+	}
+	return astToObject(program)
+}
+
+// newEvalAstBuiltin は parse が返す形のハッシュを AST に戻し、呼び出し元の環境で評価する。
+// parse と組み合わせれば eval と同じことができるので、eval と同じく AllowEval で制限する。
+func newEvalAstBuiltin(env *object.Environment) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			r := &astReader{}
+			node := r.node(args[0])
+			if r.err != nil {
+				return newError("evalAst: %s", r.err)
+			}
+
+			return Eval(node, env)
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package evaluator
+
+import (
+	"sync"
+
+	"github.com/kurarrr/monkey/ast"
+)
+
+// DeprecationHandler は @deprecated の付いた関数が呼ばれたときに、呼び出し箇所ごとに1度だけ呼ばれる。
+// call は呼び出しの式、reason は @deprecated に書かれた理由
+type DeprecationHandler func(call *ast.CallExpression, reason string)
+
+var (
+	deprecationMu      sync.Mutex
+	deprecationHandler DeprecationHandler
+	warnedCalls        = map[*ast.CallExpression]bool{}
+)
+
+// SetDeprecationHandler は以降の評価で使う DeprecationHandler を設定する。nil で警告をやめる。
+// 設定し直すと、警告済みの呼び出し箇所も忘れる
+func SetDeprecationHandler(h DeprecationHandler) {
+	deprecationMu.Lock()
+	defer deprecationMu.Unlock()
+	deprecationHandler = h
+	warnedCalls = map[*ast.CallExpression]bool{}
+}
+
+// warnDeprecated は call がまだ警告していない呼び出し箇所なら DeprecationHandler に知らせる
+func warnDeprecated(call *ast.CallExpression, reason string) {
+	deprecationMu.Lock()
+	h := deprecationHandler
+	first := h != nil && !warnedCalls[call]
+	if first {
+		warnedCalls[call] = true
+	}
+	deprecationMu.Unlock()
+
+	if first {
+		h(call, reason)
+	}
+}
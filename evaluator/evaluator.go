@@ -0,0 +1,606 @@
+package evaluator
+
+import (
+	"sync"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/diag"
+	"github.com/kurarrr/monkey/logging"
+	"github.com/kurarrr/monkey/metrics"
+	"github.com/kurarrr/monkey/object"
+)
+
+// MaxCallDepth は関数呼び出しの入れ子の上限。VM の MaxFrames と揃える
+const MaxCallDepth = 1024
+
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+)
+
+// SafeEval は Eval と同じく node を評価するが、評価中に起きた Go の panic を
+// *object.InternalError にして返す。panic した環境は壊れているかもしれないので env に印を付け、
+// 以降の SafeEval は評価せずに *object.PoisonedError を返す。
+// 第三者のスクリプトを動かすホストは Eval の代わりにこちらを使う
+func SafeEval(node ast.Node, env *object.Environment) (result object.Object, err error) {
+	if poisoned := env.Poisoned(); poisoned != nil {
+		return nil, &object.PoisonedError{Cause: poisoned}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			ierr := object.NewInternalError(r)
+			env.Poison(ierr)
+			metrics.Errors.Inc()
+			logging.Debug("evaluator: panic", "err", ierr, "stack", string(ierr.Stack))
+			result, err = nil, ierr
+		}
+	}()
+	return Eval(node, env), nil
+}
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// 文
+	case *ast.Program:
+		return evalProgram(node, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+	case *ast.ReturnStatement:
+		val := Eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+		if tracer != nil {
+			tracer.Set(node.Name.Value, val)
+		}
+	case *ast.AssignStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if !env.Assign(node.Name.Value, val) {
+			// 組み込み関数には代入できないので、候補は束縛された名前だけ
+			return newError("identifier not found: %s%s", node.Name.Value, didYouMean(env, node.Name.Value, env.VisibleNames()))
+		}
+		if tracer != nil {
+			tracer.Set(node.Name.Value, val)
+		}
+
+	// 式
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right, env)
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator, left, right, env)
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+	case *ast.WhileExpression:
+		return evalWhileExpression(node, env)
+	case *ast.FunctionLiteral:
+		params := node.Parameters
+		body := node.Body
+		env.Capture()
+		return &object.Function{Parameters: params, Env: env, Body: body, Deprecated: node.Deprecated, Doc: node.Doc}
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments to quote: want=1, got=%d", len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		if fn, ok := function.(*object.Function); ok {
+			if fn.Deprecated != "" {
+				warnDeprecated(node, fn.Deprecated)
+			}
+			return callFunction(fn, node.Arguments, env)
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		if positioned(node, function, env) {
+			args = append(args, object.CallPosition(node))
+		}
+		return applyFunction(function, args)
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+	}
+
+	return nil
+}
+
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	metrics.Evaluations.Inc()
+	metrics.Active.Inc()
+	defer metrics.Active.Dec()
+
+	for _, statement := range program.Statements {
+		result = evalStatement(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			metrics.Errors.Inc()
+			logging.Debug("evaluator: runtime error", "msg", result.Message)
+			attachEnvironment(result, env)
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalBlockStatement は ReturnValue を剥がさずに返すので、
+// 入れ子になったブロックの外側まで return が伝播する
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = evalStatement(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				if err, ok := result.(*object.Error); ok {
+					attachEnvironment(err, env)
+				}
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// attachEnvironment はエラーが最初に通ったブロックの環境、つまり失敗した関数呼び出しの環境を err に残す。
+// 呼び出しが終わっても使い回されないよう、環境は Capture しておく
+func attachEnvironment(err *object.Error, env *object.Environment) {
+	if err.Env != nil {
+		return
+	}
+	env.Capture()
+	err.Env = env
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	// 本の Monkey と同じ振る舞いにしているときは、本にない組み込み関数は未定義として扱う
+	if !env.Compat().BuiltinAvailable(node.Value) {
+		return newError("identifier not found: %s", node.Value)
+	}
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
+		return builtin
+	}
+	if builtin, ok := builtins[node.Value]; ok {
+		return builtin
+	}
+	if newBuiltin, ok := envBuiltins[node.Value]; ok {
+		env.Capture()
+		return newBuiltin(env)
+	}
+	if node.Value == "eval" && AllowEval {
+		env.Capture()
+		return newEvalBuiltin(env)
+	}
+	if node.Value == "evalAst" && AllowEval {
+		env.Capture()
+		return newEvalAstBuiltin(env)
+	}
+	if node.Value == "eval" || node.Value == "evalAst" {
+		logging.Debug("evaluator: builtin disabled", "name", node.Value, "hint", "set AllowEval")
+	}
+	return newError("identifier not found: %s%s", node.Value, didYouMean(env, node.Value, visibleNames(env)))
+}
+
+// positioned は call が Positioned な組み込み関数を名前で直接呼ぶかどうかを返す。
+// コンパイラと同じく、変数に入れた組み込み関数の呼び出しには位置を渡さない
+func positioned(call *ast.CallExpression, function object.Object, env *object.Environment) bool {
+	builtin, ok := function.(*object.Builtin)
+	if !ok || !builtin.Positioned {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return false
+	}
+	_, bound := env.Get(ident.Value)
+	return !bound
+}
+
+// didYouMean は env が候補を付ける設定なら diag.DidYouMean の文を返す
+func didYouMean(env *object.Environment, name string, candidates []string) string {
+	if !env.Compat().Suggestions() {
+		return ""
+	}
+	return diag.DidYouMean(name, candidates)
+}
+
+// visibleNames は env から見える名前と、評価器で使える全ての組み込み関数の名前を返す
+func visibleNames(env *object.Environment) []string {
+	names := env.VisibleNames()
+	for _, def := range object.Builtins {
+		names = append(names, def.Name)
+	}
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range envBuiltins {
+		names = append(names, name)
+	}
+	if AllowEval {
+		names = append(names, "eval", "evalAst")
+	}
+	return names
+}
+
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	result := make([]object.Object, 0, len(exps))
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// argsPool は関数呼び出しの引数のスライスを使い回すためのプール
+var argsPool = sync.Pool{
+	New: func() interface{} { return new([]object.Object) },
+}
+
+// callFunction は引数を評価して fn を呼び出す。引数は呼び出し先の環境に写されるので、
+// スライスは呼び出しが終われば次の呼び出しで使い回せる
+func callFunction(fn *object.Function, exps []ast.Expression, env *object.Environment) object.Object {
+	buf := argsPool.Get().(*[]object.Object)
+	defer func() {
+		for i := range *buf {
+			(*buf)[i] = nil
+		}
+		*buf = (*buf)[:0]
+		argsPool.Put(buf)
+	}()
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return evaluated
+		}
+		*buf = append(*buf, evaluated)
+	}
+	return applyFunction(fn, *buf)
+}
+
+func applyFunction(fn object.Object, args []object.Object) object.Object {
+	switch fn := fn.(type) {
+	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d",
+				len(fn.Parameters), len(args))
+		}
+		// 止まらない再帰で Go のスタックを使い切らないよう、VM と同じ深さで止める
+		if !fn.Env.EnterCall(MaxCallDepth) {
+			return newError("stack overflow: more than %d nested calls", MaxCallDepth)
+		}
+		extendedEnv := extendFunctionEnv(fn, args)
+		evaluated := Eval(fn.Body, extendedEnv)
+		fn.Env.LeaveCall()
+		// 本体でクロージャを作っていなければ、環境は次の呼び出しで使い回せる
+		extendedEnv.Release()
+		return unwrapReturnValue(evaluated)
+	case *object.Builtin:
+		if result := fn.Fn(args...); result != nil {
+			return result
+		}
+		return NULL
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+// extendFunctionEnv は関数が定義された環境を外側に持つ環境を作り、引数を束縛する
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+
+	for paramIdx, param := range fn.Parameters {
+		env.Set(param.Value, args[paramIdx])
+	}
+
+	return env
+}
+
+// unwrapReturnValue は return が呼び出し元の関数まで突き抜けないように ReturnValue を剥がす
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	if obj == nil {
+		return NULL
+	}
+	return obj
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	// 書いた順に評価し、同じキーは後のものが勝つ
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		hashed := hashKey.HashKey()
+		pairs[hashed] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if idx < 0 || idx > max {
+		return NULL
+	}
+
+	return arrayObject.Elements[idx]
+}
+
+func evalPrefixExpression(operator string, right object.Object, env *object.Environment) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right, env)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalBangOperatorExpression(right object.Object) object.Object {
+	switch right {
+	case TRUE:
+		return FALSE
+	case FALSE:
+		return TRUE
+	case NULL:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
+
+func evalMinusPrefixOperatorExpression(right object.Object, env *object.Environment) object.Object {
+	negated, err := object.Negate(right, env.Compat())
+	if err != nil {
+		return newError("%s", err)
+	}
+	return negated
+}
+
+func evalInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
+	switch {
+	case object.IsNumericPair(left, right):
+		return evalNumericInfixExpression(operator, left, right, env)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	case operator == "==":
+		return nativeBoolToBooleanObject(object.Equal(left, right))
+	case operator == "!=":
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
+	}
+
+	// 埋め込む側の型は object.Ordered を実装していれば < と > で比べられる
+	if c, ok := object.Compare(left, right); ok && (operator == "<" || operator == ">") {
+		return nativeBoolToBooleanObject(operator == "<" && c < 0 || operator == ">" && c > 0)
+	}
+	if left.Type() != right.Type() {
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// evalNumericInfixExpression は数の組の演算を object の規則で計算する。
+// 型の昇格 (整数から浮動小数点数や decimal へ) は object.Arith と object.CompareNumbers が行う
+func evalNumericInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
+	switch operator {
+	case "<", ">", "==", "!=":
+		result, err := object.CompareNumbers(operator, left, right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return nativeBoolToBooleanObject(result)
+	default:
+		result, err := object.Arith(operator, left, right, env.Compat())
+		if err != nil {
+			return newError("%s", err)
+		}
+		return result
+	}
+}
+
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return Eval(ie.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+func evalWhileExpression(we *ast.WhileExpression, env *object.Environment) object.Object {
+	for {
+		condition := Eval(we.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		result := Eval(we.Body, env)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return object.NewError(format, a...)
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
@@ -0,0 +1,1326 @@
+package evaluator
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/metrics"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/parser"
+)
+
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"--10", 10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"9; return -2; 9;", -2},
+		{"let a = 5; return a; 9;", 5},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`, 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = -5; a;", -5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let a = 5; let b = -a; let c = -b; c;", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAssignStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 5; a = 10; a;", 10},
+		{"let a = 5; a = a * 2 + 1; a;", 11},
+		{"let a = 1; let f = fn() { a = a + 1; }; f(); f(); a;", 3},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1; n } }; let c = counter(); c(); c();", 2},
+		{"let a = 1; let f = fn(a) { a = 5; a }; f(2) + a;", 6},
+		{"b = 1;", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestWhileExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { i = i + 1; }; i;", 10},
+		{"let i = 0; let sum = 0; while (i < 100000) { i = i + 1; sum = sum + i; }; sum;", 5000050000},
+		{"while (false) { 1 }", nil},
+		{"let f = fn() { let i = 0; while (true) { if (i == 3) { return i; } i = i + 1; } }; f();", 3},
+		{"while (1 + true) { 1 }", "type mismatch: INTEGER + BOOLEAN"},
+		{"let i = 0; while (i < 1) { i = i + x; }", "identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestErrorEnvironment(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		expected int64
+	}{
+		{"let x = 1; x + true;", "x", 1},
+		{"let f = fn(a) { let b = a * 2; b + true }; let a = 100; f(3);", "b", 6},
+		{"let f = fn(a) { if (a > 0) { a + true } }; f(4);", "a", 4},
+		// 失敗した呼び出しの環境は後の呼び出しで使い回されない
+		{"let f = fn(a) { let g = fn(x) { x }; g(a + 1); a + true }; f(7);", "a", 7},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("%q: no error object returned", tt.input)
+		}
+		if errObj.Env == nil {
+			t.Fatalf("%q: error has no environment", tt.input)
+		}
+		val, ok := errObj.Env.Get(tt.name)
+		if !ok {
+			t.Fatalf("%q: %s is not bound in the error environment", tt.input, tt.name)
+		}
+		testIntegerObject(t, val, tt.expected)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		input      string
+		statements int64
+		errors     int64
+	}{
+		{"let x = 1; x + 2;", 2, 0},
+		{"let f = fn(a) { let b = a; b }; f(1); f(2);", 7, 0},
+		{"1; true + 1; 3;", 2, 1},
+	}
+
+	for _, tt := range tests {
+		evaluations, statements, errors := metrics.Evaluations.Value(), metrics.Statements.Value(), metrics.Errors.Value()
+		testEval(tt.input)
+
+		if got := metrics.Evaluations.Value() - evaluations; got != 1 {
+			t.Errorf("%q: wrong evaluations. want=1, got=%d", tt.input, got)
+		}
+		if got := metrics.Statements.Value() - statements; got != tt.statements {
+			t.Errorf("%q: wrong statements. want=%d, got=%d", tt.input, tt.statements, got)
+		}
+		if got := metrics.Errors.Value() - errors; got != tt.errors {
+			t.Errorf("%q: wrong errors. want=%d, got=%d", tt.input, tt.errors, got)
+		}
+		if active := metrics.Active.Value(); active != 0 {
+			t.Errorf("%q: %d interpreters still active", tt.input, active)
+		}
+	}
+}
+
+func TestCallDepthIsRestored(t *testing.T) {
+	env := object.NewEnvironment()
+	eval := func(input string) object.Object {
+		return Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+
+	// 上限で止まった後も、同じ環境でまた深く呼び出せる
+	for i := 0; i < 2; i++ {
+		if got := eval("let f = fn(n) { f(n + 1) }; f(0)").Inspect(); got != "ERROR: stack overflow: more than 1024 nested calls" {
+			t.Fatalf("run %d: got=%q", i, got)
+		}
+		if got := eval("let g = fn(n) { if (n == 0) { 0 } else { 1 + g(n - 1) } }; g(1000)").Inspect(); got != "1000" {
+			t.Fatalf("run %d: got=%q", i, got)
+		}
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"5; -true; 5;", "unknown operator: -BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		// 打ち間違いには近い名前を添える。外側の環境と組み込み関数も候補になる
+		{"let length = 1; lenght", "identifier not found: lenght; did you mean 'length'?"},
+		{"let total = 1; let f = fn(n) { n + totl }; f(1)", "identifier not found: totl; did you mean 'total'?"},
+		{"let count = 0; cuont = 1;", "identifier not found: cuont; did you mean 'count'?"},
+		{"ptus(1)", "identifier not found: ptus; did you mean 'puts'?"},
+		{"fn(x) { x }()", "wrong number of arguments: want=1, got=0"},
+		// 止まらない再帰は Go のスタックを使い切る前に止める
+		{"let f = fn(n) { f(n + 1) }; f(0)", "stack overflow: more than 1024 nested calls"},
+		{"let f = fn() { 1 + true }; f(); 5", "type mismatch: INTEGER + BOOLEAN"},
+		{"let a = -false; a;", "unknown operator: -BOOLEAN"},
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"10 / (5 - 5)", "division by zero: 10 / 0"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"Hello" + 1`, "type mismatch: STRING + INTEGER"},
+		{`-"Hello"`, "unknown operator: -STRING"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{"5(1)", "not a function: INTEGER"},
+		{`decimal("1.2.3")`, `invalid decimal literal: "1.2.3"`},
+		{`decimal("abc")`, `invalid decimal literal: "abc"`},
+		{`decimal("1e5")`, `invalid decimal literal: "1e5"`},
+		{`decimal(true)`, "argument to `decimal` not supported, got BOOLEAN"},
+		{`decimal("1") / decimal("0.00")`, "division by zero: 1 / 0.00"},
+		{`decimal("1") + "a"`, "type mismatch: DECIMAL + STRING"},
+		{`{"name": "Monkey"}[[1]];`, "unusable as hash key: ARRAY"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`, "unknown operator: BOOLEAN + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let f = fn() { return 1; 2 }; f() + 10", 11},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let adder = fn(x) { fn(y) { x + y } }; let addTwo = adder(2); addTwo(3);", 5},
+		{"let x = 10; let f = fn() { x }; let g = fn(x) { f() }; g(1);", 10},
+		{"let apply = fn(f, x) { f(x) }; apply(fn(n) { n * n }, 7);", 49},
+		{`
+		let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+		fact(10);`, 3628800},
+		{`
+		let map = fn(arr, f) {
+			let iter = fn(arr, acc) {
+				if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) }
+			};
+			iter(arr, []);
+		};
+		let r = map([1, 2, 3], fn(x) { x * 10 });
+		r[0] + r[1] + r[2];`, 60},
+		// 捕まえられた環境は、後の呼び出しで使い回されない
+		{"let make = fn(x) { fn() { x } }; let a = make(1); let b = make(2); let id = fn(y) { y }; id(3); id(4); a() + b();", 3},
+		{"let outer = fn(x) { let g = fn() { x }; g }; let h = outer(5); let id = fn(y) { y }; id(6); h();", 5},
+		{"let outer = fn(x) { let inner = fn(y) { fn() { x + y } }; inner(1) }; let h = outer(10); let id = fn(z) { z }; id(20); h();", 11},
+		{"let f = fn(a) { bindings }; let b = f(1); let id = fn(z) { z }; id(2); len(b());", 1},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!\n"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "Hello World!\n" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`let s = "x"; s == "x"`, true},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"ab" > "a"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`let a = [1]; push(a, 2); a`, []int{1}},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`let a = [2, 1]; sort(a); a`, []int{2, 1}},
+		{`sort([1, "a"])`, "type mismatch: STRING < INTEGER"},
+		{`sort([[1], [2]])`, "unknown operator: ARRAY < ARRAY"},
+		{`sort(1)`, "argument to `sort` must be ITERABLE, got INTEGER"},
+		{`len(sort("cab"))`, 3},
+		{`parseInt("42")`, 42},
+		{`parseInt("-17")`, -17},
+		{`parseInt("ff", 16)`, 255},
+		{`parseInt("0x1f", 0)`, 31},
+		{`parseInt("101", 2)`, 5},
+		{`parseInt("12a")`, `could not parse "12a" as integer in base 10`},
+		{`parseInt("99999999999999999999")`, `could not parse "99999999999999999999" as integer in base 10`},
+		{`parseInt("1", 1)`, "invalid base for `parseInt`: 1"},
+		{`parseInt(1)`, "argument to `parseInt` must be STRING, got INTEGER"},
+		{`parseInt("1", "2")`, "base for `parseInt` must be INTEGER, got STRING"},
+		{`parseInt()`, "wrong number of arguments. got=0, want=1 or 2"},
+		{`assert(1 < 2, "math works")`, nil},
+		{`assert(1 > 2)`, "assertion failed at 1:1"},
+		{`assert(false, "x must be positive")`, "assertion failed at 1:1: x must be positive"},
+		{`require(len([]) > 0, "need items")`, "precondition failed at 1:1: need items"},
+		{`ensure(true)`, nil},
+		{`ensure(null_value_missing)`, "identifier not found: null_value_missing"},
+		{`ensure(false, "result sorted")`, "postcondition failed at 1:1: result sorted"},
+		{`assert(false, 1)`, "message for `assert` must be STRING, got INTEGER"},
+		{`assert()`, "wrong number of arguments. got=0, want=1 or 2"},
+		{`assert(false); 1`, "assertion failed at 1:1"},
+		{"let x = 0;\n  assert(x > 0)", "assertion failed at 2:3"},
+		{`let check = assert; check(false)`, "assertion failed"},
+		{`semverCompare("1.2.0", "1.10.0")`, -1},
+		{`semverCompare("v2.0.0", "2.0.0")`, 0},
+		{`semverCompare("1.0.0+build.5", "1.0.0")`, 0},
+		{`semverCompare("1.0.0", "1.0.0-rc.1")`, 1},
+		{`semverCompare("1.0.0-alpha", "1.0.0-alpha.1")`, -1},
+		{`semverCompare("1.0.0-alpha.1", "1.0.0-alpha.beta")`, -1},
+		{`semverCompare("1.0.0-beta.11", "1.0.0-beta.2")`, 1},
+		{`semverCompare("1.0.0-rc.1", "1.0.0-beta.11")`, 1},
+		{`semverCompare("1.2", "1.2.0")`, "invalid semantic version for `semverCompare`: \"1.2\""},
+		{`semverCompare("01.2.0", "1.2.0")`, "invalid semantic version for `semverCompare`: \"01.2.0\""},
+		{`semverCompare("1.2.0", 1)`, "argument to `semverCompare` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(array.Elements))
+				continue
+			}
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		}
+	}
+}
+
+// version は埋め込む側が定義する、Comparable と Ordered を実装した型の例
+type version struct{ major, minor int64 }
+
+func (v *version) Type() object.ObjectType { return "VERSION" }
+func (v *version) Inspect() string         { return "version" }
+
+func (v *version) Equal(other object.Object) bool {
+	o, ok := other.(*version)
+	return ok && *v == *o
+}
+
+func (v *version) Compare(other object.Object) (int, bool) {
+	o, ok := other.(*version)
+	if !ok {
+		return 0, false
+	}
+	if v.major != o.major {
+		return int(v.major - o.major), true
+	}
+	return int(v.minor - o.minor), true
+}
+
+func TestHostOrderedType(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"old == version(1, 2)", true},
+		{"old != new", true},
+		{"old < new", true},
+		{"new > old", true},
+		{"old > new", false},
+		{"first(sort([new, old])) == old", true},
+		{"old < 1", "type mismatch: VERSION < INTEGER"},
+		{"old + new", "unknown operator: VERSION + VERSION"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("old", &version{1, 2})
+		env.Set("new", &version{1, 10})
+		env.Set("version", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			return &version{args[0].(*object.Integer).Value, args[1].(*object.Integer).Value}
+		}})
+		p := parser.New(lexer.New(tt.input))
+		evaluated := Eval(p.ParseProgram(), env)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestDeprecationHandler(t *testing.T) {
+	var warnings []string
+	SetDeprecationHandler(func(call *ast.CallExpression, reason string) {
+		warnings = append(warnings, fmt.Sprintf("%d: %s: %s", call.Token.Line, call.Function.String(), reason))
+	})
+	defer SetDeprecationHandler(nil)
+
+	input := `// @deprecated "use add2"
+let add = fn(a, b) { a + b };
+let plus = fn(a, b) { a + b };
+let i = 0;
+while (i < 3) { add(i, 1); plus(i, 1); i = i + 1; }
+add(1, 2)`
+	testIntegerObject(t, testEval(input), 3)
+
+	// ループの中の呼び出しは1度だけ警告する
+	expected := []string{"5: add: use add2", "6: add: use add2"}
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong warnings. want=%q, got=%q", expected, warnings)
+	}
+}
+
+func TestBookCompatible(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 本にない組み込み関数は未定義になり、候補の名前も付けない
+		{"sort([2, 1])", "identifier not found: sort"},
+		{"ptus(1)", "identifier not found: ptus"},
+		{"let sort = fn(a) { a }; len(sort([2, 1]))", "2"},
+		{"first(push(rest([1, 2]), 3))", "2"},
+		// 整数のあふれは int64 で折り返す
+		{"9223372036854775807 + 1", "-9223372036854775808"},
+		{"let m = -9223372036854775807 - 1; -m", "-9223372036854775808"},
+	}
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetCompat(object.CompatBook)
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// 設定していない環境ではいつも通り
+	if got := testEval("sort([2, 1])").Inspect(); got != "[1, 2]" {
+		t.Errorf("sort without compat: got=%q", got)
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	RegisterBuiltin("hostDouble", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+
+	var exitCode int
+	object.Exit = func(code int) { exitCode = code }
+	defer func() { object.Exit = os.Exit }()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"hostDouble(21)", "42"},
+		{"let hostDouble = fn(x) { x }; hostDouble(21)", "21"},
+		{"type(1)", "INTEGER"},
+		{`type("a")`, "STRING"},
+		{"type(fn() {})", "FUNCTION"},
+		{"exit(3)", "null"},
+		{`exit("a")`, "ERROR: argument to `exit` must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	if exitCode != 3 {
+		t.Errorf("exit was not called with 3. got=%d", exitCode)
+	}
+}
+
+func TestEvalBuiltin(t *testing.T) {
+	if err, ok := testEval(`eval("1")`).(*object.Error); !ok ||
+		err.Message != "identifier not found: eval" {
+		t.Fatalf("eval should be disabled by default. got=%+v", err)
+	}
+
+	AllowEval = true
+	defer func() { AllowEval = false }()
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`eval("1 + 2")`, 3},
+		{`let x = 5; eval("x * 2")`, 10},
+		{`eval("let y = 7"); y`, 7},
+		{`let x = 5; eval("x", "current")`, 5},
+		{`let x = 5; eval("x", "isolated")`, "identifier not found: x"},
+		{`eval("let z = 1", "isolated"); z`, "identifier not found: z"},
+		{`eval("return 4; 5")`, 4},
+		{`eval("1 +")`, "eval: parse error at 1:4: no prefix parse function for EOF found"},
+		{`eval(1)`, "argument to `eval` must be STRING, got INTEGER"},
+		{`eval("1", "global")`, `unknown environment option for ` + "`eval`" + `: "global"`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestAstBuiltins(t *testing.T) {
+	AllowEval = true
+	defer func() { AllowEval = false }()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`parse("1 + x")["statements"][0]["expression"]["operator"]`, "+"},
+		{`parse("1 + x")["statements"][0]["expression"]["right"]["value"]`, "x"},
+		{`parse("let f = fn(a, b) { a }")["statements"][0]["value"]["parameters"]`, "[a, b]"},
+		{`parse("if (x) { 1 }")["statements"][0]["expression"]["alternative"]`, "null"},
+		{`parse("1 +")`, "ERROR: parse: parse error at 1:4: no prefix parse function for EOF found"},
+		{`evalAst(parse("1 + 2 * 3"))`, "7"},
+		{`let x = 10; evalAst(parse("x * 2"))`, "20"},
+		{`evalAst(parse("let y = 5")); y`, "5"},
+		{`evalAst(parse("let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(5)"))`, "120"},
+		{`evalAst(parse("[1, {\"a\": 2}][1][\"a\"]"))`, "2"},
+		{`evalAst(parse("return 3; 4"))`, "3"},
+		{`evalAst(parse("let i = 0; while (i < 3) { i = i + 1 }; i"))`, "3"},
+		{`parse("x = 1")["statements"][0]["type"]`, "AssignStatement"},
+		{`
+		let swap = fn(node) {
+			{"type": "InfixExpression", "operator": node["operator"],
+			 "left": node["right"], "right": node["left"]}
+		};
+		evalAst(swap(parse("10 - 4")["statements"][0]["expression"]))`, "-6"},
+		{`evalAst({"type": "IntegerLiteral", "value": 42})`, "42"},
+		{`evalAst({"type": "InfixExpression", "operator": "+"})`, `ERROR: evalAst: missing field "left" in InfixExpression`},
+		{`evalAst({"type": "Loop"})`, "ERROR: evalAst: unknown AST node type: Loop"},
+		{`evalAst(1)`, "ERROR: evalAst: AST node must be HASH, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBindingBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"bindings()", "[]"},
+		{"let b = 1; let a = 2; bindings()", "[a, b]"},
+		{"let g = 1; let f = fn(x) { let y = 2; bindings() }; f(0)", "[x, y]"},
+		{"let g = 1; let f = fn(x) { globalBindings() }; f(0)", "[f, g]"},
+		{"let a = 1; deleteBinding(\"a\")", "true"},
+		{"deleteBinding(\"missing\")", "false"},
+		{"let a = 1; deleteBinding(\"a\"); a", "ERROR: identifier not found: a"},
+		{"let a = 1; let f = fn() { deleteBinding(\"a\") }; f(); a", "1"},
+		{"deleteBinding(1)", "ERROR: argument to `deleteBinding` must be STRING, got INTEGER"},
+		{"let bindings = 5; bindings", "5"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`decimal("1.10")`, "1.10"},
+		{`decimal("-0.05")`, "-0.05"},
+		{`decimal(".5")`, "0.5"},
+		{`decimal(3)`, "3"},
+		{`decimal("0.1") + decimal("0.2")`, "0.3"},
+		{`decimal("1.10") + decimal("2.205")`, "3.305"},
+		{`decimal("10.00") - decimal("0.01")`, "9.99"},
+		{`decimal("1.5") * decimal("1.5")`, "2.25"},
+		{`decimal("19.99") * 3`, "59.97"},
+		{`2 - decimal("0.5")`, "1.5"},
+		{`-decimal("1.25")`, "-1.25"},
+		{`decimal("10.00") / 4`, "2.50"},
+		{`decimal("1") / decimal("3")`, "0.3333333333333333"},
+		{`decimal("2") / decimal("3")`, "0.6666666666666667"},
+		{`decimal("-2") / decimal("3")`, "-0.6666666666666667"},
+		{`decimal("0.0000000000000005") / 2`, "0.0000000000000002"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		d, ok := evaluated.(*object.Decimal)
+		if !ok {
+			t.Errorf("%s: object is not Decimal. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if d.Inspect() != tt.expected {
+			t.Errorf("%s: wrong value. want=%s, got=%s", tt.input, tt.expected, d.Inspect())
+		}
+	}
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5", "1.5"},
+		{"2.0", "2.0"},
+		{"-0.25", "-0.25"},
+		{"1.5 + 2.25", "3.75"},
+		{"1 + 0.5", "1.5"},
+		{"0.5 * 4", "2.0"},
+		{"7 / 2.0", "3.5"},
+		{"7 / 2", "3"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"1.5 < 2", "true"},
+		{"2 > 2.5", "false"},
+		{"2 == 2.0", "true"},
+		{"0.5 != 0.5", "false"},
+		{"1.0 / 0", "ERROR: division by zero: 1.0 / 0"},
+		{`1.5 + "a"`, "ERROR: type mismatch: FLOAT + STRING"},
+		{`1.5 + decimal("1")`, "ERROR: type mismatch: FLOAT + DECIMAL"},
+		{"float(3)", "3.0"},
+		{`float("2.5")`, "2.5"},
+		{`float(decimal("0.1"))`, "0.1"},
+		{`float("x")`, `ERROR: could not parse "x" as float`},
+		{"int(3.99)", "3"},
+		{"int(-3.99)", "-3"},
+		{`int("42")`, "42"},
+		{"int(10000000000.0 * 10000000000.0)", "ERROR: float 1e+20 out of integer range"},
+		{"int(true)", "ERROR: argument to `int` not supported, got BOOLEAN"},
+		{"decimal(0.1) + decimal(0.2)", "0.3"},
+		{"{1.5: 1}", "ERROR: unusable as hash key: FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDecimalComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`decimal("1.10") == decimal("1.1")`, true},
+		{`decimal("0.1") + decimal("0.2") == decimal("0.3")`, true},
+		{`decimal("1.10") != decimal("1.1")`, false},
+		{`decimal("1.01") > decimal("1.001")`, true},
+		{`decimal("-1") < 0`, true},
+		{`5 == decimal("5.000")`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`len({})`, 0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4);
+		quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+		{`quote(f(unquote(1.5), unquote("s"), unquote([1, 2])))`, `f(1.5, s, [1, 2])`},
+		{`quote(unquote(fn() { 1 }))`, `unquote(fn() 1)`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+		}
+		if quote.Node == nil {
+			t.Fatalf("quote.Node is nil")
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+let number = 1;
+let function = fn(x, y) { x + y };
+let mymacro = macro(x, y) { x + y; };
+`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d", len(program.Statements))
+	}
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameters wrong. got=%v", macro.Parameters)
+	}
+	if macro.Body.String() != "(x + y)" {
+		t.Fatalf("body is not %q. got=%q", "(x + y)", macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); }; infixExpression();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); }; reverse(2 + 2, 10 - 5);`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+let unless = macro(condition, consequence, alternative) {
+	quote(if (!(unquote(condition))) {
+		unquote(consequence);
+	} else {
+		unquote(alternative);
+	});
+};
+unless(10 > 5, puts("not greater"), puts("greater"));
+`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`let double = macro(x) { quote(unquote(x) * 2) }; double(a); double(b);`,
+			`(a * 2); (b * 2)`,
+		},
+		{
+			`let twice = macro(x) { quote([unquote(x), unquote(x)]) }; f(twice(1 + 1));`,
+			`f([1 + 1, 1 + 1])`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("%q: ExpandMacros error: %s", tt.input, err)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacroErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro(x) { 1 }; m(2);`, "macro m must return a QUOTE, got INTEGER"},
+		{`let m = macro(x) { x + 1 }; m(2);`, "macro m: type mismatch: QUOTE + INTEGER"},
+		{`let m = macro(x) { quote(x) }; m(1, 2);`, "wrong number of arguments to macro m: want=1, got=2"},
+		{`let m = macro() { let a = 1; }; m();`, "macro m must return a QUOTE, got NULL"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("%q: expected error, got nil", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+// BenchmarkCalls は関数呼び出しごとの割り当てを測る
+func BenchmarkCalls(b *testing.B) {
+	benchmarks := []struct {
+		name  string
+		input string
+	}{
+		{"recursion", "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(500);"},
+		{"loop", "let id = fn(x) { x }; let i = 0; while (i < 1000) { id(i); i = i + 1; };"},
+	}
+
+	for _, bm := range benchmarks {
+		program := parser.New(lexer.New(bm.input)).ParseProgram()
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Eval(program, object.NewEnvironment())
+			}
+		})
+	}
+}
+
+func TestSafeEval(t *testing.T) {
+	RegisterBuiltin("hostPanic", func(args ...object.Object) object.Object {
+		var m map[string]int
+		m["x"] = 1
+		return nil
+	})
+
+	parse := func(input string) *ast.Program {
+		return parser.New(lexer.New(input)).ParseProgram()
+	}
+
+	env := object.NewEnvironment()
+	result, err := SafeEval(parse(`let x = 1; hostPanic()`), env)
+	ierr, ok := err.(*object.InternalError)
+	if !ok {
+		t.Fatalf("expected *object.InternalError. got=%T (%v), result=%v", err, err, result)
+	}
+	if ierr.Error() != "internal error: assignment to entry in nil map" {
+		t.Errorf("wrong message: %q", ierr.Error())
+	}
+	if !strings.Contains(string(ierr.Stack), "TestSafeEval") {
+		t.Errorf("stack does not contain the panicking function:\n%s", ierr.Stack)
+	}
+
+	// 一度 panic した環境では評価しない
+	_, err = SafeEval(parse(`x`), env)
+	if perr, ok := err.(*object.PoisonedError); !ok || perr.Cause != ierr {
+		t.Errorf("expected *object.PoisonedError. got=%T (%v)", err, err)
+	}
+
+	// 普通の実行時エラーは結果の Error として返す
+	result, err = SafeEval(parse(`1 + true`), object.NewEnvironment())
+	if err != nil || result.Inspect() != "ERROR: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong result for a runtime error: %v, %v", result, err)
+	}
+}
@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/token"
+)
+
+// quote は node を評価せずに Quote に包む。中の unquote(...) だけはその場で評価して埋め込む。
+// node はマクロ本体の一部なので、書き換えはコピーに対して行う
+func quote(node ast.Node, env *object.Environment) object.Object {
+	node = evalUnquoteCalls(ast.Copy(node), env)
+	return &object.Quote{Node: node}
+}
+
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
+	return ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if !isUnquoteCall(node) {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			return node
+		}
+
+		unquoted := Eval(call.Arguments[0], env)
+		if converted := convertObjectToASTNode(unquoted); converted != nil {
+			return converted
+		}
+		// ソースに戻せない値なら unquote の呼び出しをそのまま残す
+		return node
+	})
+}
+
+func isUnquoteCall(node ast.Node) bool {
+	callExpression, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	return callExpression.Function.TokenLiteral() == "unquote"
+}
+
+// convertObjectToASTNode は unquote の結果をソースに書けるノードに戻す。戻せない値は nil になる
+func convertObjectToASTNode(obj object.Object) ast.Node {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: fmt.Sprintf("%d", obj.Value),
+		}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+	case *object.Float:
+		t := token.Token{
+			Type:    token.FLOAT,
+			Literal: strconv.FormatFloat(obj.Value, 'f', -1, 64),
+		}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}
+	case *object.Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}
+	case *object.Array:
+		elements := make([]ast.Expression, len(obj.Elements))
+		for i, el := range obj.Elements {
+			node, ok := convertObjectToASTNode(el).(ast.Expression)
+			if !ok {
+				return nil
+			}
+			elements[i] = node
+		}
+		return &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Elements: elements}
+	case *object.Quote:
+		return obj.Node
+	default:
+		return nil
+	}
+}
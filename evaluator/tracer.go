@@ -0,0 +1,36 @@
+package evaluator
+
+import (
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/metrics"
+	"github.com/kurarrr/monkey/object"
+)
+
+// Tracer は評価の途中経過を受け取る。実行の記録 (monkey run --trace) に使う
+type Tracer interface {
+	// Enter は文を評価する直前、Leave は評価し終えた直後に呼ばれる。関数呼び出しがあれば入れ子になる
+	Enter(s ast.Statement)
+	Leave(s ast.Statement)
+	// Set は let や代入で name に val が入った直後に呼ばれる
+	Set(name string, val object.Object)
+}
+
+// tracer が nil でなければ、評価器は文ごとに呼び出す
+var tracer Tracer
+
+// SetTracer は以降の評価で使う Tracer を設定する。nil で記録をやめる
+func SetTracer(t Tracer) {
+	tracer = t
+}
+
+// evalStatement は文の数を数え、Tracer に通知しながら文を評価する
+func evalStatement(s ast.Statement, env *object.Environment) object.Object {
+	metrics.Statements.Inc()
+	if tracer == nil {
+		return Eval(s, env)
+	}
+	tracer.Enter(s)
+	result := Eval(s, env)
+	tracer.Leave(s)
+	return result
+}
@@ -1,33 +1,205 @@
 package lexer
 
-import "github.com/kurarrr/monkey/token"
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
 
+	"github.com/kurarrr/monkey/logging"
+	"github.com/kurarrr/monkey/token"
+)
+
+// Lexer は io.RuneReader から1文字ずつ読みながらトークンに分ける。
+// 入力全体をメモリに載せないので、大きなスクリプトやソケット越しの入力にも使える。
 type Lexer struct {
-	input        string
-	position     int  // 入力における現在の位置(現在の文字を指し示す)
-	readPosition int  // これから読み込む位置(現在の文字の次)
-	ch           byte // 現在検査中の文字
+	r io.RuneReader
+
+	ch     rune // 現在検査中の文字。入力の終わりでは 0
+	width  int  // ch の UTF-8 でのバイト数
+	line   int  // ch の行番号
+	column int  // ch の列番号(バイト単位)
+	offset int  // ch のバイトオフセット
+
+	file *token.File // nil でなければ読んだ行をここに記録する
+
+	peek      rune // 先読みした次の文字
+	peekWidth int
+	hasPeek   bool
+
+	err error // 読み込み中に起きた io.EOF 以外のエラー
+
+	// 最初の Mark 以降に読んだ文字。Reset の後は pos から読み直す
+	history   []readResult
+	pos       int
+	recording bool
+
+	// EmitComments が true なら、コメントを読み飛ばさずに COMMENT トークンとして返す。
+	// 整形ツールなどコメントを残したい呼び出し側のためのもの。parser はこれを有効にして
+	// @deprecated のコメントを読み、ほかのコメントは読み飛ばす。
+	EmitComments bool
 }
 
+// New は文字列を入力とする Lexer を作る
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewReader(strings.NewReader(input))
+}
+
+// NewReader は r を入力とする Lexer を作る。r が io.RuneReader でなければバッファを挟む
+func NewReader(r io.Reader) *Lexer {
+	rr, ok := r.(io.RuneReader)
+	if !ok {
+		rr = bufio.NewReader(r)
+	}
+	l := &Lexer{r: rr, line: 1, width: 1, offset: -1}
 	l.readChar()
 	return l
 }
 
+// NewFile は r を入力とし、読んだ行を file に記録する Lexer を作る。
+// file の行は読み進めた所までしか分からないので、位置を引くのは EOF まで読んでからにする
+func NewFile(file *token.File, r io.Reader) *Lexer {
+	l := NewReader(r)
+	l.file = file
+	return l
+}
+
+// Err は入力の読み込みで起きたエラーを返す。エラーが起きると以降は EOF として扱われる
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// readRune は次の文字とそのバイト数を返す。不正な UTF-8 は1バイトの utf8.RuneError になる
+func (l *Lexer) readRune() (rune, int) {
+	if l.err != nil {
+		return 0, 1
+	}
+	if l.pos < len(l.history) {
+		r := l.history[l.pos]
+		l.pos++
+		l.err = r.err
+		return r.ch, r.width
+	}
+
+	r := readResult{width: 1}
+	ch, size, err := l.r.ReadRune()
+	if err != nil {
+		if err != io.EOF {
+			r.err = err
+			logging.Debug("lexer: read failed", "line", l.line, "err", err)
+		}
+	} else {
+		r.ch, r.width = ch, size
+	}
+	if l.recording {
+		l.history = append(l.history, r)
+		l.pos++
+	}
+	l.err = r.err
+	return r.ch, r.width
+}
+
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
+	l.offset += l.width
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+		if l.file != nil {
+			l.file.AddLine(l.offset)
+		}
+	} else {
+		l.column += l.width
+	}
+	if l.hasPeek {
+		l.ch, l.width = l.peek, l.peekWidth
+		l.hasPeek = false
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, l.width = l.readRune()
+	}
+}
+
+// Tokens は src を最後の EOF までトークンに分けて返す。コメントは含まない。
+// 返した列は書き換えて parser.NewFromTokens に渡せる
+func Tokens(src string) []token.Token {
+	l := New(src)
+	var tokens []token.Token
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
 	}
-	l.position = l.readPosition
-	l.readPosition += 1
 }
 
 func (l *Lexer) NextToken() token.Token {
+	for {
+		l.skipWhitespace()
+		line, column, offset := l.line, l.column, l.offset
+
+		var tok token.Token
+		if l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+			tok = l.readComment()
+			if tok.Type == token.COMMENT && !l.EmitComments {
+				continue
+			}
+		} else {
+			tok = l.readToken()
+		}
+
+		tok.Line = line
+		tok.Column = column
+		tok.Offset = offset
+		if tok.Type == token.EOF && l.file != nil {
+			l.file.SetSize(offset)
+		}
+		if tok.Type == token.ILLEGAL {
+			logging.Debug("lexer: illegal token", "line", line, "column", column, "literal", tok.Literal)
+		}
+		return tok
+	}
+}
+
+// readComment は // から行末まで、または /* から対応する */ までを読む。
+// ブロックコメントは入れ子にできる。閉じる前に入力が終わると ILLEGAL になる。
+func (l *Lexer) readComment() token.Token {
+	var out strings.Builder
+	out.WriteRune(l.ch)
+	l.readChar()
+
+	if l.ch == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			out.WriteRune(l.ch)
+			l.readChar()
+		}
+		return token.Token{Type: token.COMMENT, Literal: out.String()}
+	}
+
+	out.WriteRune(l.ch)
+	l.readChar()
+	depth := 1
+	for depth > 0 {
+		switch {
+		case l.ch == 0:
+			return token.Token{Type: token.ILLEGAL, Literal: out.String()}
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			out.WriteString("/*")
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			out.WriteString("*/")
+			l.readChar()
+		default:
+			out.WriteRune(l.ch)
+		}
+		l.readChar()
+	}
+	return token.Token{Type: token.COMMENT, Literal: out.String()}
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
-	l.skipWhitespace()
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -59,6 +231,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.GT, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -71,6 +245,17 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case '"':
+		literal, ok := l.readString()
+		if ok {
+			tok = token.Token{Type: token.STRING, Literal: literal}
+		} else {
+			tok = token.Token{Type: token.ILLEGAL, Literal: "\"" + literal}
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -80,9 +265,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
-			return tok
+			return l.readNumber()
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
@@ -91,20 +274,56 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// readString は閉じる " までを読み、エスケープシーケンスを展開して返す。
+// 閉じる前に入力が終わった場合は ok が false になる。
+func (l *Lexer) readString() (string, bool) {
+	var out strings.Builder
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String(), true
+		case 0:
+			return out.String(), false
+		case '\\':
+			l.readChar()
+			switch l.ch {
+			case 'n':
+				out.WriteRune('\n')
+			case 't':
+				out.WriteRune('\t')
+			case '"':
+				out.WriteRune('"')
+			case '\\':
+				out.WriteRune('\\')
+			case 0:
+				return out.String(), false
+			default:
+				out.WriteRune('\\')
+				out.WriteRune(l.ch)
+			}
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
 func (l *Lexer) readIdentifier() string {
-	position := l.position
+	var out strings.Builder
 	for isLetter(l.ch) {
+		out.WriteRune(l.ch)
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return out.String()
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter は識別子に使える文字かどうかを返す。ASCII に限らず Unicode の文字を受け付ける
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -113,22 +332,34 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) readNumber() string {
-	position := l.position
+// readNumber は整数か、小数点の後に数字が続く浮動小数点数を読む
+func (l *Lexer) readNumber() token.Token {
+	var out strings.Builder
+	for isDigit(l.ch) {
+		out.WriteRune(l.ch)
+		l.readChar()
+	}
+	if l.ch != '.' || !isDigit(l.peekChar()) {
+		return token.Token{Type: token.INT, Literal: out.String()}
+	}
+
+	out.WriteRune(l.ch)
+	l.readChar()
 	for isDigit(l.ch) {
+		out.WriteRune(l.ch)
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return token.Token{Type: token.FLOAT, Literal: out.String()}
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
-		return 0
-	} else {
-		return l.input[l.readPosition]
+func (l *Lexer) peekChar() rune {
+	if !l.hasPeek {
+		l.peek, l.peekWidth = l.readRune()
+		l.hasPeek = true
 	}
+	return l.peek
 }
@@ -1,7 +1,9 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 
@@ -16,7 +18,7 @@ let add = fn(x, y) {
 	x + y;
 };
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -27,6 +29,10 @@ if (5 < 10) {
 
 10 == 10;
 10 != 9;
+"foobar"
+"foo bar"
+[1, 2];
+{"foo": "bar"}
 `
 	tests := []struct {
 		expectedType    token.TokenType
@@ -105,6 +111,19 @@ if (5 < 10) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
 
 		{token.EOF, ""},
 	}
@@ -117,3 +136,265 @@ if (5 < 10) {
 		assert.Equal(t, tok.Literal, tt.expectedLiteral, "tests[] - tokentype wrong.")
 	}
 }
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"a\nb"`, token.STRING, "a\nb"},
+		{`"tab\there"`, token.STRING, "tab\there"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"keep \q"`, token.STRING, `keep \q`},
+		{`""`, token.STRING, ""},
+		{`"unterminated`, token.ILLEGAL, `"unterminated`},
+		{`"trailing\`, token.ILLEGAL, `"trailing`},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.Type, tt.input)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal, tt.input)
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + 10;\n\n\"s\""
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.PLUS, 2, 5},
+		{token.INT, 2, 7},
+		{token.SEMICOLON, 2, 9},
+		{token.STRING, 4, 1},
+		{token.EOF, 4, 4},
+	}
+
+	l := New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.Type, "token type wrong")
+		assert.Equal(t, tt.expectedLine, tok.Line, "line wrong for %q", tok.Literal)
+		assert.Equal(t, tt.expectedColumn, tok.Column, "column wrong for %q", tok.Literal)
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "let 名前 = \"値\"; café + _x\xff"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "名前", 5},
+		{token.ASSIGN, "=", 12},
+		{token.STRING, "値", 14},
+		{token.SEMICOLON, ";", 19},
+		{token.IDENT, "café", 21},
+		{token.PLUS, "+", 27},
+		{token.IDENT, "_x", 29},
+		{token.ILLEGAL, "�", 31},
+		{token.EOF, "", 32},
+	}
+
+	l := New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.Type, "token type wrong for %q", tok.Literal)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+		assert.Equal(t, tt.expectedColumn, tok.Column, "column wrong for %q", tok.Literal)
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	// io.RuneReader でない Reader からも1バイトずつ読めること
+	l := NewReader(iotest.OneByteReader(strings.NewReader("let ä = 10;")))
+
+	expected := []string{"let", "ä", "=", "10", ";", ""}
+	for _, e := range expected {
+		tok := l.NextToken()
+		assert.Equal(t, e, tok.Literal)
+	}
+	assert.NoError(t, l.Err())
+
+	l = NewReader(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("ab"))))
+	tok := l.NextToken()
+	assert.Equal(t, token.Token{Type: token.IDENT, Literal: "a", Line: 1, Column: 1}, tok)
+	tok = l.NextToken()
+	assert.Equal(t, token.TokenType(token.EOF), tok.Type)
+	assert.Equal(t, iotest.ErrTimeout, l.Err())
+}
+
+func TestNumbers(t *testing.T) {
+	input := "5 3.14 10.0 7.x 0.5;"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "10.0"},
+		{token.INT, "7"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.FLOAT, "0.5"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.Type, "token type wrong for %q", tok.Literal)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// 先頭の行コメント
+let x = 1; // 行末のコメント
+/* ブロック
+   コメント /* 入れ子 */ まだコメント */
+x / 2;
+/* 閉じていない`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.COMMENT, "// 先頭の行コメント", 1, 1},
+		{token.LET, "let", 2, 1},
+		{token.IDENT, "x", 2, 5},
+		{token.ASSIGN, "=", 2, 7},
+		{token.INT, "1", 2, 9},
+		{token.SEMICOLON, ";", 2, 10},
+		{token.COMMENT, "// 行末のコメント", 2, 12},
+		{token.COMMENT, "/* ブロック\n   コメント /* 入れ子 */ まだコメント */", 3, 1},
+		{token.IDENT, "x", 5, 1},
+		{token.SLASH, "/", 5, 3},
+		{token.INT, "2", 5, 5},
+		{token.SEMICOLON, ";", 5, 6},
+		{token.ILLEGAL, "/* 閉じていない", 6, 1},
+		{token.EOF, "", 6, 22},
+	}
+
+	l := New(input)
+	l.EmitComments = true
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.Type, "token type wrong for %q", tok.Literal)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+		assert.Equal(t, tt.expectedLine, tok.Line, "line wrong for %q", tok.Literal)
+		assert.Equal(t, tt.expectedColumn, tok.Column, "column wrong for %q", tok.Literal)
+	}
+
+	// 既定ではコメントは読み飛ばされる
+	l = New(input)
+	for _, tt := range tests {
+		if tt.expectedType == token.COMMENT {
+			continue
+		}
+		tok := l.NextToken()
+		assert.Equal(t, tt.expectedType, tok.Type, "token type wrong for %q", tok.Literal)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tokens := Tokens("let x = 1; // コメント\nx")
+
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON, token.IDENT, token.EOF}
+	if !assert.Len(t, tokens, len(expected)) {
+		return
+	}
+	for i, tt := range expected {
+		assert.Equal(t, tt, tokens[i].Type, "token %d", i)
+	}
+	assert.Equal(t, 2, tokens[5].Line)
+	assert.Equal(t, 1, tokens[5].Column)
+
+	assert.Equal(t, []token.Token{{Type: token.EOF, Literal: "", Line: 1, Column: 1}}, Tokens(""))
+}
+
+func TestMarkReset(t *testing.T) {
+	l := New("(a, b) -> a + b; (a + b)")
+
+	var first []token.Token
+	start := l.Mark()
+	for i := 0; i < 5; i++ {
+		first = append(first, l.NextToken())
+	}
+	assert.Equal(t, ")", first[4].Literal)
+
+	// 戻ると同じトークンを同じ位置で返す
+	l.Reset(start)
+	for _, want := range first {
+		assert.Equal(t, want, l.NextToken())
+	}
+
+	// 戻った後に取った Mark にも戻れる
+	l.Reset(start)
+	l.NextToken()
+	afterParen := l.Mark()
+	assert.Equal(t, "a", l.NextToken().Literal)
+	l.Reset(afterParen)
+	assert.Equal(t, "a", l.NextToken().Literal)
+
+	// 一度も読んでいない所まで進んでから戻る
+	var rest []token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		rest = append(rest, tok)
+	}
+	assert.Equal(t, token.TokenType(token.EOF), l.NextToken().Type)
+	l.Reset(afterParen)
+	l.NextToken()
+	for _, want := range rest {
+		assert.Equal(t, want, l.NextToken())
+	}
+	eof := l.NextToken()
+	assert.Equal(t, token.TokenType(token.EOF), eof.Type)
+	assert.Equal(t, 1, eof.Line)
+	assert.Equal(t, 25, eof.Column)
+}
+
+func TestNewFile(t *testing.T) {
+	input := "let 名前 = 1;\n// コメント\n  名前 + 2;\n"
+	file := token.NewFileSet().AddFile("x.monkey", 0)
+	l := NewFile(file, strings.NewReader(input))
+
+	var tokens []token.Token
+	for tok := l.NextToken(); ; tok = l.NextToken() {
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	assert.Equal(t, len(input), file.Size())
+	for _, tok := range tokens {
+		pos := file.Position(file.Pos(tok.Offset))
+		assert.Equal(t, tok.Line, pos.Line, "line wrong for %q", tok.Literal)
+		assert.Equal(t, tok.Column, pos.Column, "column wrong for %q", tok.Literal)
+	}
+	assert.Equal(t, "x.monkey:3:3", file.Position(file.Pos(tokens[5].Offset)).String())
+}
@@ -0,0 +1,50 @@
+package lexer
+
+// Mark は Lexer のある時点の状態。Reset に渡すとその時点から読み直せる
+type Mark struct {
+	ch        rune
+	width     int
+	line      int
+	column    int
+	offset    int
+	peek      rune
+	peekWidth int
+	hasPeek   bool
+	err       error
+	pos       int
+}
+
+// readResult は入力から読んだ1文字。Reset の後に同じ結果を返せるよう、エラーも一緒に覚える
+type readResult struct {
+	ch    rune
+	width int
+	err   error
+}
+
+// Mark は今の位置を返す。ラムダ式と括弧のように、先まで読まないと決められない構文を
+// 試しに読んでから Reset で戻るためのもの。
+// 入力を読み直さずに戻れるよう、最初の Mark 以降に読んだ文字は Lexer が持ち続ける
+func (l *Lexer) Mark() Mark {
+	l.recording = true
+	return Mark{
+		ch:        l.ch,
+		width:     l.width,
+		line:      l.line,
+		column:    l.column,
+		offset:    l.offset,
+		peek:      l.peek,
+		peekWidth: l.peekWidth,
+		hasPeek:   l.hasPeek,
+		err:       l.err,
+		pos:       l.pos,
+	}
+}
+
+// Reset は m を取った位置に戻る。次の NextToken は m を取った直後と同じトークンを返す
+func (l *Lexer) Reset(m Mark) {
+	l.ch, l.width = m.ch, m.width
+	l.line, l.column, l.offset = m.line, m.column, m.offset
+	l.peek, l.peekWidth, l.hasPeek = m.peek, m.peekWidth, m.hasPeek
+	l.err = m.err
+	l.pos = m.pos
+}
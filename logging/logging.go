@@ -0,0 +1,34 @@
+// Package logging はインタプリタ内部の出来事をデバッグ用に slog.Logger へ流す。
+//
+// 字句解析器・構文解析器・評価器・コンパイラ・VM は、キャッシュに無かった定数、
+// コンパイルし直し、上限に達した呼び出しなどを Debug レベルで記録する。
+// 既定では Logger は設定されておらず、何も出力しない。
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+// SetLogger は以降の記録に使う Logger を設定する。nil で記録をやめる。
+// 複数のゴルーチンから同時に呼んでよい
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// Enabled は Debug の記録が出力されるかどうかを返す。
+// 属性を組み立てるのに手間がかかる呼び出し元は、先にこれで確かめる
+func Enabled() bool {
+	l := logger.Load()
+	return l != nil && l.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// Debug は msg と属性 args を Debug レベルで記録する。Logger が無ければ何もしない
+func Debug(msg string, args ...any) {
+	if l := logger.Load(); l != nil {
+		l.Debug(msg, args...)
+	}
+}
@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestDebug(t *testing.T) {
+	// Logger が無ければ何も起きない
+	Debug("ignored")
+	if Enabled() {
+		t.Fatalf("expected logging to be disabled by default")
+	}
+
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer SetLogger(nil)
+
+	if !Enabled() {
+		t.Fatalf("expected logging to be enabled")
+	}
+	Debug("vm: limit reached", "limit", "frames", "max", 1024)
+	if !bytes.Contains(buf.Bytes(), []byte(`level=DEBUG msg="vm: limit reached" limit=frames max=1024`)) {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	// Info 以上しか出さない Logger では無効になる
+	SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	if Enabled() {
+		t.Errorf("expected logging to be disabled at info level")
+	}
+}
@@ -1,250 +1,736 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"strconv"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/astjson"
+	"github.com/kurarrr/monkey/compiler"
+	"github.com/kurarrr/monkey/diag"
+	"github.com/kurarrr/monkey/evaluator"
 	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/logging"
+	"github.com/kurarrr/monkey/mkc"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/parser"
+	"github.com/kurarrr/monkey/printer"
+	"github.com/kurarrr/monkey/repl"
+	"github.com/kurarrr/monkey/spec"
 	"github.com/kurarrr/monkey/token"
+	"github.com/kurarrr/monkey/trace"
+	"github.com/kurarrr/monkey/usagestats"
+	"github.com/kurarrr/monkey/vm"
 )
 
-type (
-	prefixParseFn func() ast.Expression
-	infixParseFn  func(ast.Expression) ast.Expression
-)
+const usage = `usage: monkey [--engine=vm|rvm|eval] [--allow-eval]            start the REPL
+       monkey [--engine=vm|rvm|eval] [--allow-eval] -e 'expr'  evaluate expr and print the result
+       monkey [--engine=vm|rvm|eval] [--allow-eval] run FILE   run a script or a compiled .mkc file
+       monkey compile [-o OUT] [--no-source] FILE             compile FILE to bytecode (.mkc)
+       monkey fmt FILE                                        print FILE formatted
+       monkey parse [--json] FILE                             print the syntax tree of FILE
+       monkey trace view TRACE                                step through a trace recorded with --trace
+       monkey explain [CODE]                                  describe an error code such as E2003, or list them all
+       monkey spec [--engine=vm|rvm|eval] FILE...             run conformance cases (JSON) on every engine, or one
+       monkey doctor                                          check the engines and configuration, print a JSON report
 
-const (
-	_ int = iota
-	LOWEST
-	EQUALS      // ==
-	LESSGREATER // > または <
-	SUM         // +
-	PRODUCT     // *
-	PREFIX      // -X または !X
-	CALL        // myFunction(X)
-)
+--lang=en|ja selects the language of error messages. The default comes from
+LC_ALL, LC_MESSAGES or LANG.
+--dialect FILE reads keyword aliases such as {"func": "fn", "var": "let"}
+from the JSON object in FILE before parsing any script.
+The REPL first loads repl_init.mk from the current directory, if present,
+and then every --preload FILE, in order.
+A function bound with let can be marked deprecated by the line comment
+// @deprecated "reason" just before the let. With the eval engine, each call
+site of such a function prints one warning to stderr.
+--compat=book behaves like the Monkey of "Writing an Interpreter in Go", so
+the book's examples run unmodified: only the builtins len, first, last, rest,
+push and puts exist, error messages are in English without codes or
+suggestions, and the REPL reports syntax errors the way the book does.
+Extensions that valid book programs cannot observe stay available.
+--debug logs interpreter internals (syntax errors, constant pool misses,
+recompiles, limits hit) to stderr.
+If MONKEY_USAGE_FILE is set, the subcommand, engine and builtins used are
+counted in that local JSON file. Nothing is recorded otherwise, and nothing
+is ever sent anywhere.
 
-type Parser struct {
-	l *lexer.Lexer
+run and -e also accept, with the eval engine only (vm and rvm reject them):
+  --post-mortem  after a runtime error, start a REPL in the environment of
+                 the call that failed
+  --trace FILE   record every statement and variable change to FILE
+  --heap-dump-on-error
+                 after a runtime error, write the global environment and every
+                 object reachable from it as JSON to FILE.heap.json
+                 (monkey.heap.json for -e)
+`
 
-	errors []string
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
 
-	curToken  token.Token
-	peekToken token.Token
+// run はコマンドライン引数を解釈して実行し、終了コードを返す
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkey", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
 
-	prefixParseFns map[token.TokenType]prefixParseFn
-	infixParseFns  map[token.TokenType]infixParseFn
-}
+	engine := flags.String("engine", "eval", "use 'vm', 'rvm' (experimental register VM) or 'eval'")
+	allowEval := flags.Bool("allow-eval", false, "enable the eval builtin (eval engine only)")
+	postMortem := flags.Bool("post-mortem", false, "on a runtime error, start a REPL in the failing call's environment (eval engine only)")
+	heapDump := flags.Bool("heap-dump-on-error", false, "on a runtime error, dump the global environment to JSON (eval engine only)")
+	traceFile := flags.String("trace", "", "record every statement and variable change to this file (eval engine only)")
+	lang := flags.String("lang", diag.LanguageFromEnv(), "language of error messages: 'en' or 'ja'")
+	dialectFile := flags.String("dialect", "", "read keyword aliases from this JSON file")
+	compat := flags.String("compat", "", "'book' to behave like the Monkey of \"Writing an Interpreter in Go\"")
+	debug := flags.Bool("debug", false, "log interpreter internals to stderr")
+	expr := flags.String("e", "", "evaluate expr and print the result")
+	var preload stringList
+	flags.Var(&preload, "preload", "load this file before the first REPL prompt (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
 
-func New(l *lexer.Lexer) *Parser {
-	p := &Parser{
-		l:      l,
-		errors: []string{},
-	} // 初期化
+	if *engine != "eval" && *engine != "vm" && *engine != "rvm" {
+		fmt.Fprintf(stderr, "unknown engine: %s\n", *engine)
+		return 2
+	}
+	// 事後デバッグ・トレース・ヒープダンプは評価器の環境を見るので、VM では何もできない
+	if *engine != "eval" {
+		evalOnly := []struct {
+			name string
+			set  bool
+		}{
+			{"--post-mortem", *postMortem},
+			{"--trace", *traceFile != ""},
+			{"--heap-dump-on-error", *heapDump},
+		}
+		for _, f := range evalOnly {
+			if f.set {
+				fmt.Fprintf(stderr, "%s works only with --engine=eval\n", f.name)
+				return 2
+			}
+		}
+	}
+	if !supportedLanguage(*lang) {
+		fmt.Fprintf(stderr, "unknown language: %s\n", *lang)
+		return 2
+	}
+	c, err := object.ParseCompat(*compat)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	messageLang = *lang
+	compatMode = c
+	if compatMode == object.CompatBook {
+		// 本と同じエラーメッセージにするため、訳さない
+		messageLang = "en"
+	}
+	dialect = nil
+	if *dialectFile != "" {
+		d, err := readDialect(*dialectFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return 2
+		}
+		dialect = d
+	}
+	evaluator.AllowEval = *allowEval
+	if *debug {
+		logging.SetLogger(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+		defer logging.SetLogger(nil)
+	}
+	object.Stdout = stdout
 
-	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
-	p.registerPrefix(token.IDENT, p.parseIdentifier)
-	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	// 事後デバッグの REPL は標準入力から読む
+	onError := errorOptions{heapDump: *heapDump}
+	if *postMortem {
+		onError.debugIn = stdin
+	}
 
-	p.infixParseFns = make(map[token.TokenType]infixParseFn)
-	p.registerInfix(token.PLUS, p.parseAddExpression)
-	p.registerInfix(token.ASTERISK, p.parseMulExpression)
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return 1
+		}
+		recorder := trace.NewRecorder(f)
+		evaluator.SetTracer(recorder)
+		defer func() {
+			evaluator.SetTracer(nil)
+			if err := recorder.Err(); err != nil {
+				fmt.Fprintf(stderr, "monkey: trace: %s\n", err)
+			}
+			f.Close()
+		}()
+	}
 
-	// tokenを2つ進めて2つ入れる
-	// null,null -> null,a[0] -> a[0],a[1]
-	p.nextToken()
-	p.nextToken()
+	// command は実行したサブコマンドの名前。使われ方の記録に使う
+	var command string
+	hook := usageHook
+	if path := os.Getenv("MONKEY_USAGE_FILE"); path != "" {
+		hook = usagestats.FileHook{Path: path}
+	}
+	if hook != nil {
+		stop := usagestats.CountBuiltins()
+		defer func() {
+			ev := usagestats.Event{Command: command, Builtins: stop()}
+			if command == "-e" || command == "repl" || command == "run" {
+				ev.Engine = *engine
+			}
+			if command == "" {
+				return
+			}
+			if err := hook.Record(ev); err != nil {
+				fmt.Fprintf(stderr, "monkey: usage: %s\n", err)
+			}
+		}()
+	}
 
-	return p
-}
+	switch {
+	case *expr != "":
+		if flags.NArg() > 0 {
+			flags.Usage()
+			return 2
+		}
+		command = "-e"
+		return execute("-e", strings.NewReader(*expr), *engine, true, onError, stdout, stderr)
 
-func (p *Parser) Errors() []string {
-	return p.errors
-}
+	case flags.NArg() == 0:
+		command = "repl"
+		switch *engine {
+		case "vm":
+			fmt.Fprintln(stdout, "Monkey programming language (vm)")
+		case "rvm":
+			fmt.Fprintln(stdout, "Monkey programming language (rvm)")
+		default:
+			fmt.Fprintln(stdout, "Monkey programming language")
+		}
+		// カレントディレクトリの repl_init.mk を --preload のファイルより先に読む
+		var files []string
+		if _, err := fs.Stat(scriptFS, repl.InitFile); err == nil {
+			files = append(files, repl.InitFile)
+		}
+		files = append(files, preload...)
+		repl.StartWithOptions(stdin, stdout, repl.Options{Engine: *engine, Preload: files, FS: scriptFS, Compat: compatMode})
+		return 0
+
+	case flags.NArg() == 2 && flags.Arg(0) == "run":
+		command = "run"
+		filename := flags.Arg(1)
+		f, err := scriptFS.Open(filename)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return 1
+		}
+		defer f.Close()
+
+		// コンパイル済みのファイルはスタック VM の命令列なので、スタック VM で実行する。
+		// 拡張子が .mkc なら中身が壊れていてもソースとしては読まず、runCompiled でエラーにする
+		src := bufio.NewReader(f)
+		if head, _ := src.Peek(4); mkc.IsMKC(head) || filepath.Ext(filename) == ".mkc" {
+			if *engine == "rvm" {
+				fmt.Fprintf(stderr, "monkey: %s is compiled for the vm engine; --engine=rvm cannot run it\n", filename)
+				return 2
+			}
+			return runCompiled(filename, src, stdout, stderr)
+		}
+		return execute(filename, src, *engine, false, onError, stdout, stderr)
+
+	case flags.NArg() >= 2 && flags.Arg(0) == "compile":
+		command = "compile"
+		return compileFile(flags.Args()[1:], stderr)
+
+	case flags.NArg() == 3 && flags.Arg(0) == "trace" && flags.Arg(1) == "view":
+		command = "trace view"
+		return viewTrace(flags.Arg(2), stdin, stdout, stderr)
+
+	case flags.NArg() <= 2 && flags.Arg(0) == "explain":
+		command = "explain"
+		return explain(flags.Args()[1:], stdout, stderr)
 
-func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	case flags.NArg() >= 2 && flags.Arg(0) == "spec":
+		command = "spec"
+		return runSpec(flags.Args()[1:], stdout, stderr)
+
+	case flags.NArg() == 1 && flags.Arg(0) == "doctor":
+		command = "doctor"
+		return doctor(stdout)
+
+	case flags.NArg() == 2 && flags.Arg(0) == "fmt":
+		command = "fmt"
+		return format(flags.Arg(1), stdout, stderr)
+
+	case flags.NArg() >= 2 && flags.Arg(0) == "parse":
+		command = "parse"
+		return dumpAST(flags.Args()[1:], stdout, stderr)
+
+	default:
+		flags.Usage()
+		return 2
+	}
 }
 
-func (p *Parser) nextToken() {
-	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+// format は filename を整形して stdout に書き出す
+func format(filename string, stdout, stderr io.Writer) int {
+	f, err := scriptFS.Open(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	program, ok := parse(filename, f, stderr)
+	if !ok {
+		return 1
+	}
+	if err := printer.Fprint(stdout, program); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	return 0
 }
 
-func (p *Parser) ParseProgram() *ast.Program {
-	program := &ast.Program{}
-	program.Statements = []ast.Statement{}
-	for p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
+// dumpAST は monkey parse の残りの引数を受け取り、構文木を書き出す。
+// --json のときは astjson の形式、そうでなければ括弧付きの式の形で出す
+func dumpAST(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkey parse", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
+	asJSON := flags.Bool("json", false, "print the syntax tree as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	filename := flags.Arg(0)
+	f, err := scriptFS.Open(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	program, ok := parse(filename, f, stderr)
+	if !ok {
+		return 1
+	}
+	if !*asJSON {
+		for _, s := range program.Statements {
+			fmt.Fprintln(stdout, s.String())
 		}
-		p.nextToken()
+		return 0
 	}
-	return program
+
+	out, err := astjson.MarshalIndent(program, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s\n", out)
+	return 0
 }
-func (p *Parser) parseStatement() ast.Statement {
-	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
-	case token.RETURN:
-		return p.parseReturnStatement()
-	default:
-		return p.parseExpressionStatement()
+
+// compileFile は monkey compile の残りの引数を受け取り、スクリプトを .mkc ファイルに書き出す。
+// 既定ではソースも埋め込み、版の違う monkey でもコンパイルし直して実行できるようにする
+func compileFile(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkey compile", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
+	out := flags.String("o", "", "output file (default: FILE with the extension replaced by .mkc)")
+	noSource := flags.Bool("no-source", false, "do not embed the source")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
 	}
+
+	filename := flags.Arg(0)
+	src, err := fs.ReadFile(scriptFS, filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	// 構文エラーは run と同じ形で全て出す
+	program, ok := parse(filename, strings.NewReader(string(src)), stderr)
+	if !ok {
+		return 1
+	}
+	// mkc は別名を知らないので、別名があればキーワードに直したソースをコンパイルして埋め込む
+	source := string(src)
+	if len(dialect) > 0 {
+		source = printer.Format(program)
+	}
+
+	bytecode, err := mkc.Compile(source)
+	if err != nil {
+		reportError(stderr, filename, err)
+		return 1
+	}
+	embedded := source
+	if *noSource {
+		embedded = ""
+	}
+	data, err := mkc.Encode(bytecode, embedded)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", filename, err)
+		return 1
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".mkc"
+	}
+	if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	return 0
 }
-func (p *Parser) parseLetStatement() *ast.LetStatement {
-	stmt := &ast.LetStatement{Token: p.curToken}
-	if !p.expectPeek(token.IDENT) {
-		return nil
+
+// explain はエラーコードの説明と例を出す。コードを渡さなければ一覧を出す
+func explain(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		for _, e := range diag.Catalog {
+			fmt.Fprintf(stdout, "%s  %s\n", e.Code, e.Title)
+		}
+		return 0
 	}
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	if !p.expectPeek(token.ASSIGN) {
-		return nil
+
+	e, ok := diag.Lookup(strings.ToUpper(args[0]))
+	if !ok {
+		fmt.Fprintf(stderr, "monkey: unknown error code %s\n", args[0])
+		return 1
 	}
-	// TODO: セミコロンに遭遇するまで式を読み飛ばしてしまっている
-	for !p.curTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	fmt.Fprintf(stdout, "%s: %s\n\n%s\n", e.Code, e.Title, e.Explanation)
+	if e.Example != "" {
+		fmt.Fprintf(stdout, "\nExample:\n")
+		for _, line := range strings.Split(e.Example, "\n") {
+			fmt.Fprintf(stdout, "  %s\n", line)
+		}
 	}
-	return stmt
+	return 0
 }
 
-func (p *Parser) curTokenIs(t token.TokenType) bool {
-	return p.curToken.Type == t
+// runSpec は monkey spec の残りの引数を受け取り、適合テストのファイルのケースを実行する。
+// 違ったケースを1行ずつ出し、最後に数をまとめる。1つでも違えば 1 を返す
+func runSpec(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkey spec", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
+	engine := flags.String("engine", "", "run the cases on this engine only (default: all engines)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	engines := spec.Engines
+	if *engine != "" {
+		if *engine != "eval" && *engine != "vm" && *engine != "rvm" {
+			fmt.Fprintf(stderr, "unknown engine: %s\n", *engine)
+			return 2
+		}
+		engines = []string{*engine}
+	}
+
+	passed, failed := 0, 0
+	for _, path := range flags.Args() {
+		cases, err := spec.Load(scriptFS, path)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return 1
+		}
+		for _, c := range cases {
+			for _, e := range engines {
+				if !c.Applies(e) {
+					continue
+				}
+				if err := spec.Run(c, e); err != nil {
+					fmt.Fprintf(stdout, "FAIL %s: %s (%s): %s\n", path, c.Name, e, err)
+					failed++
+					continue
+				}
+				passed++
+			}
+		}
+	}
+	fmt.Fprintf(stdout, "%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
 }
 
-func (p *Parser) peekTokenIs(t token.TokenType) bool {
-	return p.peekToken.Type == t
+// viewTrace は --trace で記録したファイルを読み、stdin のコマンドで1文ずつ表示する
+func viewTrace(filename string, stdin io.Reader, stdout, stderr io.Writer) int {
+	f, err := scriptFS.Open(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	events, err := trace.Read(f)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", filename, err)
+		return 1
+	}
+	trace.View(events, stdin, stdout)
+	return 0
 }
 
-func (p *Parser) expectPeek(t token.TokenType) bool {
-	if p.peekTokenIs(t) {
-		p.nextToken()
-		return true
-	} else {
-		p.peekError(t)
-		return false
+// runCompiled は .mkc ファイルを読み込んで VM で実行する
+func runCompiled(name string, src io.Reader, stdout, stderr io.Writer) int {
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	bytecode, _, err := mkc.Load(data)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		return 1
+	}
+	if err := vm.New(bytecode).Run(); err != nil {
+		reportError(stderr, name, err)
+		return 1
 	}
+	return 0
 }
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	stmt := &ast.ReturnStatement{Token: p.curToken}
-	p.nextToken()
-	// TODO: セミコロンに遭遇するまで式を読み飛ばしてしまっている
-	for !p.curTokenIs(token.SEMICOLON) {
-		p.nextToken()
+// postMortemREPL はエラーの起きた環境 env に束縛された名前を示してから、env の中で REPL を開く
+func postMortemREPL(env *object.Environment, in io.Reader, out io.Writer) {
+	fmt.Fprintf(out, "post-mortem: bindings in the failing scope: %s\n", strings.Join(env.Names(), ", "))
+	repl.StartWithEnvironment(in, out, env)
+}
+
+// writeHeapDump は env から辿れるオブジェクトを name.heap.json に書き出す。-e のときは monkey.heap.json
+func writeHeapDump(name string, env *object.Environment, stderr io.Writer) {
+	path := name + ".heap.json"
+	if name == "-e" {
+		path = "monkey.heap.json"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: heap dump: %s\n", err)
+		return
 	}
-	return stmt
+	defer f.Close()
+	if err := object.DumpHeap(f, env); err != nil {
+		fmt.Fprintf(stderr, "monkey: heap dump: %s\n", err)
+		return
+	}
+	fmt.Fprintf(stderr, "heap dump written to %s\n", path)
 }
 
-func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
-	p.prefixParseFns[tokenType] = fn
+// scriptFS はスクリプトや設定を読むファイルシステム。run, fmt, parse, compile, trace view と
+// --dialect は全てここから読むので、埋め込む側は embed.FS や zip.Reader などに差し替えられる。
+// 書き出すファイル (.mkc, トレース, ヒープダンプ) は OS のファイルシステムに書く
+var scriptFS fs.FS = hostFS{}
+
+// hostFS は OS のファイルシステムを fs.FS として見せる。コマンドラインで渡されたパスを
+// そのまま開けるよう、fs.ValidPath でない絶対パスや ".." を含むパスも受け付ける
+type hostFS struct{}
+
+func (hostFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
 }
-func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
-	p.infixParseFns[tokenType] = fn
+
+// stringList は繰り返し指定できるフラグの値
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{Token: p.curToken}
-	stmt.Expression = p.parseExpression(LOWEST)
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
+// usageHook は実行したコマンドと使った組み込み関数を記録する。既定では何も記録しない。
+// 社内向けに配布する埋め込み先はここに usagestats.Hook を設定する。
+// MONKEY_USAGE_FILE が設定されていればそちらのファイルに記録する
+var usageHook usagestats.Hook
+
+// messageLang はエラーメッセージの言語。--lang で決まる
+var messageLang = "en"
+
+func supportedLanguage(lang string) bool {
+	for _, l := range diag.Languages {
+		if l == lang {
+			return true
+		}
 	}
-	return stmt
+	return false
 }
 
-func (p *Parser) parseExpression(precedence int) ast.Expression {
-	prefix := p.prefixParseFns[p.curToken.Type]
-	leftExp := prefix()
-	fmt.Println("left : " + leftExp.String())
-	if p.peekTokenIs(token.SEMICOLON) {
-		fmt.Println("return : " + leftExp.String())
-		return leftExp
+// report はエラーを where: msg の形で、messageLang の言語に訳して stderr に出す。
+// code があれば [E2003] のように後ろに付ける。--compat=book のときは付けない
+func report(stderr io.Writer, where, msg, code string) {
+	msg = diag.Translate(msg, messageLang)
+	if code == "" || compatMode == object.CompatBook {
+		fmt.Fprintf(stderr, "%s: %s\n", where, msg)
+		return
 	}
-	// precedence 以上を parseする
-	if p.peekTokenPriority() < precedence {
+	fmt.Fprintf(stderr, "%s: %s [%s]\n", where, msg, code)
+}
+
+// reportError はコンパイラや VM の返したエラーを、メッセージからコードを決めて出す
+func reportError(stderr io.Writer, where string, err error) {
+	report(stderr, where, err.Error(), diag.Classify(err.Error()))
+}
+
+// compatMode は --compat で選んだ振る舞い。execute と report が使う
+var compatMode object.Compat
 
-		return leftExp
+// dialect は --dialect で読み込んだキーワードの別名。parse が使う
+var dialect parser.Dialect
+
+// readDialect は JSON のオブジェクトで書かれた別名を読み込み、正しいか確かめる
+func readDialect(filename string) (parser.Dialect, error) {
+	data, err := fs.ReadFile(scriptFS, filename)
+	if err != nil {
+		return nil, err
 	}
-	infix := p.infixParseFns[p.peekToken.Type]
-	rightExp := infix(leftExp)
-	fmt.Println("right : " + rightExp.String())
-	fmt.Println(leftExp.String())
-	if p.peekTokenIs(token.SEMICOLON) {
-		fmt.Println("return : " + leftExp.String())
-		return leftExp
+	var d parser.Dialect
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
 	}
-	op := p.peekToken.Type
-	pr := p.peekTokenPriority()
-	// p.nextToken()
-	// p.nextToken()
-	return &ast.InfixExpression{
-		Op:       op,
-		LeftExp:  rightExp,
-		RightExp: p.parseExpression(pr),
+	if err := parser.New(lexer.New("")).SetDialect(d); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
 	}
+	return d, nil
 }
 
-func (p *Parser) peekTokenPriority() int {
-	switch p.peekToken.Type {
-	case token.PLUS:
-		return SUM
-	case token.ASTERISK:
-		return PRODUCT
-	default:
-		return LOWEST
+// parse は src を構文解析する。構文エラーは name:行:列 の形で全て stderr に出す
+func parse(name string, src io.Reader, stderr io.Writer) (*ast.Program, bool) {
+	file := token.NewFileSet().AddFile(name, 0)
+	l := lexer.NewFile(file, src)
+	p := parser.New(l)
+	// 別名は readDialect で確かめてあるので失敗しない
+	p.SetDialect(dialect)
+	program := p.ParseProgram()
+	if err := l.Err(); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		return nil, false
 	}
+	if len(p.Errors()) != 0 {
+		for _, err := range p.Errors() {
+			report(stderr, file.Position(file.Pos(err.Offset)).String(), err.Msg, err.Code)
+		}
+		return nil, false
+	}
+	return program, true
 }
-func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+// errorOptions は評価器で実行時エラーが起きたときに何をするか
+type errorOptions struct {
+	debugIn  io.Reader // nil でなければエラーの起きた環境で REPL を開き、ここから読む
+	heapDump bool      // グローバル環境を JSON に書き出す
 }
 
-func (p *Parser) parseIntegerLiteral() ast.Expression {
-	lit := &ast.IntegerLiteral{Token: p.curToken}
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
-	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+// execute は src を解析して実行する。構文エラーか実行時エラーがあれば 1 を返す
+func execute(name string, src io.Reader, engine string, printResult bool, onError errorOptions, stdout, stderr io.Writer) int {
+	program, ok := parse(name, src, stderr)
+	if !ok {
+		return 1
 	}
-	lit.Value = value
-	return lit
-}
 
-func (p *Parser) parseAddExpression(left ast.Expression) ast.Expression {
-	p.nextToken()
-	p.nextToken()
-	right := p.parseExpression(SUM)
-	fmt.Println("cur " + string(p.curToken.Type) + "l : " + left.String() + " " + "r : " + right.String())
-	return &ast.InfixExpression{
-		LeftExp:  left,
-		RightExp: right,
-		Op:       token.PLUS,
+	macroEnv := object.NewEnvironment()
+	macroEnv.SetCompat(compatMode)
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		reportError(stderr, name, err)
+		return 1
 	}
-}
+	program = expanded.(*ast.Program)
 
-func (p *Parser) parseMulExpression(left ast.Expression) ast.Expression {
-	p.nextToken()
-	p.nextToken()
-	right := p.parseExpression(PRODUCT)
-	fmt.Println("cur : " + string(p.curToken.Literal) + " ,l : " + left.String() + " " + "r : " + right.String())
-	return &ast.InfixExpression{
-		LeftExp:  left,
-		RightExp: right,
-		Op:       token.ASTERISK,
+	var result object.Object
+	switch engine {
+	case "vm":
+		comp := compiler.New()
+		comp.SetCompat(compatMode)
+		if err := comp.Compile(program); err != nil {
+			reportError(stderr, name, err)
+			return 1
+		}
+		machine := vm.New(compiler.Optimize(comp.Bytecode()))
+		machine.SetCompat(compatMode)
+		if err := machine.Run(); err != nil {
+			reportError(stderr, name, err)
+			return 1
+		}
+		if n := len(program.Statements); n > 0 {
+			if _, ok := program.Statements[n-1].(*ast.ExpressionStatement); ok {
+				result = machine.LastPoppedStackElem()
+			}
+		}
+	case "rvm":
+		comp := compiler.NewRegisterCompiler()
+		comp.SetCompat(compatMode)
+		if err := comp.Compile(program); err != nil {
+			reportError(stderr, name, err)
+			return 1
+		}
+		machine := vm.NewRegisterVM(comp.Program())
+		machine.SetCompat(compatMode)
+		if err := machine.Run(); err != nil {
+			reportError(stderr, name, err)
+			return 1
+		}
+		if n := len(program.Statements); n > 0 {
+			if _, ok := program.Statements[n-1].(*ast.ExpressionStatement); ok {
+				result = machine.LastEvaluated()
+			}
+		}
+	default:
+		// @deprecated の付いた関数の呼び出しは、箇所ごとに1度だけ警告する
+		evaluator.SetDeprecationHandler(func(call *ast.CallExpression, reason string) {
+			tok := call.Token
+			if ident, ok := call.Function.(*ast.Identifier); ok {
+				tok = ident.Token
+			}
+			where := fmt.Sprintf("%s:%d:%d", name, tok.Line, tok.Column)
+			report(stderr, where, fmt.Sprintf("warning: %s is deprecated: %s", call.Function.String(), reason), "")
+		})
+		defer evaluator.SetDeprecationHandler(nil)
+
+		env := object.NewEnvironment()
+		env.SetCompat(compatMode)
+		result, err = evaluator.SafeEval(program, env)
+		if err != nil {
+			reportError(stderr, name, err)
+			return 1
+		}
+		if err, ok := result.(*object.Error); ok {
+			report(stderr, name, err.Message, err.Code)
+			if onError.heapDump {
+				writeHeapDump(name, env, stderr)
+			}
+			if onError.debugIn != nil && err.Env != nil {
+				postMortemREPL(err.Env, onError.debugIn, stdout)
+			}
+			return 1
+		}
 	}
-}
 
-func main() {
-	input := `
-1*2*3;
-`
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	if len(program.Statements) != 0 {
-		fmt.Println(program.Statements[0].String())
+	if printResult && result != nil {
+		fmt.Fprintln(stdout, object.Format(result, object.DisplayFormat))
 	}
+	return 0
 }
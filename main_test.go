@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kurarrr/monkey/usagestats"
+)
+
+// エラーメッセージの期待値は英語なので、実行する人の環境によらず英語にする
+func TestMain(m *testing.M) {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		os.Unsetenv(name)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	ok := write("ok.monkey", "// 2 を 3 倍する\nlet x = 2;\nputs(x /* 2 */ * 3);\nputs(\"done\");\n")
+	bad := write("bad.monkey", "let x = 1;\nlet = 2;\nlet y 3;\n")
+	messy := write("messy.monkey", "let f=fn(x){x*2};puts(f(2))")
+	fail := write("fail.monkey", "puts(1);\n1 + true;\nputs(2);\n")
+	okCompiled := filepath.Join(dir, "ok.mkc")
+	emptyCompiled := write("empty.mkc", "")
+	failCompiled := filepath.Join(dir, "fail.out")
+
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{"run", ok}, 0, "6\ndone\n", ""},
+		{[]string{"--engine=vm", "run", ok}, 0, "6\ndone\n", ""},
+		{[]string{"--engine=rvm", "run", ok}, 0, "6\ndone\n", ""},
+		{[]string{"run", bad}, 1, "",
+			bad + ":2:5: expected next token to be IDENT, got = instead [E1001]\n" +
+				bad + ":2:5: no prefix parse function for = found [E1002]\n" +
+				bad + ":3:7: expected next token to be =, got INT instead [E1001]\n"},
+		{[]string{"run", fail}, 1, "1\n", fail + ": type mismatch: INTEGER + BOOLEAN [E3001]\n"},
+		{[]string{"--engine=vm", "run", fail}, 1, "1\n", fail + ": type mismatch: INTEGER + BOOLEAN [E3001]\n"},
+		{[]string{"--engine=rvm", "run", fail}, 1, "1\n", fail + ": type mismatch: INTEGER + BOOLEAN [E3001]\n"},
+		{[]string{"fmt", messy}, 0, "let f = fn(x) {\n\tx * 2;\n};\nputs(f(2));\n", ""},
+		{[]string{"fmt", bad}, 1, "",
+			bad + ":2:5: expected next token to be IDENT, got = instead [E1001]\n" +
+				bad + ":2:5: no prefix parse function for = found [E1002]\n" +
+				bad + ":3:7: expected next token to be =, got INT instead [E1001]\n"},
+		{[]string{"parse", messy}, 0, "let f = fn<f>(x) (x * 2);\nputs(f(2))\n", ""},
+		{[]string{"parse", "--json", bad}, 1, "",
+			bad + ":2:5: expected next token to be IDENT, got = instead [E1001]\n" +
+				bad + ":2:5: no prefix parse function for = found [E1002]\n" +
+				bad + ":3:7: expected next token to be =, got INT instead [E1001]\n"},
+		{[]string{"parse", "--json"}, 2, "", usage},
+		{[]string{"-e", "1 + 2"}, 0, "3\n", ""},
+		{[]string{"--engine=vm", "-e", `"a" + "b"`}, 0, "ab\n", ""},
+		{[]string{"--engine=rvm", "-e", "let f = fn(n) { n * 2 }; f(21)"}, 0, "42\n", ""},
+		{[]string{"-e", "let x = 1"}, 0, "", ""},
+		{[]string{"-e", "1 +"}, 1, "", "-e:1:4: no prefix parse function for EOF found [E1002]\n"},
+		{[]string{"--engine=jit"}, 2, "", "unknown engine: jit\n"},
+		{[]string{"--engine=vm", "--post-mortem", "run", fail}, 2, "", "--post-mortem works only with --engine=eval\n"},
+		{[]string{"--engine=rvm", "--trace", "out.trace", "-e", "1"}, 2, "", "--trace works only with --engine=eval\n"},
+		{[]string{"--engine=vm", "--heap-dump-on-error", "-e", "1"}, 2, "", "--heap-dump-on-error works only with --engine=eval\n"},
+		{[]string{"run"}, 2, "", usage},
+		{[]string{"compile", ok}, 0, "", ""},
+		{[]string{"run", okCompiled}, 0, "6\ndone\n", ""},
+		{[]string{"--engine=eval", "run", okCompiled}, 0, "6\ndone\n", ""},
+		{[]string{"--engine=vm", "run", okCompiled}, 0, "6\ndone\n", ""},
+		{[]string{"--engine=rvm", "run", okCompiled}, 2, "", "monkey: " + okCompiled + " is compiled for the vm engine; --engine=rvm cannot run it\n"},
+		{[]string{"run", emptyCompiled}, 1, "", emptyCompiled + ": mkc: not a compiled monkey file\n"},
+		{[]string{"compile", "--no-source", "-o", failCompiled, fail}, 0, "", ""},
+		{[]string{"run", failCompiled}, 1, "1\n", failCompiled + ": type mismatch: INTEGER + BOOLEAN [E3001]\n"},
+		{[]string{"compile", bad}, 1, "",
+			bad + ":2:5: expected next token to be IDENT, got = instead [E1001]\n" +
+				bad + ":2:5: no prefix parse function for = found [E1002]\n" +
+				bad + ":3:7: expected next token to be =, got INT instead [E1001]\n"},
+		{[]string{"compile"}, 2, "", usage},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+		if code != tt.code {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d", tt.args, tt.code, code)
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("%v: wrong stdout. want=%q, got=%q", tt.args, tt.stdout, stdout.String())
+		}
+		if stderr.String() != tt.stderr {
+			t.Errorf("%v: wrong stderr. want=%q, got=%q", tt.args, tt.stderr, stderr.String())
+		}
+	}
+}
+
+func TestPostMortem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "fail.monkey")
+	src := "let check = fn(limit) { let total = limit * 2; total + true };\ncheck(21);\n"
+	if err := ioutil.WriteFile(script, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--post-mortem", "run", script}, strings.NewReader("total\nlimit + 1\n"), &stdout, &stderr)
+
+	if code != 1 {
+		t.Errorf("wrong exit code. want=1, got=%d", code)
+	}
+	expected := "post-mortem: bindings in the failing scope: limit, total\n>> 42\n>> 22\n>> "
+	if stdout.String() != expected {
+		t.Errorf("wrong stdout. want=%q, got=%q", expected, stdout.String())
+	}
+	if stderr.String() != script+": type mismatch: INTEGER + BOOLEAN [E3001]\n" {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+}
+
+func TestHeapDumpOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "fail.monkey")
+	if err := ioutil.WriteFile(script, []byte("let names = [\"a\", \"b\"];\nnames + 1;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--heap-dump-on-error", "run", script}, strings.NewReader(""), &stdout, &stderr); code != 1 {
+		t.Errorf("wrong exit code. want=1, got=%d", code)
+	}
+	dumpFile := script + ".heap.json"
+	if !strings.HasSuffix(stderr.String(), "heap dump written to "+dumpFile+"\n") {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+
+	data, err := ioutil.ReadFile(dumpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump struct {
+		Environments []struct {
+			Bindings map[string]int `json:"bindings"`
+		} `json:"environments"`
+		Summary struct {
+			ByType map[string]int `json:"byType"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatalf("heap dump is not JSON: %s", err)
+	}
+	if _, ok := dump.Environments[0].Bindings["names"]; !ok || dump.Summary.ByType["STRING"] != 2 {
+		t.Errorf("unexpected heap dump: %s", data)
+	}
+}
+
+func TestDebugLog(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"--debug", "--engine=vm", "-e", "let f = fn() { f() }; f()"}
+	if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 1 {
+		t.Errorf("wrong exit code. want=1, got=%d", code)
+	}
+	for _, want := range []string{
+		`level=DEBUG msg="vm: limit reached" limit=frames max=1024`,
+		`level=DEBUG msg="vm: run failed" engine=stack`,
+		"-e: stack overflow: more than 1024 nested calls [E5001]\n",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr does not contain %q. got=%q", want, stderr.String())
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{"explain", "E2003"}, 0, "E2003: undefined variable\n\nThe name is not bound", ""},
+		{[]string{"explain", "e3001"}, 0, "E3001: type mismatch\n", ""},
+		{[]string{"explain"}, 0, "E1001  unexpected token\nE1002  expression expected\n", ""},
+		{[]string{"explain", "E0000"}, 1, "", "monkey: unknown error code E0000\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, strings.NewReader(""), &stdout, &stderr); code != tt.code {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d", tt.args, tt.code, code)
+		}
+		if !strings.HasPrefix(stdout.String(), tt.stdout) {
+			t.Errorf("%v: wrong stdout. want prefix %q, got=%q", tt.args, tt.stdout, stdout.String())
+		}
+		if stderr.String() != tt.stderr {
+			t.Errorf("%v: wrong stderr. want=%q, got=%q", tt.args, tt.stderr, stderr.String())
+		}
+	}
+}
+
+func TestLang(t *testing.T) {
+	tests := []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{[]string{"--lang=ja", "-e", "1 + true"}, 1, "-e: 型が合いません: INTEGER + BOOLEAN [E3001]\n"},
+		{[]string{"--lang=ja", "--engine=vm", "-e", "puts(x)"}, 1, "-e: 識別子が見つかりません: x [E2003]\n"},
+		{[]string{"--lang=ja", "-e", "let = 1"}, 1,
+			"-e:1:5: 次のトークンは IDENT のはずですが = でした [E1001]\n-e:1:5: = で始まる式はありません [E1002]\n"},
+		{[]string{"--lang=en", "-e", "1 + true"}, 1, "-e: type mismatch: INTEGER + BOOLEAN [E3001]\n"},
+		{[]string{"--lang=fr", "-e", "1"}, 2, "unknown language: fr\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, strings.NewReader(""), &stdout, &stderr); code != tt.code {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d", tt.args, tt.code, code)
+		}
+		if stderr.String() != tt.stderr {
+			t.Errorf("%v: wrong stderr. want=%q, got=%q", tt.args, tt.stderr, stderr.String())
+		}
+	}
+
+	// --lang がなければ LANG から決める
+	t.Setenv("LANG", "ja_JP.UTF-8")
+	var stdout, stderr bytes.Buffer
+	run([]string{"-e", "10 / 0"}, strings.NewReader(""), &stdout, &stderr)
+	if want := "-e: ゼロで割りました: 10 / 0 [E3003]\n"; stderr.String() != want {
+		t.Errorf("wrong stderr with LANG=ja_JP.UTF-8. want=%q, got=%q", want, stderr.String())
+	}
+}
+
+func TestDialect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dialectFile := filepath.Join(dir, "dialect.json")
+	if err := ioutil.WriteFile(dialectFile, []byte(`{"func": "fn", "var": "let", "もし": "if"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	badFile := filepath.Join(dir, "bad.json")
+	if err := ioutil.WriteFile(badFile, []byte(`{"func": "function"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := "var double = func(x) { x * 2 }; もし (true) { puts(double(21)) }"
+
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{"--dialect", dialectFile, "-e", src}, 0, "42\nnull\n", ""},
+		{[]string{"--dialect", dialectFile, "--engine=vm", "-e", src}, 0, "42\nnull\n", ""},
+		{[]string{"--dialect", badFile, "-e", src}, 2, "", "monkey: " + badFile + ": dialect: \"function\" is not a keyword\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, strings.NewReader(""), &stdout, &stderr); code != tt.code {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d (%s)", tt.args, tt.code, code, stderr.String())
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("%v: wrong stdout. want=%q, got=%q", tt.args, tt.stdout, stdout.String())
+		}
+		if stderr.String() != tt.stderr {
+			t.Errorf("%v: wrong stderr. want=%q, got=%q", tt.args, tt.stderr, stderr.String())
+		}
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	src := "// @deprecated \"use twice\"\nlet double = fn(x) { x * 2 };\ndouble(1) + double(2)"
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-e", src}, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("wrong exit code %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "6\n" {
+		t.Errorf("wrong stdout: %q", stdout.String())
+	}
+	expected := "-e:3:1: warning: double is deprecated: use twice\n-e:3:13: warning: double is deprecated: use twice\n"
+	if stderr.String() != expected {
+		t.Errorf("wrong stderr. want=%q, got=%q", expected, stderr.String())
+	}
+}
+
+func TestCompat(t *testing.T) {
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{"--compat=book", "-e", "len(push([1], 2))"}, 0, "2\n", ""},
+		{[]string{"--compat=book", "--lang=ja", "-e", "sort([1])"}, 1, "", "-e: identifier not found: sort\n"},
+		{[]string{"--compat=book", "--engine=vm", "-e", "5 + true"}, 1, "", "-e: type mismatch: INTEGER + BOOLEAN\n"},
+		// 本と同じく整数のあふれは折り返す
+		{[]string{"--compat=book", "-e", "9223372036854775807 + 1"}, 0, "-9223372036854775808\n", ""},
+		{[]string{"--compat=book", "--engine=vm", "-e", "9223372036854775807 + 1"}, 0, "-9223372036854775808\n", ""},
+		{[]string{"--compat=book", "--engine=rvm", "-e", "-9223372036854775807 - 2"}, 0, "9223372036854775807\n", ""},
+		// 設定は実行ごとに戻る
+		{[]string{"-e", "9223372036854775807 + 1"}, 0, "9223372036854775808\n", ""},
+		{[]string{"-e", "len(sort([2, 1]))"}, 0, "2\n", ""},
+		{[]string{"--compat=python", "-e", "1"}, 2, "", "unknown compatibility mode: python\n"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, strings.NewReader(""), &stdout, &stderr); code != tt.code {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d", tt.args, tt.code, code)
+		}
+		if stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+			t.Errorf("%v: wrong output. want=%q %q, got=%q %q", tt.args, tt.stdout, tt.stderr, stdout.String(), stderr.String())
+		}
+	}
+}
+
+func TestScriptFS(t *testing.T) {
+	defer func(saved fs.FS) { scriptFS = saved }(scriptFS)
+	scriptFS = fstest.MapFS{
+		"scripts/hello.monkey": {Data: []byte("let greet = fn(name) { \"hello, \" + name };\nputs(greet(\"fs\"));\n")},
+		"scripts/ugly.monkey":  {Data: []byte("let x=1;puts( x )")},
+		"dialect.json":         {Data: []byte(`{"var": "let"}`)},
+		"scripts/var.monkey":   {Data: []byte("var y = 2; puts(y);")},
+	}
+
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+	}{
+		{[]string{"run", "scripts/hello.monkey"}, 0, "hello, fs\n"},
+		{[]string{"--engine=vm", "run", "scripts/hello.monkey"}, 0, "hello, fs\n"},
+		{[]string{"fmt", "scripts/ugly.monkey"}, 0, "let x = 1;\nputs(x);\n"},
+		{[]string{"parse", "scripts/ugly.monkey"}, 0, "let x = 1;\nputs(x)\n"},
+		{[]string{"--dialect", "dialect.json", "run", "scripts/var.monkey"}, 0, "2\n"},
+		{[]string{"run", "scripts/missing.monkey"}, 1, ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, strings.NewReader(""), &stdout, &stderr); code != tt.code {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d (%s)", tt.args, tt.code, code, stderr.String())
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("%v: wrong stdout. want=%q, got=%q", tt.args, tt.stdout, stdout.String())
+		}
+	}
+}
+
+func TestUsageStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	t.Setenv("MONKEY_USAGE_FILE", path)
+
+	runs := [][]string{
+		{"-e", "puts(len([1, 2]))"},
+		{"--engine=vm", "-e", "len([]); len(\"a\")"},
+		{"explain", "E2003"},
+	}
+	for _, args := range runs {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+			t.Fatalf("%v failed with %d: %s", args, code, stderr.String())
+		}
+	}
+
+	stats, err := usagestats.ReadStats(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Commands["-e"] != 2 || stats.Commands["explain"] != 1 {
+		t.Errorf("wrong commands: %v", stats.Commands)
+	}
+	if stats.Engines["eval"] != 1 || stats.Engines["vm"] != 1 || len(stats.Engines) != 2 {
+		t.Errorf("wrong engines: %v", stats.Engines)
+	}
+	if stats.Builtins["len"] != 3 || stats.Builtins["puts"] != 1 {
+		t.Errorf("wrong builtins: %v", stats.Builtins)
+	}
+
+	// 設定しなければ何も書かない
+	t.Setenv("MONKEY_USAGE_FILE", "")
+	os.Remove(path)
+	var stdout, stderr bytes.Buffer
+	run([]string{"-e", "1"}, strings.NewReader(""), &stdout, &stderr)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("usage file written without MONKEY_USAGE_FILE")
+	}
+}
+
+func TestSpec(t *testing.T) {
+	corpus, err := filepath.Glob(filepath.Join("spec", "testdata", "*.json"))
+	if err != nil || len(corpus) == 0 {
+		t.Fatalf("no spec corpus: %v", err)
+	}
+	failing := filepath.Join(t.TempDir(), "failing.json")
+	cases := `[{"name": "sum", "input": "1 + 1", "result": "3"}, {"name": "ok", "input": "2", "result": "2"}]`
+	if err := ioutil.WriteFile(failing, []byte(cases), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run(append([]string{"spec"}, corpus...), strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Errorf("corpus failed with %d:\n%s%s", code, stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"spec", "--engine=vm", failing}, strings.NewReader(""), &stdout, &stderr); code != 1 {
+		t.Errorf("wrong exit code. want=1, got=%d", code)
+	}
+	expected := "FAIL " + failing + ": sum (vm): result: got \"2\", want \"3\"\n1 passed, 1 failed\n"
+	if stdout.String() != expected {
+		t.Errorf("wrong stdout. want=%q, got=%q", expected, stdout.String())
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"doctor"}, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("doctor failed with %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	var report doctorReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("report is not JSON: %s\n%s", err, stdout.String())
+	}
+	if !report.OK || len(report.Checks) != 6 {
+		t.Errorf("wrong report: %+v", report)
+	}
+
+	// 壊れた使われ方のファイルは失敗として報告する
+	path := filepath.Join(t.TempDir(), "usage.json")
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MONKEY_USAGE_FILE", path)
+	stdout.Reset()
+	if code := run([]string{"doctor"}, strings.NewReader(""), &stdout, &stderr); code != 1 {
+		t.Errorf("wrong exit code for a broken usage file. want=1, got=%d", code)
+	}
+	if !strings.Contains(stdout.String(), `"name": "usage file",
+      "ok": false`) {
+		t.Errorf("usage file check not reported as failed:\n%s", stdout.String())
+	}
+}
+
+func TestREPLPreload(t *testing.T) {
+	defer func(saved fs.FS) { scriptFS = saved }(scriptFS)
+	scriptFS = fstest.MapFS{
+		"repl_init.mk": {Data: []byte("let greeting = \"hi\";")},
+		"lib.mk":       {Data: []byte("let shout = fn(s) { s + \"!\" };")},
+	}
+
+	for _, engine := range []string{"eval", "vm"} {
+		var stdout, stderr bytes.Buffer
+		args := []string{"--engine=" + engine, "--preload", "lib.mk"}
+		if code := run(args, strings.NewReader("shout(greeting)\n"), &stdout, &stderr); code != 0 {
+			t.Fatalf("%v failed with %d: %s", args, code, stderr.String())
+		}
+		if !strings.HasSuffix(stdout.String(), ">> hi!\n>> ") {
+			t.Errorf("%s: wrong output. got=%q", engine, stdout.String())
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "ok.monkey")
+	if err := ioutil.WriteFile(script, []byte("let x = 2;\nputs(x * 3);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	traceFile := filepath.Join(dir, "ok.trace")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--trace", traceFile, "run", script}, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("run failed with %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "6\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"trace", "view", traceFile}, strings.NewReader("n\n"), &stdout, &stderr); code != 0 {
+		t.Fatalf("trace view failed with %d: %s", code, stderr.String())
+	}
+	for _, want := range []string{"[1/2] line 1: let x = 2;\n  x = 2\n", "trace> [2/2] line 2: puts(x * 3);\n"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("trace view output does not contain %q. got=%q", want, stdout.String())
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Package metrics はプロセス内のインタプリタの動きを数える。
+//
+// 評価器・VM・コンパイラがここのカウンタを増やし、ホストは Handler を HTTP サーバに登録するか、
+// expvar の "monkey" (/debug/vars) から読む。Handler の出力は Prometheus のテキスト形式。
+// カウンタはプロセス全体で1つずつで、複数のゴルーチンから同時に増やしてよい。
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// Counter は名前の付いた整数値。Kind が "gauge" のものは減ることもある
+type Counter struct {
+	Name string
+	Help string
+	Kind string
+	v    int64
+}
+
+func (c *Counter) Add(n int64) { atomic.AddInt64(&c.v, n) }
+func (c *Counter) Inc()        { c.Add(1) }
+func (c *Counter) Dec()        { c.Add(-1) }
+
+func (c *Counter) Value() int64 { return atomic.LoadInt64(&c.v) }
+
+var (
+	Evaluations = &Counter{Name: "monkey_evaluations_total", Kind: "counter",
+		Help: "Programs run by the evaluator or a VM."}
+	Errors = &Counter{Name: "monkey_errors_total", Kind: "counter",
+		Help: "Programs that stopped with a runtime error."}
+	Statements = &Counter{Name: "monkey_eval_statements_total", Kind: "counter",
+		Help: "Statements evaluated by the tree-walking evaluator."}
+	Instructions = &Counter{Name: "monkey_vm_instructions_total", Kind: "counter",
+		Help: "Instructions executed by the stack and register VMs."}
+	Active = &Counter{Name: "monkey_active_interpreters", Kind: "gauge",
+		Help: "Programs running right now."}
+	ConstantPoolHits = &Counter{Name: "monkey_constant_pool_hits_total", Kind: "counter",
+		Help: "Constants the compiler found in a ConstantPool."}
+	ConstantPoolMisses = &Counter{Name: "monkey_constant_pool_misses_total", Kind: "counter",
+		Help: "Constants the compiler had to add to a ConstantPool."}
+)
+
+// All は出力する順に並べた全てのカウンタ
+var All = []*Counter{Evaluations, Errors, Statements, Instructions, Active, ConstantPoolHits, ConstantPoolMisses}
+
+// ConstantPoolHitRatio は ConstantPool で既存の定数が見つかった割合を返す。まだ引いていなければ 0
+func ConstantPoolHitRatio() float64 {
+	hits, misses := ConstantPoolHits.Value(), ConstantPoolMisses.Value()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// Snapshot は今の値を名前から引けるようにして返す
+func Snapshot() map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, c := range All {
+		values[c.Name] = c.Value()
+	}
+	values["monkey_constant_pool_hit_ratio"] = ConstantPoolHitRatio()
+	return values
+}
+
+// WriteText は全てのカウンタを Prometheus のテキスト形式で w に書き出す
+func WriteText(w io.Writer) error {
+	for _, c := range All {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", c.Name, c.Help, c.Name, c.Kind, c.Name, c.Value()); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "# HELP monkey_constant_pool_hit_ratio Share of ConstantPool lookups that found an existing constant.\n"+
+		"# TYPE monkey_constant_pool_hit_ratio gauge\nmonkey_constant_pool_hit_ratio %g\n", ConstantPoolHitRatio())
+	return err
+}
+
+// Handler は WriteText の出力を返す http.Handler。ホストは好きなパスに登録する
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteText(w)
+	})
+}
+
+func init() {
+	expvar.Publish("monkey", expvar.Func(func() interface{} { return Snapshot() }))
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	Evaluations.Add(2)
+	defer Evaluations.Add(-2)
+	before := ConstantPoolHits.Value()
+	ConstantPoolHits.Inc()
+	defer ConstantPoolHits.Dec()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE monkey_evaluations_total counter\n",
+		"# TYPE monkey_active_interpreters gauge\n",
+		"monkey_constant_pool_hit_ratio ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("output does not contain %q. got=%q", want, body)
+		}
+	}
+	// 各カウンタは HELP, TYPE, 値の3行
+	if lines := strings.Count(body, "\n"); lines != 3*(len(All)+1) {
+		t.Errorf("wrong number of lines. want=%d, got=%d", 3*(len(All)+1), lines)
+	}
+	if got := Snapshot()["monkey_constant_pool_hits_total"]; got != before+1 {
+		t.Errorf("wrong snapshot value. want=%d, got=%v", before+1, got)
+	}
+	if expvar.Get("monkey") == nil {
+		t.Errorf("monkey is not published to expvar")
+	}
+}
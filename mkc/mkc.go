@@ -0,0 +1,518 @@
+// Package mkc はコンパイル済みのバイトコードを .mkc ファイルとして読み書きする。
+//
+// ファイルの先頭は形式によらず次の並びで固定する。後の版で本体の形式が変わっても、
+// 古い・新しいファイルのヘッダとソースは必ず読めるようにするため。
+//
+//	"MKC\x00"  マジック
+//	uint16     形式の版 (FormatVersion)
+//	string     言語の版 (LanguageVersion)
+//	string     埋め込んだソース。埋め込まないときは空
+//
+// その後ろに本体 (使う組み込み関数、main の命令列と定数) が続く。数値は全てビッグエンディアン、
+// string と命令列は uint32 の長さの後に中身を置く。
+//
+// 組み込み関数は object.Builtins の添字で呼ぶので、本体の先頭に命令が参照する添字と名前の組を置く。
+// 表に関数が足されたり並びが変わったりしても、使う関数が同じ添字にあれば読める。
+//
+// 版の扱い: 形式の版か言語の版がこの実装と違うファイルは Decode で *VersionError に、
+// 使う組み込み関数がこの実装の表と合わないファイルは *BuiltinError になる。
+// Load はソースが埋め込まれていればそこからコンパイルし直し、なければ同じエラーを返す。
+//
+// 版が合っていても、途中で切れたファイルや VM が範囲外を読む命令を含むファイルは
+// Decode がエラーにし、VM には渡さない。
+package mkc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/compiler"
+	"github.com/kurarrr/monkey/evaluator"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/logging"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/parser"
+	"github.com/kurarrr/monkey/printer"
+)
+
+const magic = "MKC\x00"
+
+// errTruncated はファイルが途中で切れていることを表す
+var errTruncated = errors.New("mkc: truncated file")
+
+// FormatVersion はファイルの本体の並びの版。並びを変えたら上げる
+const FormatVersion = 4
+
+// LanguageVersion は命令の番号と意味の版。命令を足したり意味を変えたりしたら上げる
+const LanguageVersion = "3"
+
+// 定数の種類を表す1バイトの印
+const (
+	tagInteger  = 'i'
+	tagFloat    = 'f'
+	tagString   = 's'
+	tagDecimal  = 'd'
+	tagFunction = 'c'
+	tagPosition = 'p'
+)
+
+// VersionError はファイルの版がこの実装と合わないことを表す
+type VersionError struct {
+	FormatVersion   int
+	LanguageVersion string
+	HasSource       bool
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("mkc: file is format %d, language %s; this build reads format %d, language %s",
+		e.FormatVersion, e.LanguageVersion, FormatVersion, LanguageVersion)
+}
+
+// BuiltinError はファイルが使う組み込み関数が、この実装の object.Builtins の同じ添字にないことを表す
+type BuiltinError struct {
+	Index     int
+	Name      string // ファイルが Index で呼ぶ組み込み関数
+	HasSource bool
+}
+
+func (e *BuiltinError) Error() string {
+	if e.Index >= len(object.Builtins) {
+		return fmt.Sprintf("mkc: file calls builtin %s as #%d; this build has no builtin #%d", e.Name, e.Index, e.Index)
+	}
+	return fmt.Sprintf("mkc: file calls builtin %s as #%d; this build has %s there", e.Name, e.Index, object.Builtins[e.Index].Name)
+}
+
+// IsMKC は data が .mkc ファイルの中身かどうかをマジックで判定する
+func IsMKC(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// Encode は bytecode を .mkc の形式で書き出す。source が空でなければ埋め込み、
+// 版が合わない実装でもそこからコンパイルし直せるようにする
+func Encode(bytecode *compiler.Bytecode, source string) ([]byte, error) {
+	return encode(bytecode, source, FormatVersion, LanguageVersion)
+}
+
+func encode(bytecode *compiler.Bytecode, source string, format int, language string) ([]byte, error) {
+	w := &writer{}
+	w.buf.WriteString(magic)
+	w.uint16(format)
+	w.string(language)
+	w.string(source)
+
+	used := usedBuiltins(bytecode)
+	w.uint32(len(used))
+	for _, i := range used {
+		if i >= len(object.Builtins) {
+			return nil, fmt.Errorf("mkc: no builtin #%d", i)
+		}
+		w.uint16(i)
+		w.string(object.Builtins[i].Name)
+	}
+
+	w.bytes(bytecode.Instructions)
+	w.uint32(len(bytecode.Constants))
+	for i, c := range bytecode.Constants {
+		switch c := c.(type) {
+		case *object.Integer:
+			w.buf.WriteByte(tagInteger)
+			w.uint64(uint64(c.Value))
+		case *object.Float:
+			w.buf.WriteByte(tagFloat)
+			w.uint64(math.Float64bits(c.Value))
+		case *object.String:
+			w.buf.WriteByte(tagString)
+			w.string(c.Value)
+		case *object.Decimal:
+			w.buf.WriteByte(tagDecimal)
+			w.string(c.Unscaled.String())
+			w.uint32(c.Scale)
+		case *object.CompiledFunction:
+			w.buf.WriteByte(tagFunction)
+			w.uint32(c.NumLocals)
+			w.uint32(c.NumParameters)
+			w.bytes(c.Instructions)
+			// 関数リテラルは params や source で使うので、ソースの形で残して読むときに構文解析し直す。
+			// 説明のコメントは let に付くものでリテラルの形には出ないので、別に残す
+			literal, doc := "", ""
+			if c.Literal != nil {
+				literal, doc = printer.Format(c.Literal), c.Literal.Doc
+			}
+			w.string(literal)
+			w.string(doc)
+		case *object.Position:
+			w.buf.WriteByte(tagPosition)
+			w.uint32(c.Line)
+			w.uint32(c.Column)
+		default:
+			return nil, fmt.Errorf("mkc: cannot encode constant %d of type %s", i, c.Type())
+		}
+	}
+	return w.buf.Bytes(), nil
+}
+
+// Decode は .mkc ファイルを読んでバイトコードに戻す。版が合わなければ *VersionError を返す。
+// 読んだ命令列は verify で確かめる
+func Decode(data []byte) (*compiler.Bytecode, error) {
+	r := &reader{data: data}
+	format, language, source, err := r.header()
+	if err != nil {
+		return nil, err
+	}
+	if format != FormatVersion || language != LanguageVersion {
+		return nil, &VersionError{FormatVersion: format, LanguageVersion: language, HasSource: source != ""}
+	}
+	builtins, err := r.builtins(source != "")
+	if err != nil {
+		return nil, err
+	}
+	bytecode, err := r.body()
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(bytecode, builtins); err != nil {
+		return nil, err
+	}
+	return bytecode, nil
+}
+
+// Load は Decode と同じだが、版が合わないときは埋め込まれたソースからコンパイルし直す。
+// 2つ目の戻り値はコンパイルし直したかどうか
+func Load(data []byte) (*compiler.Bytecode, bool, error) {
+	bytecode, decodeErr := Decode(data)
+	var versionErr *VersionError
+	var builtinErr *BuiltinError
+	var hasSource bool
+	switch {
+	case errors.As(decodeErr, &versionErr):
+		hasSource = versionErr.HasSource
+	case errors.As(decodeErr, &builtinErr):
+		hasSource = builtinErr.HasSource
+	default:
+		return bytecode, false, decodeErr
+	}
+	if !hasSource {
+		return nil, false, fmt.Errorf("%s; no embedded source to recompile from", decodeErr)
+	}
+
+	r := &reader{data: data}
+	_, _, source, err := r.header()
+	if err != nil {
+		return nil, false, err
+	}
+	logging.Debug("mkc: recompiling from embedded source", "reason", decodeErr)
+	bytecode, err = Compile(source)
+	if err != nil {
+		return nil, false, err
+	}
+	return bytecode, true, nil
+}
+
+// Compile は source をマクロ展開してコンパイルし、最適化したバイトコードを返す。
+// monkey run がスクリプトを VM で実行するときと同じ手順
+func Compile(source string) (*compiler.Bytecode, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		err := p.Errors()[0]
+		return nil, fmt.Errorf("%d:%d: %s", err.Line, err.Col, err.Msg)
+	}
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(expanded); err != nil {
+		return nil, err
+	}
+	return compiler.Optimize(comp.Bytecode()), nil
+}
+
+// usedBuiltins は main と関数の命令が OpGetBuiltin で参照する組み込み関数の添字を、小さい順に返す
+func usedBuiltins(bytecode *compiler.Bytecode) []int {
+	used := map[int]bool{}
+	scan := func(ins code.Instructions) {
+		for i := 0; i < len(ins); {
+			def, err := code.Lookup(ins[i])
+			if err != nil {
+				return
+			}
+			operands, read := code.ReadOperands(def, ins[i+1:])
+			if code.Opcode(ins[i]) == code.OpGetBuiltin {
+				used[operands[0]] = true
+			}
+			i += 1 + read
+		}
+	}
+	scan(bytecode.Instructions)
+	for _, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			scan(fn.Instructions)
+		}
+	}
+
+	indexes := make([]int, 0, len(used))
+	for i := range used {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (w *writer) uint16(n int) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(n))
+	w.buf.Write(b[:])
+}
+
+func (w *writer) uint32(n int) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(n))
+	w.buf.Write(b[:])
+}
+
+func (w *writer) uint64(n uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	w.buf.Write(b[:])
+}
+
+func (w *writer) bytes(b []byte) {
+	w.uint32(len(b))
+	w.buf.Write(b)
+}
+
+func (w *writer) string(s string) {
+	w.bytes([]byte(s))
+}
+
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) header() (int, string, string, error) {
+	if !IsMKC(r.data) {
+		return 0, "", "", errors.New("mkc: not a compiled monkey file")
+	}
+	r.pos = len(magic)
+
+	format, err := r.uint16()
+	if err != nil {
+		return 0, "", "", err
+	}
+	language, err := r.string()
+	if err != nil {
+		return 0, "", "", err
+	}
+	source, err := r.string()
+	if err != nil {
+		return 0, "", "", err
+	}
+	return format, language, source, nil
+}
+
+// builtins は本体の先頭の組み込み関数の表を読み、object.Builtins と合うか確かめる。
+// 表にある添字を返す
+func (r *reader) builtins(hasSource bool) (map[int]bool, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	used := map[int]bool{}
+	for i := 0; i < n; i++ {
+		index, err := r.uint16()
+		if err != nil {
+			return nil, err
+		}
+		name, err := r.string()
+		if err != nil {
+			return nil, err
+		}
+		if index >= len(object.Builtins) || object.Builtins[index].Name != name {
+			return nil, &BuiltinError{Index: index, Name: name, HasSource: hasSource}
+		}
+		used[index] = true
+	}
+	return used, nil
+}
+
+func (r *reader) body() (*compiler.Bytecode, error) {
+	instructions, err := r.bytes()
+	if err != nil {
+		return nil, err
+	}
+	n, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	constants := []object.Object{}
+	for i := 0; i < n; i++ {
+		c, err := r.constant()
+		if err != nil {
+			return nil, err
+		}
+		constants = append(constants, c)
+	}
+	if r.pos != len(r.data) {
+		return nil, fmt.Errorf("mkc: %d trailing bytes", len(r.data)-r.pos)
+	}
+	return &compiler.Bytecode{Instructions: instructions, Constants: constants}, nil
+}
+
+func (r *reader) constant() (object.Object, error) {
+	if r.pos >= len(r.data) {
+		return nil, errTruncated
+	}
+	tag := r.data[r.pos]
+	r.pos++
+
+	switch tag {
+	case tagInteger:
+		v, err := r.uint64()
+		return &object.Integer{Value: int64(v)}, err
+	case tagFloat:
+		v, err := r.uint64()
+		return &object.Float{Value: math.Float64frombits(v)}, err
+	case tagString:
+		s, err := r.string()
+		return &object.String{Value: s}, err
+	case tagDecimal:
+		s, err := r.string()
+		if err != nil {
+			return nil, err
+		}
+		scale, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		unscaled, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("mkc: invalid decimal constant %q", s)
+		}
+		return &object.Decimal{Unscaled: unscaled, Scale: scale}, nil
+	case tagFunction:
+		return r.function()
+	case tagPosition:
+		line, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		column, err := r.uint32()
+		return &object.Position{Line: line, Column: column}, err
+	default:
+		return nil, fmt.Errorf("mkc: unknown constant tag %q", tag)
+	}
+}
+
+func (r *reader) function() (object.Object, error) {
+	numLocals, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	numParameters, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	instructions, err := r.bytes()
+	if err != nil {
+		return nil, err
+	}
+	source, err := r.string()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := r.string()
+	if err != nil {
+		return nil, err
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions:  code.Instructions(instructions),
+		NumLocals:     numLocals,
+		NumParameters: numParameters,
+	}
+	if source != "" {
+		fn.Literal = parseFunctionLiteral(source)
+	}
+	if fn.Literal != nil {
+		fn.Literal.Doc = doc
+	}
+	return fn, nil
+}
+
+// parseFunctionLiteral は printer が書き出した関数リテラルを読み直す。読めなければ nil
+func parseFunctionLiteral(source string) *ast.FunctionLiteral {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 || len(program.Statements) != 1 {
+		return nil
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil
+	}
+	literal, _ := stmt.Expression.(*ast.FunctionLiteral)
+	return literal
+}
+
+func (r *reader) uint16() (int, error) {
+	if r.pos+2 > len(r.data) {
+		return 0, errTruncated
+	}
+	n := binary.BigEndian.Uint16(r.data[r.pos:])
+	r.pos += 2
+	return int(n), nil
+}
+
+func (r *reader) uint32() (int, error) {
+	if r.pos+4 > len(r.data) {
+		return 0, errTruncated
+	}
+	n := binary.BigEndian.Uint32(r.data[r.pos:])
+	r.pos += 4
+	return int(n), nil
+}
+
+func (r *reader) uint64() (uint64, error) {
+	if r.pos+8 > len(r.data) {
+		return 0, errTruncated
+	}
+	n := binary.BigEndian.Uint64(r.data[r.pos:])
+	r.pos += 8
+	return n, nil
+}
+
+func (r *reader) bytes() ([]byte, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if r.pos+n > len(r.data) {
+		return nil, errTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *reader) string() (string, error) {
+	b, err := r.bytes()
+	return string(b), err
+}
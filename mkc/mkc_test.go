@@ -0,0 +1,261 @@
+package mkc
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/compiler"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/vm"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"1.5 * 2.0", "3.0"},
+		{`"mon" + "key"`, "monkey"},
+		{`decimal("0.1") + decimal("0.2")`, "0.3"},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)", "55"},
+		{"let adder = fn(x) { fn(y) { x + y } }; adder(2)(3)", "5"},
+		// 関数リテラルも残るので params や source が使える
+		{"params(fn(a, b) { a + b })[1]", "b"},
+		// assert の呼び出しの位置も定数として残る
+		{"assert(true); assert(1 > 0, \"x\"); 1", "1"},
+		{"source(fn(x) { x * 2 })", "fn(x) {\n\tx * 2;\n}"},
+		{"// twice は x を 2 倍する\nlet twice = fn(x) { x * 2 }; doc(twice)", "twice は x を 2 倍する"},
+	}
+
+	for _, tt := range tests {
+		bytecode, err := Compile(tt.input)
+		if err != nil {
+			t.Fatalf("%q: compile error: %s", tt.input, err)
+		}
+		data, err := Encode(bytecode, "")
+		if err != nil {
+			t.Fatalf("%q: Encode error: %s", tt.input, err)
+		}
+		decoded, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%q: Decode error: %s", tt.input, err)
+		}
+
+		if got := run(t, decoded); got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestVersionMismatch(t *testing.T) {
+	source := "let x = 20; x + 22"
+	bytecode, err := Compile(source)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	tests := []struct {
+		format   int
+		language string
+	}{
+		{FormatVersion + 1, LanguageVersion},
+		{FormatVersion, "0"},
+	}
+
+	for _, tt := range tests {
+		// ソースを埋め込んでいれば Load はコンパイルし直す
+		data, err := encode(bytecode, source, tt.format, tt.language)
+		if err != nil {
+			t.Fatalf("encode error: %s", err)
+		}
+
+		_, err = Decode(data)
+		var versionErr *VersionError
+		if !errors.As(err, &versionErr) {
+			t.Fatalf("format %d, language %s: expected *VersionError, got %v", tt.format, tt.language, err)
+		}
+
+		loaded, recompiled, err := Load(data)
+		if err != nil {
+			t.Fatalf("format %d, language %s: Load error: %s", tt.format, tt.language, err)
+		}
+		if !recompiled {
+			t.Errorf("format %d, language %s: expected the source to be recompiled", tt.format, tt.language)
+		}
+		if got := run(t, loaded); got != "42" {
+			t.Errorf("format %d, language %s: want=42, got=%s", tt.format, tt.language, got)
+		}
+
+		// ソースがなければ読み込めない
+		data, err = encode(bytecode, "", tt.format, tt.language)
+		if err != nil {
+			t.Fatalf("encode error: %s", err)
+		}
+		_, _, err = Load(data)
+		expected := versionErr.Error() + "; no embedded source to recompile from"
+		if err == nil || err.Error() != expected {
+			t.Errorf("wrong error. want=%q, got=%v", expected, err)
+		}
+	}
+
+	// 版が合っていればソースがあっても使わない
+	data, err := Encode(bytecode, source)
+	if err != nil {
+		t.Fatalf("Encode error: %s", err)
+	}
+	if _, recompiled, err := Load(data); err != nil || recompiled {
+		t.Errorf("expected no recompilation, got recompiled=%t, err=%v", recompiled, err)
+	}
+}
+
+func TestBuiltinMismatch(t *testing.T) {
+	source := `len("abc") + first([4])`
+	bytecode, err := Compile(source)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	withSource, err := Encode(bytecode, source)
+	if err != nil {
+		t.Fatalf("Encode error: %s", err)
+	}
+	withoutSource, err := Encode(bytecode, "")
+	if err != nil {
+		t.Fatalf("Encode error: %s", err)
+	}
+
+	// 組み込み関数の表の並びが変わったビルドで読む
+	saved := append(object.Builtins[:0:0], object.Builtins...)
+	defer func() { object.Builtins = saved }()
+	object.Builtins[0], object.Builtins[1] = object.Builtins[1], object.Builtins[0]
+
+	_, err = Decode(withoutSource)
+	var builtinErr *BuiltinError
+	if !errors.As(err, &builtinErr) {
+		t.Fatalf("expected *BuiltinError, got %v", err)
+	}
+	expected := "mkc: file calls builtin " + saved[builtinErr.Index].Name + " as #" +
+		strconv.Itoa(builtinErr.Index) + "; this build has " + object.Builtins[builtinErr.Index].Name + " there"
+	if err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, err.Error())
+	}
+	if _, _, err := Load(withoutSource); err == nil || err.Error() != expected+"; no embedded source to recompile from" {
+		t.Errorf("wrong Load error: %v", err)
+	}
+
+	loaded, recompiled, err := Load(withSource)
+	if err != nil || !recompiled {
+		t.Fatalf("expected recompilation, got recompiled=%t, err=%v", recompiled, err)
+	}
+	if got := run(t, loaded); got != "7" {
+		t.Errorf("want=7, got=%s", got)
+	}
+
+	// 使わない組み込み関数が足されても読める
+	object.Builtins = append(saved[:len(saved):len(saved)], saved[0])
+	if _, err := Decode(withoutSource); err != nil {
+		t.Errorf("unexpected error after appending a builtin: %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	bytecode, err := Compile("1")
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	data, err := Encode(bytecode, "")
+	if err != nil {
+		t.Fatalf("Encode error: %s", err)
+	}
+
+	tests := []struct {
+		input    []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "mkc: not a compiled monkey file"},
+		{[]byte{}, "mkc: not a compiled monkey file"},
+		{[]byte(magic), "mkc: truncated file"},
+		{data[:len(data)-3], "mkc: truncated file"},
+		{append(append([]byte{}, data...), 0), "mkc: 1 trailing bytes"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+
+	_, err = Encode(&compiler.Bytecode{Constants: []object.Object{&object.Array{}}}, "")
+	if err == nil || err.Error() != "mkc: cannot encode constant 0 of type ARRAY" {
+		t.Errorf("wrong Encode error: %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	join := func(ins ...[]byte) code.Instructions {
+		out := code.Instructions{}
+		for _, in := range ins {
+			out = append(out, in...)
+		}
+		return out
+	}
+	fn := func(numLocals int, ins ...[]byte) *object.CompiledFunction {
+		return &object.CompiledFunction{Instructions: join(ins...), NumLocals: numLocals}
+	}
+	one := &object.Integer{Value: 1}
+
+	tests := []struct {
+		instructions code.Instructions
+		constants    []object.Object
+		expected     string
+	}{
+		{join(code.Make(code.OpConstant, 0), code.Make(code.OpPop)), []object.Object{one}, ""},
+		{code.Instructions{255}, nil, "mkc: invalid bytecode in main at 0: unknown opcode 255"},
+		{code.Make(code.OpConstant, 0)[:2], []object.Object{one}, "mkc: invalid bytecode in main at 0: OpConstant is cut off"},
+		{code.Make(code.OpConstant, 1), []object.Object{one}, "mkc: invalid bytecode in main at 0: constant 1 out of range"},
+		{code.Make(code.OpGetLocal, 0), nil, "mkc: invalid bytecode in main at 0: local 0 out of range"},
+		{code.Make(code.OpGetBuiltin, 0), nil, "mkc: invalid bytecode in main at 0: builtin #0 is not in the file's builtin table"},
+		{join(code.Make(code.OpJump, 2), code.Make(code.OpNull)), nil, "mkc: invalid bytecode in main at 0: jump target 2 is not an instruction"},
+		{join(code.Make(code.OpJump, 5), code.Make(code.OpNull)), nil, "mkc: invalid bytecode in main at 0: jump target 5 is not an instruction"},
+		{join(code.Make(code.OpJump, 4), code.Make(code.OpNull)), nil, ""},
+		{code.Make(code.OpGetFree, 0), nil, "mkc: invalid bytecode in main: free variable 0 outside a closure"},
+		{code.Make(code.OpClosure, 0, 0), []object.Object{one}, "mkc: invalid bytecode in main at 0: constant 0 is not a function"},
+		// 関数の中の命令列も確かめる
+		{code.Make(code.OpClosure, 0, 0), []object.Object{fn(1, code.Make(code.OpGetLocal, 1))}, "mkc: invalid bytecode in constant 0 at 0: local 1 out of range"},
+		{code.Make(code.OpClosure, 0, 0), []object.Object{fn(0, code.Make(code.OpGetFree, 1))}, "mkc: invalid bytecode in main at 0: closure of constant 0 gets 0 free variables, needs 2"},
+		{code.Make(code.OpClosure, 0, 2), []object.Object{fn(0, code.Make(code.OpGetFree, 1))}, ""},
+	}
+
+	for i, tt := range tests {
+		err := verify(&compiler.Bytecode{Instructions: tt.instructions, Constants: tt.constants}, map[int]bool{})
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.expected {
+			t.Errorf("test %d: wrong error. want=%q, got=%q", i, tt.expected, got)
+		}
+	}
+
+	// Decode も命令列を確かめてから返す
+	data, err := Encode(&compiler.Bytecode{Instructions: code.Make(code.OpConstant, 3)}, "")
+	if err != nil {
+		t.Fatalf("Encode error: %s", err)
+	}
+	if _, err := Decode(data); err == nil || err.Error() != "mkc: invalid bytecode in main at 0: constant 3 out of range" {
+		t.Errorf("wrong Decode error: %v", err)
+	}
+}
+
+func run(t *testing.T, bytecode *compiler.Bytecode) string {
+	t.Helper()
+
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	return machine.LastPoppedStackElem().Inspect()
+}
@@ -0,0 +1,138 @@
+package mkc
+
+import (
+	"fmt"
+
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/compiler"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/vm"
+)
+
+// verify は読み込んだバイトコードを VM に渡しても範囲外を読まないか確かめる。
+// main と全ての関数の命令列について、命令が定義されていて被演算子が途中で切れていないこと、
+// 定数・グローバル・局所変数・自由変数・組み込み関数の添字と飛び先が範囲内にあることを見る。
+// builtins はファイルの組み込み関数の表にある添字
+func verify(bytecode *compiler.Bytecode, builtins map[int]bool) error {
+	v := &verifier{constants: bytecode.Constants, builtins: builtins}
+
+	// needFree[i] は定数 i の関数が参照する自由変数の数
+	needFree := map[int]int{}
+	for i, c := range bytecode.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		where := fmt.Sprintf("constant %d", i)
+		if fn.NumParameters > fn.NumLocals {
+			return fmt.Errorf("mkc: invalid bytecode in %s: %d parameters but %d locals", where, fn.NumParameters, fn.NumLocals)
+		}
+		free, err := v.instructions(where, fn.Instructions, fn.NumLocals)
+		if err != nil {
+			return err
+		}
+		needFree[i] = free
+	}
+	free, err := v.instructions("main", bytecode.Instructions, 0)
+	if err != nil {
+		return err
+	}
+	if free > 0 {
+		return fmt.Errorf("mkc: invalid bytecode in main: free variable %d outside a closure", free-1)
+	}
+
+	// クロージャを作る命令は、関数が参照する自由変数を全て渡さなければならない
+	for _, cl := range v.closures {
+		if cl.numFree < needFree[cl.constant] {
+			return fmt.Errorf("mkc: invalid bytecode in %s at %d: closure of constant %d gets %d free variables, needs %d",
+				cl.where, cl.offset, cl.constant, cl.numFree, needFree[cl.constant])
+		}
+	}
+	return nil
+}
+
+type verifier struct {
+	constants []object.Object
+	builtins  map[int]bool
+	closures  []closureSite
+}
+
+// closureSite は OpClosure の現れた場所と被演算子
+type closureSite struct {
+	where    string
+	offset   int
+	constant int
+	numFree  int
+}
+
+// instructions は1つの命令列を確かめ、参照する自由変数の数を返す。numLocals はその命令列の局所変数の数
+func (v *verifier) instructions(where string, ins code.Instructions, numLocals int) (int, error) {
+	fail := func(offset int, format string, a ...interface{}) (int, error) {
+		return 0, fmt.Errorf("mkc: invalid bytecode in %s at %d: %s", where, offset, fmt.Sprintf(format, a...))
+	}
+
+	// 飛び先は全ての命令の先頭が分かってから確かめる
+	starts := map[int]bool{len(ins): true}
+	type jump struct{ offset, target int }
+	var jumps []jump
+
+	free := 0
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return fail(i, "unknown opcode %d", ins[i])
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return fail(i, "%s is cut off", def.Name)
+		}
+		starts[i] = true
+		operands, _ := code.ReadOperands(def, ins[i+1:])
+
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant, code.OpAddConstant, code.OpSubConstant:
+			if operands[0] >= len(v.constants) {
+				return fail(i, "constant %d out of range", operands[0])
+			}
+		case code.OpClosure:
+			if operands[0] >= len(v.constants) {
+				return fail(i, "constant %d out of range", operands[0])
+			}
+			if _, ok := v.constants[operands[0]].(*object.CompiledFunction); !ok {
+				return fail(i, "constant %d is not a function", operands[0])
+			}
+			v.closures = append(v.closures, closureSite{where: where, offset: i, constant: operands[0], numFree: operands[1]})
+		case code.OpGetGlobal, code.OpSetGlobal:
+			if operands[0] >= vm.GlobalsSize {
+				return fail(i, "global %d out of range", operands[0])
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpMakeCell, code.OpGetLocalCell, code.OpSetLocalCell:
+			if operands[0] >= numLocals {
+				return fail(i, "local %d out of range", operands[0])
+			}
+		case code.OpGetFree, code.OpGetFreeCell, code.OpSetFreeCell:
+			if operands[0]+1 > free {
+				free = operands[0] + 1
+			}
+		case code.OpGetBuiltin:
+			if !v.builtins[operands[0]] {
+				return fail(i, "builtin #%d is not in the file's builtin table", operands[0])
+			}
+		case code.OpJump, code.OpJumpNotTruthy,
+			code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy, code.OpGreaterThanJumpNotTruthy,
+			code.OpLessThanJumpNotTruthy:
+			jumps = append(jumps, jump{offset: i, target: operands[0]})
+		}
+		i += 1 + width
+	}
+
+	for _, j := range jumps {
+		if !starts[j.target] {
+			return fail(j.offset, "jump target %d is not an instruction", j.target)
+		}
+	}
+	return free, nil
+}
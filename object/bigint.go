@@ -0,0 +1,45 @@
+package object
+
+import (
+	"hash/fnv"
+	"math/big"
+)
+
+// BigInt は int64 に収まらない整数。整数どうしの演算が桁あふれしたときに Arith と Negate が作る。
+// int64 に収まる値はいつも Integer で表すので、同じ値が Integer と BigInt の両方になることはない
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return BIG_INTEGER_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(b.Value.String()))
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+func (b *BigInt) Equal(other Object) bool {
+	o, ok := other.(*BigInt)
+	return ok && b.Value.Cmp(o.Value) == 0
+}
+
+func (b *BigInt) Compare(other Object) (int, bool) {
+	switch o := other.(type) {
+	case *BigInt:
+		return b.Value.Cmp(o.Value), true
+	case *Integer:
+		return b.Value.Cmp(big.NewInt(o.Value)), true
+	default:
+		return 0, false
+	}
+}
+
+// newInteger は v が int64 に収まれば Integer、収まらなければ BigInt を返す
+func newInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInt{Value: v}
+}
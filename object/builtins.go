@@ -0,0 +1,553 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/diag"
+	"github.com/kurarrr/monkey/printer"
+)
+
+// Stdout は puts の出力先。埋め込み先やテストで差し替えられる
+var Stdout io.Writer = os.Stdout
+
+// Exit は exit 組み込み関数が呼ぶ関数。埋め込み先でプロセスを終わらせたくなければ差し替える
+var Exit = os.Exit
+
+// MaxBuiltins は登録できる組み込み関数の数。OpGetBuiltin のオペランドが1バイトなので 256 まで
+const MaxBuiltins = 256
+
+// Builtins は評価器と VM が共有する組み込み関数の一覧。
+// コンパイラは添字で組み込み関数を参照するので、要素は末尾に追加すること。
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *String:
+					return &Integer{Value: int64(len(arg.Value))}
+				case *Hash:
+					return &Integer{Value: int64(len(arg.Pairs))}
+				case Iterable:
+					return &Integer{Value: int64(len(Collect(arg)))}
+				default:
+					return newError("argument to `len` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"first",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				if len(arr.Elements) > 0 {
+					return arr.Elements[0]
+				}
+				return nil
+			},
+		},
+	},
+	{
+		"last",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					return arr.Elements[length-1]
+				}
+				return nil
+			},
+		},
+	},
+	{
+		"rest",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					newElements := make([]Object, length-1)
+					copy(newElements, arr.Elements[1:length])
+					return &Array{Elements: newElements}
+				}
+				return nil
+			},
+		},
+	},
+	{
+		"push",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+
+				// 配列は値として扱うので、元の配列は変更せずに複製する
+				newElements := make([]Object, length+1)
+				copy(newElements, arr.Elements)
+				newElements[length] = args[1]
+
+				return &Array{Elements: newElements}
+			},
+		},
+	},
+	{
+		"decimal",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *String:
+					d, err := ParseDecimal(arg.Value)
+					if err != nil {
+						return newError("%s", err)
+					}
+					return d
+				case *Integer:
+					return NewDecimalFromInt(arg.Value)
+				case *BigInt:
+					return &Decimal{Unscaled: new(big.Int).Set(arg.Value), Scale: 0}
+				case *Decimal:
+					return arg
+				case *Float:
+					d, err := ParseDecimal(strconv.FormatFloat(arg.Value, 'f', -1, 64))
+					if err != nil {
+						return newError("%s", err)
+					}
+					return d
+				default:
+					return newError("argument to `decimal` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"parseInt",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+				}
+				str, ok := args[0].(*String)
+				if !ok {
+					return newError("argument to `parseInt` must be STRING, got %s", args[0].Type())
+				}
+
+				base := int64(10)
+				if len(args) == 2 {
+					b, ok := args[1].(*Integer)
+					if !ok {
+						return newError("base for `parseInt` must be INTEGER, got %s", args[1].Type())
+					}
+					base = b.Value
+				}
+				if base != 0 && (base < 2 || base > 36) {
+					return newError("invalid base for `parseInt`: %d", base)
+				}
+
+				value, err := strconv.ParseInt(str.Value, int(base), 64)
+				if err != nil {
+					return newError("could not parse %q as integer in base %d", str.Value, base)
+				}
+				return &Integer{Value: value}
+			},
+		},
+	},
+	{
+		"assert",
+		newContractBuiltin("assert", "assertion failed"),
+	},
+	{
+		"require",
+		newContractBuiltin("require", "precondition failed"),
+	},
+	{
+		"ensure",
+		newContractBuiltin("ensure", "postcondition failed"),
+	},
+	{
+		"arity",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				params, _, ok := functionParts(args[0])
+				if !ok {
+					return newError("argument to `arity` must be FUNCTION, got %s", args[0].Type())
+				}
+				return &Integer{Value: int64(len(params))}
+			},
+		},
+	},
+	{
+		"params",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				params, _, ok := functionParts(args[0])
+				if !ok {
+					return newError("argument to `params` must be FUNCTION, got %s", args[0].Type())
+				}
+
+				elements := make([]Object, len(params))
+				for i, p := range params {
+					elements[i] = &String{Value: p.Value}
+				}
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"source",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				params, body, ok := functionParts(args[0])
+				if !ok {
+					return newError("argument to `source` must be FUNCTION, got %s", args[0].Type())
+				}
+				fn := &ast.FunctionLiteral{Parameters: params, Body: body}
+				return &String{Value: printer.Format(fn)}
+			},
+		},
+	},
+	{
+		"doc",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if _, _, ok := functionParts(args[0]); !ok {
+					return newError("argument to `doc` must be FUNCTION, got %s", args[0].Type())
+				}
+				// 説明のコメントがなければ null
+				if doc := functionDoc(args[0]); doc != "" {
+					return &String{Value: doc}
+				}
+				return nil
+			},
+		},
+	},
+	{
+		"type",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				return &String{Value: string(args[0].Type())}
+			},
+		},
+	},
+	{
+		"exit",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+				code := int64(0)
+				if len(args) == 1 {
+					c, ok := args[0].(*Integer)
+					if !ok {
+						return newError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+					}
+					code = c.Value
+				}
+				Exit(int(code))
+				return nil
+			},
+		},
+	},
+	{
+		"puts",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				for _, arg := range args {
+					fmt.Fprintln(Stdout, Format(arg, DisplayFormat))
+				}
+				return nil
+			},
+		},
+	},
+	{
+		"float",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Float:
+					return arg
+				case *Integer:
+					return &Float{Value: float64(arg.Value)}
+				case *BigInt:
+					return &Float{Value: asFloat(arg)}
+				case *Decimal:
+					f, _ := strconv.ParseFloat(arg.Inspect(), 64)
+					return &Float{Value: f}
+				case *String:
+					f, err := strconv.ParseFloat(arg.Value, 64)
+					if err != nil {
+						return newError("could not parse %q as float", arg.Value)
+					}
+					return &Float{Value: f}
+				default:
+					return newError("argument to `float` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"int",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer:
+					return arg
+				case *Float:
+					// 0 に向かって切り捨てる。int64 に収まらない値は変換できない
+					if math.IsNaN(arg.Value) || arg.Value >= math.MaxInt64 || arg.Value < math.MinInt64 {
+						return newError("float %s out of integer range", arg.Inspect())
+					}
+					return &Integer{Value: int64(arg.Value)}
+				case *String:
+					i, err := strconv.ParseInt(arg.Value, 10, 64)
+					if err != nil {
+						return newError("could not parse %q as integer in base 10", arg.Value)
+					}
+					return &Integer{Value: i}
+				default:
+					return newError("argument to `int` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"semverCompare",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				var versions [2]semver
+				for i, arg := range args {
+					s, ok := arg.(*String)
+					if !ok {
+						return newError("argument to `semverCompare` must be STRING, got %s", arg.Type())
+					}
+					v, ok := parseSemver(s.Value)
+					if !ok {
+						return newError("invalid semantic version for `semverCompare`: %q", s.Value)
+					}
+					versions[i] = v
+				}
+				return &Integer{Value: int64(compareSemver(versions[0], versions[1]))}
+			},
+		},
+	},
+	{
+		"sort",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				it, ok := args[0].(Iterable)
+				if !ok {
+					return newError("argument to `sort` must be ITERABLE, got %s", args[0].Type())
+				}
+				// 要素は Ordered の Compare で並べる。比べられない組があれば演算子 < と同じエラーにする。
+				// Collect は新しい配列を作るので、元の配列は変わらない
+				elements := Collect(it)
+				var failed *Error
+				sort.SliceStable(elements, func(i, j int) bool {
+					c, ok := Compare(elements[i], elements[j])
+					if !ok && failed == nil {
+						left, right := elements[i].Type(), elements[j].Type()
+						if left != right {
+							failed = newError("type mismatch: %s < %s", left, right)
+						} else {
+							failed = newError("unknown operator: %s < %s", left, right)
+						}
+					}
+					return c < 0
+				})
+				if failed != nil {
+					return failed
+				}
+				return &Array{Elements: elements}
+			},
+		},
+	},
+}
+
+// RegisterBuiltin は組み込み関数を追加する。同じ名前があれば置き換える。
+// コンパイラは組み込み関数を添字で参照するので、置き換えても添字は変わらない。
+// 評価やコンパイルを始める前に呼ぶこと。
+func RegisterBuiltin(name string, fn BuiltinFunction) {
+	for _, def := range Builtins {
+		if def.Name == name {
+			def.Builtin.Fn = fn
+			return
+		}
+	}
+	if len(Builtins) >= MaxBuiltins {
+		panic(fmt.Sprintf("too many builtins: cannot register %q", name))
+	}
+	Builtins = append(Builtins, struct {
+		Name    string
+		Builtin *Builtin
+	}{name, &Builtin{Fn: fn}})
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// functionParts は評価器の関数と VM のクロージャの両方から仮引数と本体を取り出す
+func functionParts(obj Object) ([]*ast.Identifier, *ast.BlockStatement, bool) {
+	switch fn := obj.(type) {
+	case *Function:
+		return fn.Parameters, fn.Body, true
+	case *Closure:
+		if fn.Fn.Literal == nil {
+			return nil, nil, false
+		}
+		return fn.Fn.Literal.Parameters, fn.Fn.Literal.Body, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// functionDoc は関数の説明のコメントを返す。なければ空
+func functionDoc(obj Object) string {
+	switch fn := obj.(type) {
+	case *Function:
+		return fn.Doc
+	case *Closure:
+		if fn.Fn.Literal != nil {
+			return fn.Fn.Literal.Doc
+		}
+	}
+	return ""
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return NewError(format, a...)
+}
+
+// NewError はメッセージからコードを決めて Error を作る
+func NewError(format string, a ...interface{}) *Error {
+	msg := fmt.Sprintf(format, a...)
+	return &Error{Message: msg, Code: diag.Classify(msg)}
+}
+
+// isTruthy は評価器の真偽判定と同じく、false と null だけを偽とみなす
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+// newContractBuiltin は第1引数が偽のときに failure で始まるエラーを返す組み込み関数を作る。
+// 第2引数があればメッセージとして付け加える。呼び出しの位置が渡されれば failure の後ろに付ける
+func newContractBuiltin(name, failure string) *Builtin {
+	return &Builtin{
+		Positioned: true,
+		Fn: func(args ...Object) Object {
+			failure := failure
+			if n := len(args); n > 0 {
+				if pos, ok := args[n-1].(*Position); ok {
+					args = args[:n-1]
+					failure = fmt.Sprintf("%s at %s", failure, pos.Inspect())
+				}
+			}
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			if isTruthy(args[0]) {
+				return nil
+			}
+			if len(args) == 1 {
+				return newError("%s", failure)
+			}
+
+			msg, ok := args[1].(*String)
+			if !ok {
+				return newError("message for `%s` must be STRING, got %s", name, args[1].Type())
+			}
+			return newError("%s: %s", failure, msg.Value)
+		},
+	}
+}
@@ -0,0 +1,109 @@
+package object
+
+// Comparable は == と != で値として比べられるオブジェクトが実装する。
+// どちらも実装していなければ、同じオブジェクトかどうかで比べる
+type Comparable interface {
+	Equal(other Object) bool
+}
+
+// Ordered は < と > と sort で並べられるオブジェクトが実装する。
+// Compare は other より小さければ負、等しければ 0、大きければ正を返す。
+// other と比べられない (型が違うなど) ときは ok が false
+type Ordered interface {
+	Compare(other Object) (c int, ok bool)
+}
+
+// ハッシュのキーには Hashable を実装したオブジェクトが使える。
+// 埋め込む側の型も、これらを実装すれば組み込みの型と同じように演算子やハッシュで使える
+
+// Equal は == の意味で a と b が等しいかを返す
+func Equal(a, b Object) bool {
+	if c, ok := a.(Comparable); ok {
+		return c.Equal(b)
+	}
+	if c, ok := b.(Comparable); ok {
+		return c.Equal(a)
+	}
+	return a == b
+}
+
+// Compare は a と b を比べる。a が Ordered でないか、b と比べられなければ ok が false
+func Compare(a, b Object) (c int, ok bool) {
+	o, ok := a.(Ordered)
+	if !ok {
+		return 0, false
+	}
+	return o.Compare(b)
+}
+
+func (i *Integer) Equal(other Object) bool {
+	o, ok := other.(*Integer)
+	return ok && i.Value == o.Value
+}
+
+func (i *Integer) Compare(other Object) (int, bool) {
+	switch o := other.(type) {
+	case *Integer:
+		return compareOrdered(i.Value < o.Value, i.Value > o.Value), true
+	case *BigInt:
+		return -o.Value.Sign(), true
+	default:
+		return 0, false
+	}
+}
+
+func (f *Float) Equal(other Object) bool {
+	o, ok := other.(*Float)
+	return ok && f.Value == o.Value
+}
+
+// Compare は NaN とは比べられないものとする
+func (f *Float) Compare(other Object) (int, bool) {
+	o, ok := other.(*Float)
+	if !ok || f.Value != f.Value || o.Value != o.Value {
+		return 0, false
+	}
+	return compareOrdered(f.Value < o.Value, f.Value > o.Value), true
+}
+
+func (d *Decimal) Equal(other Object) bool {
+	o, ok := other.(*Decimal)
+	return ok && d.Cmp(o) == 0
+}
+
+func (d *Decimal) Compare(other Object) (int, bool) {
+	o, ok := other.(*Decimal)
+	if !ok {
+		return 0, false
+	}
+	return d.Cmp(o), true
+}
+
+func (s *String) Equal(other Object) bool {
+	o, ok := other.(*String)
+	return ok && s.Value == o.Value
+}
+
+func (s *String) Compare(other Object) (int, bool) {
+	o, ok := other.(*String)
+	if !ok {
+		return 0, false
+	}
+	return compareOrdered(s.Value < o.Value, s.Value > o.Value), true
+}
+
+func (b *Boolean) Equal(other Object) bool {
+	o, ok := other.(*Boolean)
+	return ok && b.Value == o.Value
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	default:
+		return 0
+	}
+}
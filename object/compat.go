@@ -0,0 +1,53 @@
+package object
+
+import "fmt"
+
+// BookBuiltins は「Go言語でつくるインタプリタ」(Writing an Interpreter in Go) の Monkey にある組み込み関数
+var BookBuiltins = []string{"len", "first", "last", "rest", "push", "puts"}
+
+// Compat はどの Monkey と同じに振る舞うか。ゼロ値はこの処理系そのままの振る舞い
+type Compat int
+
+const (
+	CompatNone Compat = iota
+	// CompatBook は本の Monkey と同じに振る舞う。組み込み関数が BookBuiltins だけになり
+	// (ほかの名前は未定義の識別子になる)、整数は BIGINT にならずに桁あふれし、
+	// 未定義の識別子のエラーに候補の名前を付けず、
+	// REPL は構文エラーを本と同じ形で出す。本のサンプルをそのまま動かすためのもの
+	CompatBook
+)
+
+// ParseCompat は --compat の値を Compat にする。空文字列は CompatNone
+func ParseCompat(s string) (Compat, error) {
+	switch s {
+	case "":
+		return CompatNone, nil
+	case "book":
+		return CompatBook, nil
+	}
+	return CompatNone, fmt.Errorf("unknown compatibility mode: %s", s)
+}
+
+// BuiltinAvailable は組み込み関数 name をこの設定で使えるかどうかを返す
+func (c Compat) BuiltinAvailable(name string) bool {
+	if c != CompatBook {
+		return true
+	}
+	for _, b := range BookBuiltins {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WrapsIntegers は整数の演算が int64 を桁あふれしたとき、BIGINT にせず本の Monkey (Go の int64) と
+// 同じく桁あふれさせるかどうかを返す
+func (c Compat) WrapsIntegers() bool {
+	return c == CompatBook
+}
+
+// Suggestions は未定義の識別子のエラーに候補の名前を付けるかどうかを返す
+func (c Compat) Suggestions() bool {
+	return c != CompatBook
+}
@@ -0,0 +1,159 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DivisionScale は割り切れない除算で保持する小数点以下の桁数
+const DivisionScale = 16
+
+// Decimal は Unscaled * 10^-Scale で表す任意精度の10進数
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    int
+}
+
+func (d *Decimal) Type() ObjectType { return DECIMAL_OBJ }
+func (d *Decimal) Inspect() string {
+	digits := new(big.Int).Abs(d.Unscaled).String()
+	sign := ""
+	if d.Unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if d.Scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= d.Scale {
+		digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+	}
+	point := len(digits) - d.Scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// ParseDecimal は "-12.340" のような10進表記を解釈する。小数点以下の桁数は保持される。
+func ParseDecimal(s string) (*Decimal, error) {
+	str := strings.TrimSpace(s)
+	intPart, fracPart := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+	digits := intPart + fracPart
+	if strings.ContainsAny(digits, "eE_") || strings.Trim(digits, "+-") == "" {
+		return nil, fmt.Errorf("invalid decimal literal: %q", s)
+	}
+	unscaled, ok := new(big.Int).SetString(digits, 10)
+	if !ok || strings.ContainsAny(fracPart, "+-") {
+		return nil, fmt.Errorf("invalid decimal literal: %q", s)
+	}
+	return &Decimal{Unscaled: unscaled, Scale: len(fracPart)}, nil
+}
+
+func NewDecimalFromInt(v int64) *Decimal {
+	return &Decimal{Unscaled: big.NewInt(v), Scale: 0}
+}
+
+func (d *Decimal) rescale(scale int) *big.Int {
+	if scale == d.Scale {
+		return new(big.Int).Set(d.Unscaled)
+	}
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-d.Scale)), nil)
+	return factor.Mul(factor, d.Unscaled)
+}
+
+func maxScale(a, b *Decimal) int {
+	if a.Scale > b.Scale {
+		return a.Scale
+	}
+	return b.Scale
+}
+
+func (d *Decimal) Add(o *Decimal) *Decimal {
+	scale := maxScale(d, o)
+	sum := d.rescale(scale)
+	return &Decimal{Unscaled: sum.Add(sum, o.rescale(scale)), Scale: scale}
+}
+
+func (d *Decimal) Sub(o *Decimal) *Decimal {
+	scale := maxScale(d, o)
+	diff := d.rescale(scale)
+	return &Decimal{Unscaled: diff.Sub(diff, o.rescale(scale)), Scale: scale}
+}
+
+func (d *Decimal) Mul(o *Decimal) *Decimal {
+	product := new(big.Int).Mul(d.Unscaled, o.Unscaled)
+	return &Decimal{Unscaled: product, Scale: d.Scale + o.Scale}
+}
+
+func (d *Decimal) Neg() *Decimal {
+	return &Decimal{Unscaled: new(big.Int).Neg(d.Unscaled), Scale: d.Scale}
+}
+
+// Quo は DivisionScale 桁まで偶数丸めで割り算し、末尾の0をオペランドの桁数まで落とす。
+// o が0の場合は false を返す。
+func (d *Decimal) Quo(o *Decimal) (*Decimal, bool) {
+	if o.Unscaled.Sign() == 0 {
+		return nil, false
+	}
+	scale := DivisionScale
+	if s := maxScale(d, o); s > scale {
+		scale = s
+	}
+
+	// d / o を scale 桁で表すには分子を 10^(scale + o.Scale - d.Scale) 倍する
+	num := new(big.Int).Set(d.Unscaled)
+	den := new(big.Int).Set(o.Unscaled)
+	shift := scale + o.Scale - d.Scale
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil)
+	if shift >= 0 {
+		num.Mul(num, pow)
+	} else {
+		den.Mul(den, pow)
+	}
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 {
+		twice := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2))
+		cmp := twice.Cmp(new(big.Int).Abs(den))
+		if cmp > 0 || (cmp == 0 && quo.Bit(0) == 1) {
+			if num.Sign()*den.Sign() < 0 {
+				quo.Sub(quo, big.NewInt(1))
+			} else {
+				quo.Add(quo, big.NewInt(1))
+			}
+		}
+	}
+
+	result := &Decimal{Unscaled: quo, Scale: scale}
+	return result.trim(maxScale(d, o)), true
+}
+
+// trim は値を変えずに、min 桁を下回らない範囲で末尾の0を取り除く
+func (d *Decimal) trim(min int) *Decimal {
+	ten := big.NewInt(10)
+	unscaled := new(big.Int).Set(d.Unscaled)
+	scale := d.Scale
+	q, r := new(big.Int), new(big.Int)
+	for scale > min {
+		q.QuoRem(unscaled, ten, r)
+		if r.Sign() != 0 {
+			break
+		}
+		unscaled.Set(q)
+		scale--
+	}
+	return &Decimal{Unscaled: unscaled, Scale: scale}
+}
+
+func (d *Decimal) Cmp(o *Decimal) int {
+	scale := maxScale(d, o)
+	return d.rescale(scale).Cmp(o.rescale(scale))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
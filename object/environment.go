@@ -0,0 +1,166 @@
+package object
+
+import (
+	"sort"
+	"sync"
+)
+
+// envPool は Release された環境を取っておき、次の NewEnclosedEnvironment で使い回す
+var envPool = sync.Pool{
+	New: func() interface{} { return NewEnvironment() },
+}
+
+// NewEnclosedEnvironment は outer を外側のスコープとして持つ環境を作る。
+// 関数呼び出しのたびに、関数が定義された環境を outer にして作られる。
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := envPool.Get().(*Environment)
+	env.outer = outer
+	return env
+}
+
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+
+	// captured はクロージャなどから参照されていて、Release しても再利用できないことを表す
+	captured bool
+
+	// poisoned は評価中に panic したことを表す。グローバル環境にだけ付ける
+	poisoned *InternalError
+
+	// compat はどの Monkey と同じに振る舞うか。グローバル環境にだけ付ける
+	compat Compat
+
+	// depth は評価中の関数呼び出しの入れ子の深さ。グローバル環境にだけ付ける
+	depth int
+}
+
+func NewEnvironment() *Environment {
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: nil}
+}
+
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+// Assign は name が束縛されている最も内側の環境で値を置き換える。
+// どこにも束縛されていなければ何もせず false を返す
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+	return false
+}
+
+// Names はこの環境自身に束縛された名前を辞書順で返す。外側の環境は含まない
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VisibleNames はこの環境と外側の環境に束縛された全ての名前を辞書順で返す。
+// 内側で同じ名前を束縛していても1度だけ返す
+func (e *Environment) VisibleNames() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for ; e != nil; e = e.outer {
+		for name := range e.store {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Global は最も外側の環境を返す
+func (e *Environment) Global() *Environment {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+// Delete はこの環境自身から name の束縛を取り除き、取り除いたかどうかを返す
+func (e *Environment) Delete(name string) bool {
+	if _, ok := e.store[name]; !ok {
+		return false
+	}
+	delete(e.store, name)
+	return true
+}
+
+// Capture は e とその外側の環境を、後から参照されうるものとして印を付ける。
+// 関数値のように環境を持ち続けるオブジェクトを作るときに呼ぶ
+func (e *Environment) Capture() {
+	for env := e; env != nil && !env.captured; env = env.outer {
+		env.captured = true
+	}
+}
+
+// Release は使い終わった環境をプールに返す。Capture された環境は返さない
+func (e *Environment) Release() {
+	if e.captured {
+		return
+	}
+	for name := range e.store {
+		delete(e.store, name)
+	}
+	e.outer = nil
+	envPool.Put(e)
+}
+
+// Poison は env のグローバル環境に、評価中に panic したことを記録する
+func (e *Environment) Poison(err *InternalError) {
+	e.Global().poisoned = err
+}
+
+// Poisoned は Poison で記録したエラーを返す。なければ nil
+func (e *Environment) Poisoned() *InternalError {
+	return e.Global().poisoned
+}
+
+// SetCompat は env のグローバル環境で評価するプログラムを c の振る舞いにする。評価を始める前に呼ぶ
+func (e *Environment) SetCompat(c Compat) {
+	e.Global().compat = c
+}
+
+// Compat は SetCompat で設定した振る舞いを返す
+func (e *Environment) Compat() Compat {
+	return e.Global().compat
+}
+
+// EnterCall は関数呼び出しの入れ子を一段深くする。深さが max を超えるときは深くせずに false を返す。
+// true を返したときは、呼び出しが終わったら LeaveCall を呼ぶ
+func (e *Environment) EnterCall(max int) bool {
+	g := e.Global()
+	if g.depth >= max {
+		return false
+	}
+	g.depth++
+	return true
+}
+
+// LeaveCall は EnterCall で深くした入れ子を一段戻す
+func (e *Environment) LeaveCall() {
+	e.Global().depth--
+}
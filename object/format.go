@@ -0,0 +1,146 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+// FormatOptions は Format の書き方。ゼロ値なら Inspect と同じ文字列になる
+type FormatOptions struct {
+	// Indent が空でなければ、配列とハッシュを1要素1行で書き、入れ子1段ごとにこれで字下げする
+	Indent string
+	// MaxDepth が 0 より大きければ、それより深い配列とハッシュを [...] と {...} に省略する
+	MaxDepth int
+	// Color が true なら型ごとに ANSI の色を付ける
+	Color bool
+}
+
+// DisplayFormat は puts, REPL, monkey -e の結果、事後デバッグの REPL が値を書くときの形。
+// 埋め込む側はここを変えて、利用者に見せる値の書き方をまとめて変えられる
+var DisplayFormat FormatOptions
+
+// Formatter は埋め込む側が定義した型の値を書く関数。Format に渡されたのと同じ opts を受け取る
+type Formatter func(obj Object, opts FormatOptions) string
+
+// formatters は RegisterFormatter で登録した関数。型の名前から引く
+var formatters = map[ObjectType]Formatter{}
+
+// RegisterFormatter は Type() が typ を返す値を Format が書くときに fn を使うようにする。
+// Go の値を包んだ独自のオブジェクトを puts や REPL で意味のある形に見せるためのもの。
+// fn が nil なら登録を消す。実行を始める前 (init など) に呼ぶ
+func RegisterFormatter(typ ObjectType, fn Formatter) {
+	if fn == nil {
+		delete(formatters, typ)
+		return
+	}
+	formatters[typ] = fn
+}
+
+const (
+	colorReset  = "\x1b[0m"
+	colorNumber = "\x1b[36m"
+	colorString = "\x1b[32m"
+	colorConst  = "\x1b[33m"
+	colorError  = "\x1b[31m"
+	colorFunc   = "\x1b[35m"
+)
+
+// Format は obj を opts に従って書いた文字列を返す
+func Format(obj Object, opts FormatOptions) string {
+	f := &formatter{opts: opts}
+	f.object(obj, 0)
+	return f.out.String()
+}
+
+type formatter struct {
+	opts FormatOptions
+	out  strings.Builder
+}
+
+// object は obj を書く。depth は obj を囲む配列とハッシュの数
+func (f *formatter) object(obj Object, depth int) {
+	if fn, ok := formatters[obj.Type()]; ok {
+		f.out.WriteString(fn(obj, f.opts))
+		return
+	}
+	switch obj := obj.(type) {
+	case *Array:
+		if f.opts.MaxDepth > 0 && depth >= f.opts.MaxDepth {
+			f.out.WriteString("[...]")
+			return
+		}
+		f.list("[", "]", len(obj.Elements), depth, func(i int) {
+			f.object(obj.Elements[i], depth+1)
+		})
+	case *Hash:
+		if f.opts.MaxDepth > 0 && depth >= f.opts.MaxDepth {
+			f.out.WriteString("{...}")
+			return
+		}
+		// Inspect と同じく、キーと値を書いた文字列の順に並べる
+		pairs := make([]HashPair, 0, len(obj.Pairs))
+		for _, p := range obj.Pairs {
+			pairs = append(pairs, p)
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			return pairs[i].Key.Inspect()+": "+pairs[i].Value.Inspect() <
+				pairs[j].Key.Inspect()+": "+pairs[j].Value.Inspect()
+		})
+		f.list("{", "}", len(pairs), depth, func(i int) {
+			f.object(pairs[i].Key, depth+1)
+			f.out.WriteString(": ")
+			f.object(pairs[i].Value, depth+1)
+		})
+	case *ReturnValue:
+		f.object(obj.Value, depth)
+	case *Integer, *BigInt, *Float, *Decimal:
+		f.colored(colorNumber, obj.Inspect())
+	case *String:
+		f.colored(colorString, obj.Inspect())
+	case *Boolean, *Null:
+		f.colored(colorConst, obj.Inspect())
+	case *Error:
+		f.colored(colorError, obj.Inspect())
+	case *Function, *Macro, *Builtin, *CompiledFunction, *Closure:
+		f.colored(colorFunc, obj.Inspect())
+	default:
+		f.out.WriteString(obj.Inspect())
+	}
+}
+
+// list は n 個の要素を open と close で囲んで書く。要素は elem(i) が書く
+func (f *formatter) list(open, close string, n, depth int, elem func(i int)) {
+	f.out.WriteString(open)
+	if n == 0 {
+		f.out.WriteString(close)
+		return
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			f.out.WriteString(",")
+			if f.opts.Indent == "" {
+				f.out.WriteString(" ")
+			}
+		}
+		if f.opts.Indent != "" {
+			f.out.WriteString("\n")
+			f.out.WriteString(strings.Repeat(f.opts.Indent, depth+1))
+		}
+		elem(i)
+	}
+	if f.opts.Indent != "" {
+		f.out.WriteString("\n")
+		f.out.WriteString(strings.Repeat(f.opts.Indent, depth))
+	}
+	f.out.WriteString(close)
+}
+
+func (f *formatter) colored(color, s string) {
+	if !f.opts.Color {
+		f.out.WriteString(s)
+		return
+	}
+	f.out.WriteString(color)
+	f.out.WriteString(s)
+	f.out.WriteString(colorReset)
+}
@@ -0,0 +1,171 @@
+package object
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/printer"
+)
+
+// heapDump は DumpHeap が書き出す JSON の形。オブジェクトと環境は番号で参照し合うので、
+// 共有や循環 (関数とそれを束縛した環境など) があってもそのまま表せる
+type heapDump struct {
+	Root         int         `json:"root"`
+	Environments []dumpedEnv `json:"environments"`
+	Objects      []dumpedObj `json:"objects"`
+	Summary      dumpSummary `json:"summary"`
+}
+
+type dumpedEnv struct {
+	ID       int            `json:"id"`
+	Outer    int            `json:"outer,omitempty"`
+	Bindings map[string]int `json:"bindings"`
+}
+
+type dumpedObj struct {
+	ID         int          `json:"id"`
+	Type       ObjectType   `json:"type"`
+	Value      *string      `json:"value,omitempty"`
+	Elements   []int        `json:"elements,omitempty"`
+	Pairs      []dumpedPair `json:"pairs,omitempty"`
+	Parameters []string     `json:"parameters,omitempty"`
+	Source     string       `json:"source,omitempty"`
+	Env        int          `json:"env,omitempty"`
+	Fn         int          `json:"fn,omitempty"`
+	Free       []int        `json:"free,omitempty"`
+}
+
+type dumpedPair struct {
+	Key   int `json:"key"`
+	Value int `json:"value"`
+}
+
+type dumpSummary struct {
+	Environments int                `json:"environments"`
+	Objects      int                `json:"objects"`
+	ByType       map[ObjectType]int `json:"byType"`
+}
+
+// DumpHeap は env とそこから辿れる全ての環境とオブジェクトを JSON で w に書き出す。
+// 長く動かしている評価器で何がメモリを使っているかを後から調べるためのもの
+func DumpHeap(w io.Writer, env *Environment) error {
+	d := &dumper{
+		envIDs: map[*Environment]int{},
+		objIDs: map[Object]int{},
+		dump:   heapDump{Summary: dumpSummary{ByType: map[ObjectType]int{}}},
+	}
+	d.dump.Root = d.env(env)
+	d.dump.Summary.Environments = len(d.dump.Environments)
+	d.dump.Summary.Objects = len(d.dump.Objects)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d.dump)
+}
+
+type dumper struct {
+	envIDs map[*Environment]int
+	objIDs map[Object]int
+	dump   heapDump
+}
+
+// env は環境に番号を振って書き出し、その番号を返す。番号は 1 から振り、0 は環境がないことを表す
+func (d *dumper) env(e *Environment) int {
+	if e == nil {
+		return 0
+	}
+	if id, ok := d.envIDs[e]; ok {
+		return id
+	}
+	id := len(d.dump.Environments) + 1
+	d.envIDs[e] = id
+	d.dump.Environments = append(d.dump.Environments, dumpedEnv{ID: id})
+
+	bindings := map[string]int{}
+	for _, name := range e.Names() {
+		bindings[name] = d.object(e.store[name])
+	}
+	outer := d.env(e.outer)
+
+	d.dump.Environments[id-1].Outer = outer
+	d.dump.Environments[id-1].Bindings = bindings
+	return id
+}
+
+// object はオブジェクトに番号を振って書き出し、その番号を返す
+func (d *dumper) object(obj Object) int {
+	if obj == nil {
+		return 0
+	}
+	if id, ok := d.objIDs[obj]; ok {
+		return id
+	}
+	id := len(d.dump.Objects) + 1
+	d.objIDs[obj] = id
+	d.dump.Objects = append(d.dump.Objects, dumpedObj{ID: id, Type: obj.Type()})
+	d.dump.Summary.ByType[obj.Type()]++
+
+	// 子を書き出すと d.dump.Objects が伸びるので、埋めた値は最後にまとめて書き戻す
+	o := dumpedObj{ID: id, Type: obj.Type()}
+	switch obj := obj.(type) {
+	case *Integer, *BigInt, *Float, *Decimal, *String, *Boolean, *Builtin:
+		value := obj.Inspect()
+		o.Value = &value
+	case *Array:
+		o.Elements = make([]int, len(obj.Elements))
+		for i, e := range obj.Elements {
+			o.Elements[i] = d.object(e)
+		}
+	case *Hash:
+		pairs := make([]HashPair, 0, len(obj.Pairs))
+		for _, p := range obj.Pairs {
+			pairs = append(pairs, p)
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+		})
+		for _, p := range pairs {
+			o.Pairs = append(o.Pairs, dumpedPair{Key: d.object(p.Key), Value: d.object(p.Value)})
+		}
+	case *Function:
+		o.Parameters = identifierNames(obj.Parameters)
+		o.Source = printer.Format(&ast.FunctionLiteral{Parameters: obj.Parameters, Body: obj.Body})
+		o.Env = d.env(obj.Env)
+	case *Macro:
+		o.Parameters = identifierNames(obj.Parameters)
+		o.Source = printer.Format(&ast.MacroLiteral{Parameters: obj.Parameters, Body: obj.Body})
+		o.Env = d.env(obj.Env)
+	case *Quote:
+		o.Source = printer.Format(obj.Node)
+	case *CompiledFunction:
+		if obj.Literal != nil {
+			o.Parameters = identifierNames(obj.Literal.Parameters)
+			o.Source = printer.Format(obj.Literal)
+		}
+	case *Closure:
+		o.Fn = d.object(obj.Fn)
+		o.Free = make([]int, len(obj.Free))
+		for i, f := range obj.Free {
+			o.Free[i] = d.object(f)
+		}
+	case *ReturnValue:
+		o.Elements = []int{d.object(obj.Value)}
+	case *Error:
+		value := obj.Message
+		o.Value = &value
+		o.Env = d.env(obj.Env)
+	}
+
+	d.dump.Objects[id-1] = o
+	return id
+}
+
+func identifierNames(idents []*ast.Identifier) []string {
+	names := make([]string, len(idents))
+	for i, ident := range idents {
+		names[i] = ident.Value
+	}
+	return names
+}
@@ -0,0 +1,34 @@
+package object
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// InternalError は評価器や VM の中で起きた Go の panic を変換したもの。
+// 第三者のスクリプトを動かすホストが、インタプリタの不具合でプロセスごと落ちないようにするためのもの
+type InternalError struct {
+	Value interface{} // recover() が返した値
+	Stack []byte      // panic した時点のゴルーチンのスタック
+}
+
+// NewInternalError は recover() の結果から InternalError を作る。deferred 関数の中で呼ぶこと
+func NewInternalError(r interface{}) *InternalError {
+	return &InternalError{Value: r, Stack: debug.Stack()}
+}
+
+func (e *InternalError) Error() string {
+	return fmt.Sprintf("internal error: %v", e.Value)
+}
+
+// PoisonedError は InternalError の後でもう一度実行しようとしたときのエラー。
+// panic の途中で止まった状態は壊れているかもしれないので、同じインスタンスでは続けて実行しない
+type PoisonedError struct {
+	Cause *InternalError
+}
+
+func (e *PoisonedError) Error() string {
+	return "poisoned by an earlier " + e.Cause.Error()
+}
+
+func (e *PoisonedError) Unwrap() error { return e.Cause }
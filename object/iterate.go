@@ -0,0 +1,64 @@
+package object
+
+import "sort"
+
+// Iterator は要素を1つずつ返す。要素がなくなると ok が false になる
+type Iterator interface {
+	Next() (obj Object, ok bool)
+}
+
+// Iterable は要素を順に取り出せるオブジェクトが実装する。配列は要素を、文字列は1文字ずつの
+// 文字列を、ハッシュはキーを表示順に返す。埋め込む側の Go のコレクションも、これを実装すれば
+// len や sort にそのまま渡せる。Iterate は呼ぶたびに先頭から読む Iterator を返す
+type Iterable interface {
+	Iterate() Iterator
+}
+
+// Collect は it の要素を全て読んで配列にする
+func Collect(it Iterable) []Object {
+	var elements []Object
+	iter := it.Iterate()
+	for {
+		obj, ok := iter.Next()
+		if !ok {
+			return elements
+		}
+		elements = append(elements, obj)
+	}
+}
+
+// sliceIterator は読み終えた要素の列を順に返す
+type sliceIterator struct {
+	elements []Object
+	next     int
+}
+
+func (s *sliceIterator) Next() (Object, bool) {
+	if s.next >= len(s.elements) {
+		return nil, false
+	}
+	s.next++
+	return s.elements[s.next-1], true
+}
+
+func (ao *Array) Iterate() Iterator {
+	return &sliceIterator{elements: ao.Elements}
+}
+
+func (s *String) Iterate() Iterator {
+	var chars []Object
+	for _, r := range s.Value {
+		chars = append(chars, &String{Value: string(r)})
+	}
+	return &sliceIterator{elements: chars}
+}
+
+// Iterate は Inspect と同じく、キーを表示の順に返す
+func (h *Hash) Iterate() Iterator {
+	keys := make([]Object, 0, len(h.Pairs))
+	for _, p := range h.Pairs {
+		keys = append(keys, p.Key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Inspect() < keys[j].Inspect() })
+	return &sliceIterator{elements: keys}
+}
@@ -0,0 +1,276 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// 数の型の昇格。型の違う数どうしの演算では、低い方を高い方に揃えてから計算する:
+//
+//	INTEGER → BIGINT → FLOAT
+//	INTEGER → BIGINT → DECIMAL
+//
+// FLOAT と DECIMAL は丸め方が違うので互いには揃えず、組み合わせると型のエラーになる。
+// 整数どうしの演算の結果が int64 に収まらないときは BIGINT にし、BIGINT の結果が
+// int64 に収まれば INTEGER に戻す。
+// 評価器と VM はどちらもここを使うので、昇格の規則とエラーのメッセージはエンジンによらない
+type numericKind int
+
+const (
+	kindInteger numericKind = iota
+	kindBigInt
+	kindFloat
+	kindDecimal
+)
+
+func kindOf(obj Object) (numericKind, bool) {
+	switch obj.(type) {
+	case *Integer:
+		return kindInteger, true
+	case *BigInt:
+		return kindBigInt, true
+	case *Float:
+		return kindFloat, true
+	case *Decimal:
+		return kindDecimal, true
+	default:
+		return 0, false
+	}
+}
+
+// promote は left と right を揃える型を返す。揃えられなければ ok が false
+func promote(left, right Object) (kind numericKind, ok bool) {
+	lk, lok := kindOf(left)
+	rk, rok := kindOf(right)
+	switch {
+	case !lok || !rok:
+		return 0, false
+	case lk == rk:
+		return lk, true
+	case lk <= kindBigInt && rk <= kindBigInt:
+		return kindBigInt, true
+	case rk <= kindBigInt:
+		// 整数はどの型にも揃えられる
+		return lk, true
+	case lk <= kindBigInt:
+		return rk, true
+	default:
+		return 0, false
+	}
+}
+
+// IsNumericPair は left と right が共通の型に揃えられる数の組かどうかを返す
+func IsNumericPair(left, right Object) bool {
+	_, ok := promote(left, right)
+	return ok
+}
+
+func asBig(obj Object) *big.Int {
+	if i, ok := obj.(*Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return obj.(*BigInt).Value
+}
+
+func asFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	}
+	return obj.(*Float).Value
+}
+
+func asDecimal(obj Object) *Decimal {
+	switch obj := obj.(type) {
+	case *Integer:
+		return NewDecimalFromInt(obj.Value)
+	case *BigInt:
+		return &Decimal{Unscaled: new(big.Int).Set(obj.Value), Scale: 0}
+	}
+	return obj.(*Decimal)
+}
+
+// Arith は数の組に算術演算子 op (+ - * /) を適用する。
+// 0 で割ったときのメッセージには、昇格する前の left と right を書く。
+// c.WrapsIntegers() なら整数どうしの演算は BIGINT にならずに桁あふれする
+func Arith(op string, left, right Object, c Compat) (Object, error) {
+	kind, ok := promote(left, right)
+	if !ok {
+		return nil, fmt.Errorf("type mismatch: %s %s %s", left.Type(), op, right.Type())
+	}
+
+	switch kind {
+	case kindInteger:
+		l, r := left.(*Integer).Value, right.(*Integer).Value
+		var result int64
+		ok := true
+		switch op {
+		case "+":
+			result, ok = AddInt(l, r)
+		case "-":
+			result, ok = SubInt(l, r)
+		case "*":
+			result, ok = MulInt(l, r)
+		case "/":
+			if r == 0 {
+				return nil, divisionByZero(left, right)
+			}
+			result, ok = DivInt(l, r)
+		default:
+			return nil, fmt.Errorf("unknown operator: %s %s %s", left.Type(), op, right.Type())
+		}
+		if ok || c.WrapsIntegers() {
+			return &Integer{Value: result}, nil
+		}
+		return bigArith(op, left, right)
+	case kindBigInt:
+		return bigArith(op, left, right)
+	case kindFloat:
+		l, r := asFloat(left), asFloat(right)
+		switch op {
+		case "+":
+			return &Float{Value: l + r}, nil
+		case "-":
+			return &Float{Value: l - r}, nil
+		case "*":
+			return &Float{Value: l * r}, nil
+		case "/":
+			if r == 0 {
+				return nil, divisionByZero(left, right)
+			}
+			return &Float{Value: l / r}, nil
+		}
+	case kindDecimal:
+		l, r := asDecimal(left), asDecimal(right)
+		switch op {
+		case "+":
+			return l.Add(r), nil
+		case "-":
+			return l.Sub(r), nil
+		case "*":
+			return l.Mul(r), nil
+		case "/":
+			quo, ok := l.Quo(r)
+			if !ok {
+				return nil, divisionByZero(left, right)
+			}
+			return quo, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operator: %s %s %s", left.Type(), op, right.Type())
+}
+
+// CompareNumbers は数の組に比較演算子 op (< > == !=) を適用する。
+// 浮動小数点数の NaN は Go と同じく、!= 以外の全ての比較で false になる
+func CompareNumbers(op string, left, right Object) (bool, error) {
+	kind, ok := promote(left, right)
+	if !ok {
+		return false, fmt.Errorf("type mismatch: %s %s %s", left.Type(), op, right.Type())
+	}
+
+	var less, greater, equal bool
+	switch kind {
+	case kindInteger:
+		l, r := left.(*Integer).Value, right.(*Integer).Value
+		less, greater, equal = l < r, l > r, l == r
+	case kindBigInt:
+		c := asBig(left).Cmp(asBig(right))
+		less, greater, equal = c < 0, c > 0, c == 0
+	case kindFloat:
+		l, r := asFloat(left), asFloat(right)
+		less, greater, equal = l < r, l > r, l == r
+	case kindDecimal:
+		c := asDecimal(left).Cmp(asDecimal(right))
+		less, greater, equal = c < 0, c > 0, c == 0
+	}
+
+	switch op {
+	case "<":
+		return less, nil
+	case ">":
+		return greater, nil
+	case "==":
+		return equal, nil
+	case "!=":
+		return !equal, nil
+	default:
+		return false, fmt.Errorf("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	}
+}
+
+// Negate は数の符号を反転する。数でなければエラー。c は Arith と同じ
+func Negate(obj Object, c Compat) (Object, error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		if negated, ok := SubInt(0, obj.Value); ok || c.WrapsIntegers() {
+			return &Integer{Value: negated}, nil
+		}
+		return newInteger(new(big.Int).Neg(big.NewInt(obj.Value))), nil
+	case *BigInt:
+		return newInteger(new(big.Int).Neg(obj.Value)), nil
+	case *Float:
+		return &Float{Value: -obj.Value}, nil
+	case *Decimal:
+		return obj.Neg(), nil
+	default:
+		return nil, fmt.Errorf("unknown operator: -%s", obj.Type())
+	}
+}
+
+// bigArith は整数の組 (INTEGER か BIGINT) を任意精度で計算する。除算は Go の整数と同じく 0 に向けて切り捨てる
+func bigArith(op string, left, right Object) (Object, error) {
+	l, r := asBig(left), asBig(right)
+	result := new(big.Int)
+	switch op {
+	case "+":
+		result.Add(l, r)
+	case "-":
+		result.Sub(l, r)
+	case "*":
+		result.Mul(l, r)
+	case "/":
+		if r.Sign() == 0 {
+			return nil, divisionByZero(left, right)
+		}
+		result.Quo(l, r)
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	}
+	return newInteger(result), nil
+}
+
+// AddInt, SubInt, MulInt, DivInt は int64 の演算をする。結果が int64 に収まらなければ ok が false で、
+// 結果は Go の int64 と同じく桁あふれした値。
+// VM の整数の速い道はこれで確かめ、収まらなければ Arith に任せて BIGINT にする。DivInt の r は 0 でないこと
+func AddInt(l, r int64) (int64, bool) {
+	sum := l + r
+	return sum, (sum > l) == (r > 0)
+}
+
+func SubInt(l, r int64) (int64, bool) {
+	diff := l - r
+	return diff, (diff < l) == (r > 0)
+}
+
+func MulInt(l, r int64) (int64, bool) {
+	if l == 0 || r == 0 {
+		return 0, true
+	}
+	if (l == -1 && r == math.MinInt64) || (r == -1 && l == math.MinInt64) {
+		return l * r, false
+	}
+	product := l * r
+	return product, product/r == l
+}
+
+func DivInt(l, r int64) (int64, bool) {
+	return l / r, l != math.MinInt64 || r != -1
+}
+
+func divisionByZero(left, right Object) error {
+	return fmt.Errorf("division by zero: %s / %s", left.Inspect(), right.Inspect())
+}
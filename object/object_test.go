@@ -0,0 +1,356 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/kurarrr/monkey/ast"
+)
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeyTypesDiffer(t *testing.T) {
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+
+	if one.HashKey() == yes.HashKey() {
+		t.Errorf("integer 1 and true share a hash key")
+	}
+}
+
+func TestHashInspectIsStable(t *testing.T) {
+	h := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, k := range []string{"b", "a", "c"} {
+		key := &String{Value: k}
+		h.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Integer{Value: 1}}
+	}
+
+	for i := 0; i < 10; i++ {
+		if got := h.Inspect(); got != "{a: 1, b: 1, c: 1}" {
+			t.Fatalf("unexpected Inspect output. got=%q", got)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	key := &String{Value: "k"}
+	nested := &Array{Elements: []Object{
+		&Integer{Value: 1},
+		&Array{Elements: []Object{&Boolean{Value: true}}},
+		&Hash{Pairs: map[HashKey]HashPair{key.HashKey(): {Key: key, Value: &Array{}}}},
+	}}
+
+	tests := []struct {
+		obj  Object
+		opts FormatOptions
+		want string
+	}{
+		{nested, FormatOptions{}, nested.Inspect()},
+		{nested, FormatOptions{MaxDepth: 1}, "[1, [...], {...}]"},
+		{nested, FormatOptions{Indent: "  "}, "[\n  1,\n  [\n    true\n  ],\n  {\n    k: []\n  }\n]"},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}, FormatOptions{Color: true},
+			"[\x1b[36m1\x1b[0m, \x1b[32ma\x1b[0m]"},
+		{&ReturnValue{Value: &Null{}}, FormatOptions{Color: true}, "\x1b[33mnull\x1b[0m"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.obj, tt.opts); got != tt.want {
+			t.Errorf("Format(%s, %+v): got=%q, want=%q", tt.obj.Inspect(), tt.opts, got, tt.want)
+		}
+	}
+}
+
+// conn は埋め込む側が定義する、Go の値を包んだオブジェクトの例
+type conn struct{ dsn string }
+
+func (c *conn) Type() ObjectType { return "DB_CONN" }
+func (c *conn) Inspect() string  { return "opaque" }
+
+func TestRegisterFormatter(t *testing.T) {
+	RegisterFormatter("DB_CONN", func(obj Object, opts FormatOptions) string {
+		if opts.Color {
+			return "<conn>"
+		}
+		return "<conn " + obj.(*conn).dsn + ">"
+	})
+	defer RegisterFormatter("DB_CONN", nil)
+
+	arr := &Array{Elements: []Object{&conn{dsn: "pg://db"}}}
+	if got := Format(arr, FormatOptions{}); got != "[<conn pg://db>]" {
+		t.Errorf("wrong output: %q", got)
+	}
+	if got := Format(arr, FormatOptions{Color: true}); got != "[<conn>]" {
+		t.Errorf("options not passed to the formatter: %q", got)
+	}
+
+	var out bytes.Buffer
+	saved := Stdout
+	Stdout = &out
+	defer func() { Stdout = saved }()
+	GetBuiltinByName("puts").Fn(&conn{dsn: "pg://db"})
+	if out.String() != "<conn pg://db>\n" {
+		t.Errorf("puts ignored the formatter: %q", out.String())
+	}
+
+	RegisterFormatter("DB_CONN", nil)
+	if got := Format(&conn{}, FormatOptions{}); got != "opaque" {
+		t.Errorf("formatter not removed: %q", got)
+	}
+}
+
+// rows は埋め込む側が定義する、Go のコレクションを包んだオブジェクトの例
+type rows []int64
+
+func (r rows) Type() ObjectType { return "ROWS" }
+func (r rows) Inspect() string  { return "rows" }
+
+func (r rows) Iterate() Iterator {
+	elements := make([]Object, len(r))
+	for i, v := range r {
+		elements[i] = &Integer{Value: v}
+	}
+	return &sliceIterator{elements: elements}
+}
+
+func TestIterable(t *testing.T) {
+	key := func(s string) *String { return &String{Value: s} }
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, k := range []string{"b", "c", "a"} {
+		hash.Pairs[key(k).HashKey()] = HashPair{Key: key(k), Value: &Null{}}
+	}
+
+	tests := []struct {
+		obj  Iterable
+		want string
+	}{
+		{&Array{Elements: []Object{&Integer{Value: 1}, key("x")}}, "[1, x]"},
+		{key("héllo"), "[h, é, l, l, o]"},
+		{hash, "[a, b, c]"},
+		{&Array{}, "[]"},
+		{rows{3, 1, 2}, "[3, 1, 2]"},
+	}
+	for _, tt := range tests {
+		if got := (&Array{Elements: Collect(tt.obj)}).Inspect(); got != tt.want {
+			t.Errorf("Collect(%s): got=%s, want=%s", tt.obj.(Object).Inspect(), got, tt.want)
+		}
+	}
+
+	// 埋め込む側の型も len と sort に渡せる
+	if got := GetBuiltinByName("len").Fn(rows{3, 1, 2}).Inspect(); got != "3" {
+		t.Errorf("len(rows): got=%s", got)
+	}
+	if got := GetBuiltinByName("sort").Fn(rows{3, 1, 2}).Inspect(); got != "[1, 2, 3]" {
+		t.Errorf("sort(rows): got=%s", got)
+	}
+}
+
+func TestDumpHeap(t *testing.T) {
+	// 関数は自分を束縛した環境を指すので循環する。shared は2か所から参照される
+	global := NewEnvironment()
+	shared := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "two"}}}
+	global.Set("shared", shared)
+	global.Set("again", &Hash{Pairs: map[HashKey]HashPair{
+		(&String{Value: "k"}).HashKey(): {Key: &String{Value: "k"}, Value: shared},
+	}})
+	global.Set("f", &Function{
+		Parameters: []*ast.Identifier{{Value: "x"}},
+		Body:       &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: &ast.Identifier{Value: "x"}}}},
+		Env:        global,
+	})
+	inner := NewEnclosedEnvironment(global)
+	inner.Set("y", &Boolean{Value: true})
+	global.Set("err", &Error{Message: "boom", Env: inner})
+
+	var buf bytes.Buffer
+	if err := DumpHeap(&buf, global); err != nil {
+		t.Fatalf("DumpHeap error: %s", err)
+	}
+	var dump heapDump
+	if err := json.Unmarshal(buf.Bytes(), &dump); err != nil {
+		t.Fatalf("output is not JSON: %s\n%s", err, buf.String())
+	}
+
+	if dump.Root != 1 || len(dump.Environments) != 2 || dump.Environments[1].Outer != 1 {
+		t.Fatalf("wrong environments. root=%d, environments=%+v", dump.Root, dump.Environments)
+	}
+	object := func(id int) dumpedObj {
+		t.Helper()
+		if id < 1 || id > len(dump.Objects) {
+			t.Fatalf("no object %d", id)
+		}
+		return dump.Objects[id-1]
+	}
+
+	bindings := dump.Environments[0].Bindings
+	if arr := object(bindings["shared"]); arr.Type != ARRAY_OBJ || len(arr.Elements) != 2 || *object(arr.Elements[1]).Value != "two" {
+		t.Errorf("wrong array: %+v", arr)
+	}
+	if h := object(bindings["again"]); len(h.Pairs) != 1 || h.Pairs[0].Value != bindings["shared"] {
+		t.Errorf("shared array is not referenced by id: %+v", h)
+	}
+	f := object(bindings["f"])
+	if f.Env != dump.Root || f.Source != "fn(x) {\n\tx;\n}" || len(f.Parameters) != 1 {
+		t.Errorf("wrong function: %+v", f)
+	}
+	if e := object(bindings["err"]); *e.Value != "boom" || e.Env != 2 {
+		t.Errorf("wrong error: %+v", e)
+	}
+
+	if dump.Summary.Objects != len(dump.Objects) || dump.Summary.ByType[STRING_OBJ] != 2 {
+		t.Errorf("wrong summary: %+v", dump.Summary)
+	}
+}
+
+func TestNegate(t *testing.T) {
+	tests := []struct {
+		operand Object
+		want    string // 結果の Inspect、またはエラーのメッセージ
+	}{
+		{&Integer{Value: 5}, "-5"},
+		{&Integer{Value: math.MinInt64 + 1}, "9223372036854775807"},
+		{&Integer{Value: math.MinInt64}, "9223372036854775808"},
+		{&BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 63)}, "-9223372036854775808"},
+		{&Float{Value: 1.5}, "-1.5"},
+		{&Boolean{Value: true}, "unknown operator: -BOOLEAN"},
+	}
+	for _, tt := range tests {
+		result, err := Negate(tt.operand, CompatNone)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.want {
+			t.Errorf("-%s: got=%q, want=%q", tt.operand.Inspect(), got, tt.want)
+		}
+	}
+}
+
+func TestBookWrapsIntegers(t *testing.T) {
+	i := func(v int64) Object { return &Integer{Value: v} }
+
+	tests := []struct {
+		op          string
+		left, right Object
+		want        int64
+	}{
+		{"+", i(math.MaxInt64), i(1), math.MinInt64},
+		{"-", i(math.MinInt64), i(1), math.MaxInt64},
+		{"*", i(math.MaxInt64), i(2), -2},
+		{"*", i(math.MinInt64), i(-1), math.MinInt64},
+		{"/", i(math.MinInt64), i(-1), math.MinInt64},
+	}
+	for _, tt := range tests {
+		result, err := Arith(tt.op, tt.left, tt.right, CompatBook)
+		if err != nil {
+			t.Errorf("%s %s %s: unexpected error %v", tt.left.Inspect(), tt.op, tt.right.Inspect(), err)
+			continue
+		}
+		integer, ok := result.(*Integer)
+		if !ok || integer.Value != tt.want {
+			t.Errorf("%s %s %s: got=%s, want=%d", tt.left.Inspect(), tt.op, tt.right.Inspect(), result.Inspect(), tt.want)
+		}
+	}
+
+	negated, err := Negate(i(math.MinInt64), CompatBook)
+	if err != nil || negated.(*Integer).Value != math.MinInt64 {
+		t.Errorf("-MinInt64: got=%v, %v", negated, err)
+	}
+}
+
+func TestArith(t *testing.T) {
+	i := func(v int64) Object { return &Integer{Value: v} }
+	f := func(v float64) Object { return &Float{Value: v} }
+	b := func(s string) Object {
+		v, _ := new(big.Int).SetString(s, 10)
+		return &BigInt{Value: v}
+	}
+	d := func(s string) Object {
+		dec, err := ParseDecimal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dec
+	}
+
+	tests := []struct {
+		op          string
+		left, right Object
+		want        string // 結果の型と Inspect、またはエラーのメッセージ
+	}{
+		{"+", i(1), i(2), "INTEGER 3"},
+		{"/", i(7), i(2), "INTEGER 3"},
+		{"+", i(1), f(0.5), "FLOAT 1.5"},
+		{"*", f(1.5), i(2), "FLOAT 3.0"},
+		{"+", i(1), d("0.10"), "DECIMAL 1.10"},
+		{"-", d("1.5"), i(1), "DECIMAL 0.5"},
+		{"+", f(1), d("1"), "type mismatch: FLOAT + DECIMAL"},
+		{"/", i(1), i(0), "division by zero: 1 / 0"},
+		{"/", f(1.5), i(0), "division by zero: 1.5 / 0"},
+		{"/", i(1), d("0.00"), "division by zero: 1 / 0.00"},
+		{"%", i(1), i(2), "unknown operator: INTEGER % INTEGER"},
+		// 桁あふれすると BIGINT になり、int64 に収まれば INTEGER に戻る
+		{"+", i(math.MaxInt64), i(1), "BIGINT 9223372036854775808"},
+		{"-", i(math.MinInt64), i(1), "BIGINT -9223372036854775809"},
+		{"*", i(math.MaxInt64), i(2), "BIGINT 18446744073709551614"},
+		{"*", i(math.MinInt64), i(-1), "BIGINT 9223372036854775808"},
+		{"/", i(math.MinInt64), i(-1), "BIGINT 9223372036854775808"},
+		{"-", b("9223372036854775808"), i(1), "INTEGER 9223372036854775807"},
+		{"/", b("18446744073709551616"), i(-3), "INTEGER -6148914691236517205"},
+		{"/", b("18446744073709551616"), i(0), "division by zero: 18446744073709551616 / 0"},
+		{"+", b("9223372036854775808"), f(0.5), "FLOAT 9.223372036854776e+18"},
+		{"+", b("9223372036854775808"), d("0.5"), "DECIMAL 9223372036854775808.5"},
+		{"+", i(math.MaxInt64), i(-1), "INTEGER 9223372036854775806"},
+		{"-", i(-1), i(math.MaxInt64), "INTEGER -9223372036854775808"},
+		{"*", i(-3), i(4), "INTEGER -12"},
+	}
+	for _, tt := range tests {
+		result, err := Arith(tt.op, tt.left, tt.right, CompatNone)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = string(result.Type()) + " " + result.Inspect()
+		}
+		if got != tt.want {
+			t.Errorf("%s %s %s: got=%q, want=%q", tt.left.Inspect(), tt.op, tt.right.Inspect(), got, tt.want)
+		}
+	}
+
+	comparisons := []struct {
+		op          string
+		left, right Object
+		want        bool
+	}{
+		{"<", i(1), f(1.5), true},
+		{"==", i(1), d("1.00"), true},
+		{">", d("0.3"), i(0), true},
+		{"==", f(math.NaN()), f(math.NaN()), false},
+		{"!=", f(math.NaN()), f(math.NaN()), true},
+	}
+	for _, tt := range comparisons {
+		got, err := CompareNumbers(tt.op, tt.left, tt.right)
+		if err != nil || got != tt.want {
+			t.Errorf("%s %s %s: got=%t (%v), want=%t", tt.left.Inspect(), tt.op, tt.right.Inspect(), got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semver は semverCompare が比べるセマンティックバージョン。ビルドメタデータは順序に関係しないので持たない
+type semver struct {
+	core       [3]int64
+	prerelease []string
+}
+
+// parseSemver は "1.2.3", "v1.2.3-rc.1+build.5" のような文字列を読む
+func parseSemver(s string) (semver, bool) {
+	var v semver
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		if !validIdentifiers(s[i+1:]) {
+			return v, false
+		}
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if !validIdentifiers(s[i+1:]) {
+			return v, false
+		}
+		v.prerelease = strings.Split(s[i+1:], ".")
+		for _, id := range v.prerelease {
+			if isNumeric(id) && len(id) > 1 && id[0] == '0' {
+				return v, false
+			}
+		}
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		if !isNumeric(p) || (len(p) > 1 && p[0] == '0') {
+			return v, false
+		}
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return v, false
+		}
+		v.core[i] = n
+	}
+	return v, true
+}
+
+// compareSemver は a が b より前なら -1、同じなら 0、後なら 1 を返す。
+// プレリリースは同じ番号のリリースより前で、識別子ごとに数は数として、それ以外は文字列として比べる
+func compareSemver(a, b semver) int {
+	for i := range a.core {
+		if c := compareInt(a.core[i], b.core[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a.prerelease) == 0 && len(b.prerelease) == 0:
+		return 0
+	case len(a.prerelease) == 0:
+		return 1
+	case len(b.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		x, y := a.prerelease[i], b.prerelease[i]
+		xNum, yNum := isNumeric(x), isNumeric(y)
+		switch {
+		case xNum && yNum:
+			if c := compareInt(int64(len(x)), int64(len(y))); c != 0 {
+				return c
+			}
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		case xNum:
+			return -1
+		case yNum:
+			return 1
+		default:
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(int64(len(a.prerelease)), int64(len(b.prerelease)))
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validIdentifiers は "rc.1" のようなドット区切りの識別子が英数字とハイフンだけでできているか調べる
+func validIdentifiers(s string) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, ch := range id {
+			if !('0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
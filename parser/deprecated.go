@@ -0,0 +1,27 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// deprecatedComment は関数を非推奨にするコメント。関数を束縛する let の直前の行に書く:
+//
+//	// @deprecated "use foo2"
+//	let foo = fn(x) { ... };
+//
+// 理由は文字列リテラルと同じく二重引用符で囲む。評価器は呼び出し箇所ごとに1度警告を出す
+var deprecatedComment = regexp.MustCompile(`^//\s*@deprecated\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// deprecation はコメント comment が @deprecated なら、その理由を返す
+func deprecation(comment string) (string, bool) {
+	m := deprecatedComment.FindStringSubmatch(comment)
+	if m == nil {
+		return "", false
+	}
+	reason, err := strconv.Unquote(m[1])
+	if err != nil {
+		return "", false
+	}
+	return reason, true
+}
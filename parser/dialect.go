@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/token"
+)
+
+// Dialect はキーワードの別名からキーワードへの対応。{"func": "fn", "var": "let"} のように書く。
+// 教育用に、慣れた言語のキーワードや母語のキーワードで書けるようにするためのもの。
+// 別名は元のキーワードと同じトークンになり、元のキーワードもそのまま使える
+type Dialect map[string]string
+
+// SetDialect はこの Parser で使う別名を設定する。nil で別名をやめる。
+// 別名が識別子の形でないか既にキーワードであるとき、対応先がキーワードでないときはエラーを返す
+func (p *Parser) SetDialect(d Dialect) error {
+	aliases := make([]string, 0, len(d))
+	for alias := range d {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	dialect := map[string]token.Token{}
+	for _, alias := range aliases {
+		keyword := d[alias]
+		t := token.LookupIdent(keyword)
+		if t == token.IDENT {
+			return fmt.Errorf("dialect: %q is not a keyword", keyword)
+		}
+		if token.LookupIdent(alias) != token.IDENT {
+			return fmt.Errorf("dialect: alias %q is already a keyword", alias)
+		}
+		if !isIdentifier(alias) {
+			return fmt.Errorf("dialect: alias %q is not an identifier", alias)
+		}
+		dialect[alias] = token.Token{Type: t, Literal: keyword}
+	}
+	p.dialect = dialect
+
+	// New で先読みした2つのトークンにも当てはめる
+	p.curToken = p.applyDialect(p.curToken)
+	p.peekToken = p.applyDialect(p.peekToken)
+	return nil
+}
+
+// applyDialect は別名の識別子をキーワードのトークンに置き換える。位置はそのまま残す
+func (p *Parser) applyDialect(tok token.Token) token.Token {
+	if tok.Type != token.IDENT {
+		return tok
+	}
+	if keyword, ok := p.dialect[tok.Literal]; ok {
+		tok.Type = keyword.Type
+		tok.Literal = keyword.Literal
+	}
+	return tok
+}
+
+func isIdentifier(s string) bool {
+	l := lexer.New(s)
+	tok := l.NextToken()
+	return tok.Type == token.IDENT && tok.Literal == s && l.NextToken().Type == token.EOF
+}
@@ -0,0 +1,19 @@
+package parser
+
+import "strings"
+
+// 関数の説明のコメント。関数を束縛する let の直前に、空行を挟まずに // の行を続けて書く:
+//
+//	// add は a と b の和を返す。
+//	// 整数どうしなら桁あふれしない
+//	let add = fn(a, b) { a + b };
+//
+// doc 組み込み関数がこの説明を返す。@deprecated の行とコードの後ろに書いたコメントは含めない
+
+// docLine はコメント comment が // の行なら、// と直後の空白1つを除いた中身を返す
+func docLine(comment string) (string, bool) {
+	if !strings.HasPrefix(comment, "//") {
+		return "", false
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(comment, "//"), " "), true
+}
@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/kurarrr/monkey/logging"
+	"github.com/kurarrr/monkey/token"
+)
+
+// ParseError は位置情報付きの構文エラー
+type ParseError struct {
+	Msg  string
+	Line int
+	Col  int
+	// Offset は0始まりのバイトオフセット。token.File と合わせて使う
+	Offset int
+	// Code は diag の一覧にあるエラーのコード
+	Code string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("parse error at %d:%d: %s", e.Line, e.Col, e.Msg)
+}
+
+func (p *Parser) addError(code string, tok token.Token, format string, a ...interface{}) {
+	err := ParseError{
+		Msg:    fmt.Sprintf(format, a...),
+		Line:   tok.Line,
+		Col:    tok.Column,
+		Offset: tok.Offset,
+		Code:   code,
+	}
+	p.errors = append(p.errors, err)
+	logging.Debug("parser: syntax error", "code", code, "line", err.Line, "column", err.Col, "msg", err.Msg)
+}
+
+// ErrorMessages は位置情報を含まないエラーメッセージを返す。
+// Errors が []string を返していた頃の呼び出し側のために残している。
+func (p *Parser) ErrorMessages() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Msg
+	}
+	return msgs
+}
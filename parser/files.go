@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"io/fs"
+	"strings"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/token"
+)
+
+// FileError は ParseFiles が見つけた構文エラー
+type FileError struct {
+	Pos token.Position
+	ParseError
+}
+
+func (e FileError) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// ErrorList は ParseFiles が見つけた全ての構文エラー
+type ErrorList []FileError
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ParseFiles は fsys の paths を順に構文解析し、1つの FileSet を共有する Package にまとめる。
+// 読めないファイルがあればそのエラーを返す。構文エラーがあれば全てのファイルを解析した上で
+// Package と ErrorList を返すので、呼び出し側はエラーのあるファイルも調べられる
+func ParseFiles(fsys fs.FS, paths []string) (*ast.Package, error) {
+	pkg := &ast.Package{Fset: token.NewFileSet()}
+	var errors ErrorList
+	for _, path := range paths {
+		f, err := fsys.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		file := pkg.Fset.AddFile(path, 0)
+		l := lexer.NewFile(file, f)
+		p := New(l)
+		program := p.ParseProgram()
+		f.Close()
+		if err := l.Err(); err != nil {
+			return nil, &fs.PathError{Op: "read", Path: path, Err: err}
+		}
+
+		for _, err := range p.Errors() {
+			errors = append(errors, FileError{Pos: file.Position(file.Pos(err.Offset)), ParseError: err})
+		}
+		pkg.Files = append(pkg.Files, &ast.File{Path: path, File: file, Program: program})
+	}
+	if len(errors) > 0 {
+		return pkg, errors
+	}
+	return pkg, nil
+}
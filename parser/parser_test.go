@@ -1,7 +1,15 @@
 package parser
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/kurarrr/monkey/ast"
 	"github.com/kurarrr/monkey/lexer"
@@ -53,8 +61,8 @@ func checkParserErrors(t *testing.T, p *Parser) {
 		return
 	}
 	t.Errorf("parser has %d errors", len(errors))
-	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+	for _, err := range errors {
+		t.Errorf("parser error: %q", err.Error())
 	}
 	t.FailNow()
 }
@@ -161,6 +169,1224 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "3.25;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 3.25 {
+		t.Errorf("literal.Value not %v. got=%v", 3.25, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.25" {
+		t.Errorf("literal.TokenLiteral not %q. got=%q", "3.25", literal.TokenLiteral())
+	}
+}
+
+func TestBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true;", true},
+		{"false;", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has not enough statements. got=%d",
+				len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		boolean, ok := stmt.Expression.(*ast.Boolean)
+		if !ok {
+			t.Fatalf("exp not *ast.Boolean. got=%T", stmt.Expression)
+		}
+		if boolean.Value != tt.expected {
+			t.Errorf("boolean.Value not %t. got=%t", tt.expected, boolean.Value)
+		}
+	}
+}
+
+func TestParsingPrefixExpressions(t *testing.T) {
+	prefixTests := []struct {
+		input    string
+		operator string
+		value    interface{}
+	}{
+		{"!5;", "!", 5},
+		{"-15;", "-", 15},
+		{"!foobar;", "!", "foobar"},
+		{"-foobar;", "-", "foobar"},
+		{"!true;", "!", true},
+		{"!false;", "!", false},
+	}
+
+	for _, tt := range prefixTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d",
+				1, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+		exp, ok := stmt.Expression.(*ast.PrefixExpression)
+		if !ok {
+			t.Fatalf("stmt is not ast.PrefixExpression. got=%T", stmt.Expression)
+		}
+		if exp.Operator != tt.operator {
+			t.Fatalf("exp.Operator is not '%s'. got=%s", tt.operator, exp.Operator)
+		}
+		if !testLiteralExpression(t, exp.Right, tt.value) {
+			return
+		}
+	}
+}
+
+func TestParsingInfixExpressions(t *testing.T) {
+	infixTests := []struct {
+		input      string
+		leftValue  interface{}
+		operator   string
+		rightValue interface{}
+	}{
+		{"5 + 5;", 5, "+", 5},
+		{"5 - 5;", 5, "-", 5},
+		{"5 * 5;", 5, "*", 5},
+		{"5 / 5;", 5, "/", 5},
+		{"5 > 5;", 5, ">", 5},
+		{"5 < 5;", 5, "<", 5},
+		{"5 == 5;", 5, "==", 5},
+		{"5 != 5;", 5, "!=", 5},
+		{"foobar + barfoo;", "foobar", "+", "barfoo"},
+		{"true == true", true, "==", true},
+		{"true != false", true, "!=", false},
+	}
+
+	for _, tt := range infixTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d",
+				1, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+		if !testInfixExpression(t, stmt.Expression, tt.leftValue, tt.operator, tt.rightValue) {
+			return
+		}
+	}
+}
+
+func TestOperatorPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-a * b", "((-a) * b)"},
+		{"!-a", "(!(-a))"},
+		{"a + b + c", "((a + b) + c)"},
+		{"a + b - c", "((a + b) - c)"},
+		{"a * b * c", "((a * b) * c)"},
+		{"a * b / c", "((a * b) / c)"},
+		{"a + b / c", "(a + (b / c))"},
+		{"a + b * c + d / e - f", "(((a + (b * c)) + (d / e)) - f)"},
+		{"3 + 4; -5 * 5", "(3 + 4)((-5) * 5)"},
+		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
+		{"5 < 4 != 3 > 4", "((5 < 4) != (3 > 4))"},
+		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
+		{"1 + 2 * 3 == 7", "((1 + (2 * 3)) == 7)"},
+		{"true", "true"},
+		{"3 > 5 == false", "((3 > 5) == false)"},
+		{"1 + (2 + 3) + 4", "((1 + (2 + 3)) + 4)"},
+		{"(5 + 5) * 2", "((5 + 5) * 2)"},
+		{"2 / (5 + 5)", "(2 / (5 + 5))"},
+		{"-(5 + 5)", "(-(5 + 5))"},
+		{"!(true == true)", "(!(true == true))"},
+		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
+		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
+		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	input := `if (x < y) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statements. got=%d", len(exp.Consequence.Statements))
+	}
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Consequence.Statements[0])
+	}
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative.Statements was not nil. got=%+v", exp.Alternative)
+	}
+}
+
+func TestAssignStatements(t *testing.T) {
+	input := `x = x + 1; y = 5`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			2, len(program.Statements))
+	}
+
+	tests := []struct {
+		expectedIdentifier string
+		expectedValue      string
+	}{
+		{"x", "(x + 1)"},
+		{"y", "5"},
+	}
+
+	for i, tt := range tests {
+		stmt, ok := program.Statements[i].(*ast.AssignStatement)
+		if !ok {
+			t.Fatalf("program.Statements[%d] is not ast.AssignStatement. got=%T",
+				i, program.Statements[i])
+		}
+		if stmt.TokenLiteral() != "=" {
+			t.Errorf("stmt.TokenLiteral not '='. got=%q", stmt.TokenLiteral())
+		}
+		if !testIdentifier(t, stmt.Name, tt.expectedIdentifier) {
+			return
+		}
+		if stmt.Value.String() != tt.expectedValue {
+			t.Errorf("stmt.Value wrong. want=%q, got=%q", tt.expectedValue, stmt.Value.String())
+		}
+	}
+}
+
+func TestWhileExpression(t *testing.T) {
+	input := `while (x < y) { x = x + 1; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.WhileExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.WhileExpression. got=%T", stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	if len(exp.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d", len(exp.Body.Statements))
+	}
+	if _, ok := exp.Body.Statements[0].(*ast.AssignStatement); !ok {
+		t.Fatalf("Statements[0] is not ast.AssignStatement. got=%T", exp.Body.Statements[0])
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	input := `if (x < y) { x } else { y }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Consequence.Statements[0])
+	}
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+	if len(exp.Alternative.Statements) != 1 {
+		t.Errorf("exp.Alternative.Statements does not contain 1 statements. got=%d",
+			len(exp.Alternative.Statements))
+	}
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Alternative.Statements[0])
+	}
+	if !testIdentifier(t, alternative.Expression, "y") {
+		return
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d",
+			len(function.Parameters))
+	}
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d",
+			len(function.Body.Statements))
+	}
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T",
+			function.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T", stmt.Expression)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d",
+			len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d",
+			len(macro.Body.Statements))
+	}
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingEmptyArrayLiterals(t *testing.T) {
+	input := "[]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	expected := map[string]int64{
+		"one":   1,
+		"two":   2,
+		"three": 3,
+	}
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+		}
+		expectedValue := expected[literal.String()]
+		testIntegerLiteral(t, pair.Value, expectedValue)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	input := "{}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsMixedKeys(t *testing.T) {
+	input := `{"key": 0 + 1, 1: true, false: 10 - 8}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for _, pair := range hash.Pairs {
+		value := pair.Value
+		switch key := pair.Key.(type) {
+		case *ast.StringLiteral:
+			testInfixExpression(t, value, 0, "+", 1)
+		case *ast.IntegerLiteral:
+			testBooleanLiteral(t, value, true)
+		case *ast.Boolean:
+			testInfixExpression(t, value, 10, "-", 8)
+		default:
+			t.Errorf("unexpected key type %T", key)
+		}
+	}
+}
+
+func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
+	integ, ok := il.(*ast.IntegerLiteral)
+	if !ok {
+		t.Errorf("il not *ast.IntegerLiteral. got=%T", il)
+		return false
+	}
+	if integ.Value != value {
+		t.Errorf("integ.Value not %d. got=%d", value, integ.Value)
+		return false
+	}
+	if integ.TokenLiteral() != fmt.Sprintf("%d", value) {
+		t.Errorf("integ.TokenLiteral not %d. got=%s", value, integ.TokenLiteral())
+		return false
+	}
+	return true
+}
+
+func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		t.Errorf("exp not *ast.Identifier. got=%T", exp)
+		return false
+	}
+	if ident.Value != value {
+		t.Errorf("ident.Value not %s. got=%s", value, ident.Value)
+		return false
+	}
+	if ident.TokenLiteral() != value {
+		t.Errorf("ident.TokenLiteral not %s. got=%s", value, ident.TokenLiteral())
+		return false
+	}
+	return true
+}
+
+func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
+	bo, ok := exp.(*ast.Boolean)
+	if !ok {
+		t.Errorf("exp not *ast.Boolean. got=%T", exp)
+		return false
+	}
+	if bo.Value != value {
+		t.Errorf("bo.Value not %t. got=%t", value, bo.Value)
+		return false
+	}
+	return true
+}
+
+func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{}) bool {
+	switch v := expected.(type) {
+	case int:
+		return testIntegerLiteral(t, exp, int64(v))
+	case int64:
+		return testIntegerLiteral(t, exp, v)
+	case string:
+		return testIdentifier(t, exp, v)
+	case bool:
+		return testBooleanLiteral(t, exp, v)
+	}
+	t.Errorf("type of exp not handled. got=%T", exp)
+	return false
+}
+
+func testInfixExpression(t *testing.T, exp ast.Expression, left interface{},
+	operator string, right interface{}) bool {
+
+	opExp, ok := exp.(*ast.InfixExpression)
+	if !ok {
+		t.Errorf("exp is not ast.InfixExpression. got=%T(%s)", exp, exp)
+		return false
+	}
+	if !testLiteralExpression(t, opExp.Left, left) {
+		return false
+	}
+	if opExp.Operator != operator {
+		t.Errorf("exp.Operator is not '%s'. got=%q", operator, opExp.Operator)
+		return false
+	}
+	if !testLiteralExpression(t, opExp.Right, right) {
+		return false
+	}
+	return true
+}
+
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
+
+func TestParseErrorPositions(t *testing.T) {
+	input := `let x = 5;
+let y = (1 + 2;
+let = 3;
+let z = @;
+99999999999999999999;`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	expected := []ParseError{
+		{Msg: "expected next token to be ), got ; instead", Line: 2, Col: 15, Offset: 25, Code: "E1001"},
+		{Msg: "expected next token to be IDENT, got = instead", Line: 3, Col: 5, Offset: 31, Code: "E1001"},
+		{Msg: "no prefix parse function for = found", Line: 3, Col: 5, Offset: 31, Code: "E1002"},
+		{Msg: "no prefix parse function for ILLEGAL found", Line: 4, Col: 9, Offset: 44, Code: "E1004"},
+		{Msg: "could not parse \"99999999999999999999\" as integer", Line: 5, Col: 1, Offset: 47, Code: "E1003"},
+	}
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d (%v)", len(expected), len(errors), errors)
+	}
+	for i, want := range expected {
+		if errors[i] != want {
+			t.Errorf("errors[%d] wrong. want=%+v, got=%+v", i, want, errors[i])
+		}
+	}
+
+	rendered := "parse error at 2:15: expected next token to be ), got ; instead"
+	if errors[0].Error() != rendered {
+		t.Errorf("Error() wrong. want=%q, got=%q", rendered, errors[0].Error())
+	}
+	if msgs := p.ErrorMessages(); msgs[1] != expected[1].Msg {
+		t.Errorf("ErrorMessages()[1] wrong. want=%q, got=%q", expected[1].Msg, msgs[1])
+	}
+}
+
+// tortureTests は壊れた入力や極端な入力を手で集めた回帰の表。エラーのメッセージまで固定する。
+// 生成した入力は TestParserGenerated と FuzzParser で試す
+var tortureTests = []struct {
+	name           string
+	input          string
+	expectedErrors []string
+}{
+	{"empty", "", []string{}},
+	{"nul byte", "\x00", []string{}},
+	{"deep prefix nesting", strings.Repeat("-", 10000) + "1;", []string{}},
+	{"deep bang nesting", strings.Repeat("!", 10000) + "x;", []string{}},
+	{"many statements", strings.Repeat("let x = 1;\n", 1000), []string{}},
+	{"giant integer", "99999999999999999999;", []string{
+		`could not parse "99999999999999999999" as integer`,
+	}},
+	{"giant negative integer", "-99999999999999999999;", []string{
+		`could not parse "99999999999999999999" as integer`,
+	}},
+	{"unterminated let", "let", []string{
+		"expected next token to be IDENT, got EOF instead",
+	}},
+	{"let without assign", "let x", []string{
+		"expected next token to be =, got EOF instead",
+	}},
+	{"let without value", "let x =", []string{
+		"no prefix parse function for EOF found",
+	}},
+	{"let without semicolon", "let x = 5", []string{}},
+	{"return without semicolon", "return 5", []string{}},
+	{"bare return", "return", []string{
+		"no prefix parse function for EOF found",
+	}},
+	{"dangling prefix", "-", []string{
+		"no prefix parse function for EOF found",
+	}},
+	{"deep dangling prefix", strings.Repeat("!", 10000), []string{
+		"no prefix parse function for EOF found",
+	}},
+	{"let without name", "let = 5;", []string{
+		"expected next token to be IDENT, got = instead",
+		"no prefix parse function for = found",
+	}},
+	{"let with missing assign", "let x 5;", []string{
+		"expected next token to be =, got INT instead",
+	}},
+	{"unterminated group", "(1 + (2", []string{
+		"expected next token to be ), got EOF instead",
+		"expected next token to be ), got EOF instead",
+	}},
+	{"deep grouping", strings.Repeat("(", 5000) + "1" + strings.Repeat(")", 5000), []string{}},
+	{"dangling infix", "1 +", []string{
+		"no prefix parse function for EOF found",
+	}},
+	{"unterminated block", "if (x) { let y = 1;", []string{
+		"expected next token to be }, got EOF instead",
+	}},
+	{"unterminated parameters", "fn(x, y", []string{
+		"expected next token to be ), got EOF instead",
+		"expected next token to be {, got EOF instead",
+	}},
+	{"unterminated call", "add(1, 2", []string{
+		"expected next token to be ), got EOF instead",
+	}},
+	{"deeply nested calls", strings.Repeat("f(", 2000) + strings.Repeat(")", 2000), []string{}},
+	{"unterminated string", `let s = "abc`, []string{
+		"no prefix parse function for ILLEGAL found",
+	}},
+	{"unterminated array", "[1, 2", []string{
+		"expected next token to be ], got EOF instead",
+	}},
+	{"unterminated index", "a[1", []string{
+		"expected next token to be ], got EOF instead",
+	}},
+	{"deeply nested arrays", strings.Repeat("[", 2000) + strings.Repeat("]", 2000), []string{}},
+	{"unterminated hash", `{"a": 1`, []string{
+		"expected next token to be ,, got EOF instead",
+	}},
+	{"hash missing colon", `{"a" 1}`, []string{
+		"expected next token to be :, got INT instead",
+		"no prefix parse function for } found",
+	}},
+	{"lone semicolons", "; ;", []string{
+		"no prefix parse function for ; found",
+	}},
+	{"unicode identifier", "let 変数 = 1; 変数;", []string{}},
+	{"non-letter symbol", "let § = 1;", []string{
+		"expected next token to be IDENT, got ILLEGAL instead",
+		"no prefix parse function for ILLEGAL found",
+		"no prefix parse function for = found",
+	}},
+}
+
+func TestParserTorture(t *testing.T) {
+	for _, tt := range tortureTests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("parser panicked on %q: %v", tt.input, r)
+				}
+			}()
+			p := New(lexer.New(tt.input))
+			p.ParseProgram()
+			errors := p.ErrorMessages()
+			if len(errors) != len(tt.expectedErrors) {
+				t.Fatalf("wrong number of errors. want=%d, got=%d (%q)",
+					len(tt.expectedErrors), len(errors), errors)
+			}
+			for i, msg := range tt.expectedErrors {
+				if errors[i] != msg {
+					t.Errorf("errors[%d] wrong. want=%q, got=%q", i, msg, errors[i])
+				}
+			}
+		})
+	}
+}
+
+// generateExpression は深さ depth までの式をランダムに作り、ソースと、構文解析した式の String() が
+// 返すはずの文字列を返す。中置演算子のソースは括弧で囲むので、優先順位によらず形が決まる
+func generateExpression(r *rand.Rand, depth int) (src, want string) {
+	if depth == 0 {
+		switch r.Intn(3) {
+		case 0:
+			n := strconv.Itoa(r.Intn(1000))
+			return n, n
+		case 1:
+			name := []string{"x", "fooBar", "変数", "_"}[r.Intn(4)]
+			return name, name
+		default:
+			return "true", "true"
+		}
+	}
+
+	switch r.Intn(6) {
+	case 0:
+		op := []string{"-", "!"}[r.Intn(2)]
+		s, w := generateExpression(r, depth-1)
+		return op + s, "(" + op + w + ")"
+	case 1:
+		op := []string{"+", "-", "*", "/", "<", ">", "==", "!="}[r.Intn(8)]
+		ls, lw := generateExpression(r, depth-1)
+		rs, rw := generateExpression(r, depth-1)
+		return "(" + ls + " " + op + " " + rs + ")", "(" + lw + " " + op + " " + rw + ")"
+	case 2, 3:
+		srcs, wants := generateList(r, depth-1)
+		if r.Intn(2) == 0 {
+			return "[" + srcs + "]", "[" + wants + "]"
+		}
+		return "f(" + srcs + ")", "f(" + wants + ")"
+	default:
+		ls, lw := generateExpression(r, depth-1)
+		is, iw := generateExpression(r, depth-1)
+		return "(" + ls + ")[" + is + "]", "(" + lw + "[" + iw + "])"
+	}
+}
+
+// generateList は generateExpression で 0 から 3 個の式を作り、, で区切って返す
+func generateList(r *rand.Rand, depth int) (src, want string) {
+	var srcs, wants []string
+	for i := r.Intn(4); i > 0; i-- {
+		s, w := generateExpression(r, depth)
+		srcs = append(srcs, s)
+		wants = append(wants, w)
+	}
+	return strings.Join(srcs, ","), strings.Join(wants, ", ")
+}
+
+// TestParserGenerated はランダムに作った正しい式が正しく組み立てられることと、
+// それを途中で切った壊れた入力で panic しないことを確かめる。種は固定なので毎回同じ入力になる
+func TestParserGenerated(t *testing.T) {
+	r := rand.New(rand.NewSource(491))
+	for i := 0; i < 300; i++ {
+		src, want := generateExpression(r, 1+r.Intn(6))
+
+		p := New(lexer.New(src))
+		program := p.ParseProgram()
+		if errs := p.ErrorMessages(); len(errs) != 0 {
+			t.Fatalf("%q: unexpected errors: %q", src, errs)
+		}
+		if got := program.String(); got != want {
+			t.Fatalf("%q: wrong program. want=%q, got=%q", src, want, got)
+		}
+
+		for _, cut := range []int{r.Intn(len(src) + 1), r.Intn(len(src) + 1)} {
+			parseWithoutPanic(t, src[:cut])
+		}
+	}
+}
+
+// FuzzParser は go test -fuzz=FuzzParser で入力を変えながら、panic しないことと、
+// 同じ入力から同じエラーが出ることを確かめる。種は tortureTests と生成した式
+func FuzzParser(f *testing.F) {
+	for _, tt := range tortureTests {
+		f.Add(tt.input)
+	}
+	r := rand.New(rand.NewSource(491))
+	for i := 0; i < 20; i++ {
+		src, _ := generateExpression(r, 4)
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		first := parseWithoutPanic(t, src)
+		second := parseWithoutPanic(t, src)
+		if strings.Join(first, "\n") != strings.Join(second, "\n") {
+			t.Errorf("%q: errors not stable.\nfirst =%q\nsecond=%q", src, first, second)
+		}
+	})
+}
+
+// parseWithoutPanic は src を構文解析してエラーのメッセージを返す。panic したらテストを失敗させる
+func parseWithoutPanic(t *testing.T, src string) (errs []string) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("parser panicked on %q: %v", src, r)
+		}
+	}()
+	p := New(lexer.New(src))
+	p.ParseProgram()
+	return p.ErrorMessages()
+}
+
+func TestTracing(t *testing.T) {
+	var out bytes.Buffer
+
+	p := New(lexer.New("-1 + 2;"))
+	p.SetTracing(&out)
+	p.ParseProgram()
+
+	expected := `BEGIN parseExpressionStatement (-)
+	BEGIN parseExpression (-)
+		BEGIN parsePrefixExpression (-)
+			BEGIN parseExpression (1)
+				BEGIN parseIntegerLiteral (1)
+				END parseIntegerLiteral
+			END parseExpression
+		END parsePrefixExpression
+		BEGIN parseInfixExpression (+)
+			BEGIN parseExpression (2)
+				BEGIN parseIntegerLiteral (2)
+				END parseIntegerLiteral
+			END parseExpression
+		END parseInfixExpression
+	END parseExpression
+END parseExpressionStatement
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+
+	// トレースを有効にしない限り何も書き出さない
+	p = New(lexer.New("-1 + 2;"))
+	p.ParseProgram()
+	if p.traceOut != nil || p.traceLevel != 0 {
+		t.Errorf("tracing should be disabled by default")
+	}
+}
+
+func TestDeprecatedComment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// @deprecated \"use foo2\"\nlet foo = fn(x) { x };", "use foo2"},
+		{"//@deprecated   \"say \\\"hi\\\"\"  \nlet foo = fn() { 1 };", `say "hi"`},
+		// 理由のない @deprecated や、間に文がある場合は付かない
+		{"// @deprecated\nlet foo = fn(x) { x };", ""},
+		{"// @deprecated \"old\"\nlet a = 1;\nlet foo = fn(x) { x };", ""},
+		{"// ordinary comment\nlet foo = fn(x) { x };", ""},
+		{"/* @deprecated \"old\" */ let foo = fn(x) { x };", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[len(program.Statements)-1].(*ast.LetStatement)
+		fl := stmt.Value.(*ast.FunctionLiteral)
+		if fl.Deprecated != tt.expected {
+			t.Errorf("%q: wrong reason. want=%q, got=%q", tt.input, tt.expected, fl.Deprecated)
+		}
+	}
+}
+
+func TestDocComment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// add は和を返す\nlet add = fn(a, b) { a + b };", "add は和を返す"},
+		{"//  two\n//lines\n//\n// end\nlet f = fn() { 1 };", " two\nlines\n\nend"},
+		// @deprecated の行は説明に含めない
+		{"// old one\n// @deprecated \"use g\"\nlet f = fn() { 1 };", "old one"},
+		// 空行やブロックコメントで切れたコメント、コードの後ろのコメントは付かない
+		{"// far\n\nlet f = fn() { 1 };", ""},
+		{"// first\n\n// second\nlet f = fn() { 1 };", "second"},
+		{"// a\n/* b */\nlet f = fn() { 1 };", ""},
+		{"let a = 1; // trailing\nlet f = fn() { 1 };", ""},
+		{"// for a\nlet a = 1;\nlet f = fn() { 1 };", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[len(program.Statements)-1].(*ast.LetStatement)
+		fl := stmt.Value.(*ast.FunctionLiteral)
+		if fl.Doc != tt.expected {
+			t.Errorf("%q: wrong doc. want=%q, got=%q", tt.input, tt.expected, fl.Doc)
+		}
+	}
+}
+
+func TestDialect(t *testing.T) {
+	dialect := Dialect{"func": "fn", "var": "let", "関数": "fn", "もし": "if", "でなければ": "else"}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var add = func(a, b) { a + b };", "let add = fn<add>(a, b) (a + b);"},
+		// 元のキーワードもそのまま使える
+		{"let f = fn(x) { x };", "let f = fn<f>(x) x;"},
+		{"var 大きい方 = 関数(a, b) { もし (a > b) { a } でなければ { b } };", "let 大きい方 = fn<大きい方>(a, b) if(a > b) aelse b;"},
+		// 別名の一部を含む名前は識別子のまま
+		{"var funcs = 1;", "let funcs = 1;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		if err := p.SetDialect(dialect); err != nil {
+			t.Fatalf("SetDialect error: %s", err)
+		}
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// 別名を設定しない Parser では別名は識別子
+	program := New(lexer.New("var x = 1;")).ParseProgram()
+	if _, ok := program.Statements[0].(*ast.LetStatement); ok {
+		t.Errorf("expected var to be an identifier without a dialect")
+	}
+}
+
+func TestDialectErrors(t *testing.T) {
+	tests := []struct {
+		dialect  Dialect
+		expected string
+	}{
+		{Dialect{"func": "function"}, `dialect: "function" is not a keyword`},
+		{Dialect{"if": "fn"}, `dialect: alias "if" is already a keyword`},
+		{Dialect{"1st": "let"}, `dialect: alias "1st" is not an identifier`},
+		{Dialect{"my fn": "fn"}, `dialect: alias "my fn" is not an identifier`},
+	}
+
+	for _, tt := range tests {
+		err := New(lexer.New("")).SetDialect(tt.dialect)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %v. want=%q, got=%v", tt.dialect, tt.expected, err)
+		}
+	}
+}
+
+func TestNewFromTokens(t *testing.T) {
+	// include("lib") をライブラリのトークン列に置き換えるプリプロセッサ
+	lib := lexer.Tokens("let double = fn(x) { x * 2 };")
+	lib = lib[:len(lib)-1] // EOF を除く
+
+	var tokens []token.Token
+	src := lexer.Tokens(`include("lib"); double(21);`)
+	for i := 0; i < len(src); i++ {
+		if src[i].Literal == "include" && i+4 < len(src) && src[i+4].Type == token.SEMICOLON {
+			tokens = append(tokens, lib...)
+			i += 4
+			continue
+		}
+		tokens = append(tokens, src[i])
+	}
+
+	p := NewFromTokens(tokens)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if want := "let double = fn<double>(x) (x * 2);double(21)"; program.String() != want {
+		t.Errorf("wrong program. want=%q, got=%q", want, program.String())
+	}
+
+	// EOF で終わっていない列は最後のトークンの位置で終わる
+	p = NewFromTokens([]token.Token{
+		{Type: token.LET, Literal: "let", Line: 3, Column: 1},
+		{Type: token.IDENT, Literal: "x", Line: 3, Column: 5},
+	})
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected a parse error")
+	}
+	if errors[0].Line != 3 || errors[0].Col != 5 {
+		t.Errorf("wrong error position. got=%d:%d", errors[0].Line, errors[0].Col)
+	}
+
+	if program := NewFromTokens(nil).ParseProgram(); len(program.Statements) != 0 {
+		t.Errorf("expected an empty program. got=%q", program.String())
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/math.monkey": {Data: []byte("let double = fn(x) { x * 2 };\nlet half = fn(x) { x / 2 };\n")},
+		"main.monkey":     {Data: []byte("puts(double(21));\n")},
+		"bad.monkey":      {Data: []byte("let x = 1;\nlet = 2;\n")},
+	}
+
+	pkg, err := ParseFiles(fsys, []string{"lib/math.monkey", "main.monkey"})
+	if err != nil {
+		t.Fatalf("ParseFiles error: %s", err)
+	}
+	if len(pkg.Files) != 2 {
+		t.Fatalf("wrong number of files. got=%d", len(pkg.Files))
+	}
+	if pkg.Files[0].Path != "lib/math.monkey" || len(pkg.Files[0].Program.Statements) != 2 {
+		t.Errorf("wrong first file: %s %q", pkg.Files[0].Path, pkg.Files[0].Program.String())
+	}
+	if pkg.Files[1].Program.String() != "puts(double(21))" {
+		t.Errorf("wrong second file: %q", pkg.Files[1].Program.String())
+	}
+	// 2つ目のファイルの位置は FileSet の中で1つ目と重ならない
+	main := pkg.Files[1]
+	if got := pkg.Fset.Position(main.File.Pos(5)).String(); got != "main.monkey:1:6" {
+		t.Errorf("wrong position. got=%q", got)
+	}
+	if got := pkg.Fset.Position(pkg.Files[0].File.Pos(30)).String(); got != "lib/math.monkey:2:1" {
+		t.Errorf("wrong position. got=%q", got)
+	}
+
+	pkg, err = ParseFiles(fsys, []string{"main.monkey", "bad.monkey"})
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected ErrorList. got=%T (%v)", err, err)
+	}
+	want := "bad.monkey:2:5: expected next token to be IDENT, got = instead\nbad.monkey:2:5: no prefix parse function for = found"
+	if list.Error() != want {
+		t.Errorf("wrong errors. want=%q, got=%q", want, list.Error())
+	}
+	if len(pkg.Files) != 2 {
+		t.Errorf("expected files with errors to be returned. got=%d", len(pkg.Files))
+	}
+
+	if _, err := ParseFiles(fsys, []string{"missing.monkey"}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist. got=%v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const traceIdentPlaceholder string = "\t"
+
+// SetTracing は構文解析関数の呼び出しを字下げ付きで w に書き出すようにする。
+// nil を渡すとトレースを止める。既定では何も出力しない。
+func (p *Parser) SetTracing(w io.Writer) {
+	p.traceOut = w
+	p.traceLevel = 0
+}
+
+func (p *Parser) identLevel() string {
+	return strings.Repeat(traceIdentPlaceholder, p.traceLevel-1)
+}
+
+func (p *Parser) tracePrint(fs string) {
+	fmt.Fprintf(p.traceOut, "%s%s\n", p.identLevel(), fs)
+}
+
+// trace と untrace は defer p.untrace(p.trace("parseXxx")) の形で対にして使う
+func (p *Parser) trace(msg string) string {
+	if p.traceOut == nil {
+		return msg
+	}
+	p.traceLevel++
+	p.tracePrint("BEGIN " + msg + " (" + p.curToken.Literal + ")")
+	return msg
+}
+
+func (p *Parser) untrace(msg string) {
+	if p.traceOut == nil {
+		return
+	}
+	p.tracePrint("END " + msg)
+	p.traceLevel--
+}
@@ -0,0 +1,328 @@
+// Package printer は AST を整形済みの Monkey のソースコードとして書き出す。
+//
+// 出力は次の規則に従う。
+//   - 1行に1文。let・return・代入・式文は ; で終える(if・while 式の文は後続の文とつながらない限り付けない)
+//   - ブロックの中はタブ1つで字下げする
+//   - 二項演算子の前後とカンマの後に空白を1つ置く
+//   - 括弧は優先順位の上で必要なところにだけ付ける
+package printer
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kurarrr/monkey/ast"
+)
+
+// 優先順位は parser と同じ並び
+const (
+	_ int = iota
+	LOWEST
+	EQUALS      // ==
+	LESSGREATER // > または <
+	SUM         // +
+	PRODUCT     // *
+	PREFIX      // -X または !X
+	CALL        // myFunction(X)
+	INDEX       // array[index]
+)
+
+var precedences = map[string]int{
+	"==": EQUALS,
+	"!=": EQUALS,
+	"<":  LESSGREATER,
+	">":  LESSGREATER,
+	"+":  SUM,
+	"-":  SUM,
+	"/":  PRODUCT,
+	"*":  PRODUCT,
+}
+
+// Fprint は node を整形して w に書き出す
+func Fprint(w io.Writer, node ast.Node) error {
+	p := &printer{}
+	p.node(node)
+	_, err := w.Write(p.out.Bytes())
+	return err
+}
+
+// Format は node を整形した文字列を返す
+func Format(node ast.Node) string {
+	var out bytes.Buffer
+	Fprint(&out, node)
+	return out.String()
+}
+
+type printer struct {
+	out    bytes.Buffer
+	indent int
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.write("\n")
+	p.write(strings.Repeat("\t", p.indent))
+}
+
+func (p *printer) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for i, s := range node.Statements {
+			p.statement(s, next(node.Statements, i))
+			p.write("\n")
+		}
+	case *ast.BlockStatement:
+		p.block(node)
+	case ast.Statement:
+		p.statement(node, nil)
+	case ast.Expression:
+		p.expression(node, LOWEST)
+	}
+}
+
+func next(stmts []ast.Statement, i int) ast.Statement {
+	if i+1 < len(stmts) {
+		return stmts[i+1]
+	}
+	return nil
+}
+
+func (p *printer) statement(stmt ast.Statement, following ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+			if fl.Doc != "" {
+				for _, line := range strings.Split(fl.Doc, "\n") {
+					p.write(strings.TrimRight("// "+line, " "))
+					p.newline()
+				}
+			}
+			if fl.Deprecated != "" {
+				p.write("// @deprecated " + strconv.Quote(fl.Deprecated))
+				p.newline()
+			}
+		}
+		p.write("let ")
+		p.write(stmt.Name.Value)
+		p.write(" = ")
+		p.expression(stmt.Value, LOWEST)
+		p.write(";")
+	case *ast.AssignStatement:
+		p.write(stmt.Name.Value)
+		p.write(" = ")
+		p.expression(stmt.Value, LOWEST)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expression(stmt.ReturnValue, LOWEST)
+		}
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, LOWEST)
+		// if・while 式の文は } で閉じているので、後続の文がつながらない限り ; を付けない
+		if !endsWithBlock(stmt.Expression) || continuesExpression(following) {
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IfExpression, *ast.WhileExpression:
+		return true
+	default:
+		return false
+	}
+}
+
+// continuesExpression は直前の式の続きとして読まれてしまう文かどうかを返す。
+// 例えば if 式の直後に (x) や -1 が来ると、呼び出しや引き算として解析される。
+func continuesExpression(stmt ast.Statement) bool {
+	if stmt == nil {
+		return false
+	}
+	// 括弧が付くかどうかで先頭が変わるので、実際に書き出して確かめる
+	s := Format(stmt)
+	return strings.HasPrefix(s, "(") || strings.HasPrefix(s, "[") || strings.HasPrefix(s, "-")
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	for i, s := range block.Statements {
+		p.newline()
+		p.statement(s, next(block.Statements, i))
+	}
+	p.indent--
+	p.newline()
+	p.write("}")
+}
+
+// expression は exp を書き出す。exp の優先順位が outer より低ければ括弧で囲む
+func (p *printer) expression(exp ast.Expression, outer int) {
+	if precedence(exp) < outer {
+		p.write("(")
+		p.expression(exp, LOWEST)
+		p.write(")")
+		return
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+	case *ast.IntegerLiteral:
+		p.write(strconv.FormatInt(exp.Value, 10))
+	case *ast.FloatLiteral:
+		p.write(formatFloat(exp.Value))
+	case *ast.StringLiteral:
+		p.write(quote(exp.Value))
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(exp.Value))
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		// - -x を --x と書くと読みにくいので、前置式が続くときは括弧で区切る
+		if _, ok := exp.Right.(*ast.PrefixExpression); ok {
+			p.write("(")
+			p.expression(exp.Right, LOWEST)
+			p.write(")")
+		} else {
+			p.expression(exp.Right, PREFIX)
+		}
+	case *ast.InfixExpression:
+		prec := precedences[exp.Operator]
+		p.expression(exp.Left, prec)
+		p.write(" " + exp.Operator + " ")
+		// 左結合なので、右辺に同じ優先順位の式が来るときは括弧が要る
+		p.expression(exp.Right, prec+1)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition, LOWEST)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.WhileExpression:
+		p.write("while (")
+		p.expression(exp.Condition, LOWEST)
+		p.write(") ")
+		p.block(exp.Body)
+	case *ast.FunctionLiteral:
+		p.write("fn(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(param.Value)
+		}
+		p.write(") ")
+		p.block(exp.Body)
+	case *ast.MacroLiteral:
+		p.write("macro(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(param.Value)
+		}
+		p.write(") ")
+		p.block(exp.Body)
+	case *ast.CallExpression:
+		p.expression(exp.Function, CALL)
+		p.write("(")
+		p.expressionList(exp.Arguments)
+		p.write(")")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.expressionList(exp.Elements)
+		p.write("]")
+	case *ast.IndexExpression:
+		// 呼び出しと添字はどちらも後置なので、f(x)[0] や a[0](x) に括弧は要らない
+		p.expression(exp.Left, CALL)
+		p.write("[")
+		p.expression(exp.Index, LOWEST)
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, pair := range exp.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(pair.Key, LOWEST)
+			p.write(": ")
+			p.expression(pair.Value, LOWEST)
+		}
+		p.write("}")
+	}
+}
+
+func (p *printer) expressionList(exps []ast.Expression) {
+	for i, e := range exps {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(e, LOWEST)
+	}
+}
+
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return precedences[exp.Operator]
+	case *ast.PrefixExpression:
+		return PREFIX
+	case *ast.CallExpression:
+		return CALL
+	case *ast.IndexExpression:
+		return INDEX
+	default:
+		// リテラルや識別子、if・while・fn・macro はそれ自体で閉じているので括弧は要らない
+		return INDEX + 1
+	}
+}
+
+// formatFloat は lexer が読める形(指数表記なし、小数点付き)で浮動小数点数を書く
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// quote は lexer が受け付けるエスケープだけを使って文字列リテラルを書く
+func quote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
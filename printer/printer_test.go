@@ -0,0 +1,94 @@
+package printer
+
+import (
+	"testing"
+
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/parser"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"return x*2", "return x * 2;\n"},
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"1-(2-3)", "1 - (2 - 3);\n"},
+		{"(1-2)-3", "1 - 2 - 3;\n"},
+		{"-(a+b)", "-(a + b);\n"},
+		{"!-x", "!(-x);\n"},
+		{"-f(x)", "-f(x);\n"},
+		{"(a < b) == true", "a < b == true;\n"},
+		{"a < (b == true)", "a < (b == true);\n"},
+		{"f(x)[0](y)", "f(x)[0](y);\n"},
+		{"(a+b)[0]", "(a + b)[0];\n"},
+		{`"a\"b\\c\n"`, `"a\"b\\c\n";` + "\n"},
+		{"[1,2,  3]", "[1, 2, 3];\n"},
+		{"1.50 + 2.0", "1.5 + 2.0;\n"},
+		{"[]", "[];\n"},
+		{`{"b":1,"a":2, 3:true}`, `{"b": 1, "a": 2, 3: true};` + "\n"},
+		{"{}", "{};\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"// @deprecated \"use g\"\nlet f=fn(){1}", "// @deprecated \"use g\"\nlet f = fn() {\n\t1;\n};\n"},
+		{"// f は 1 を返す\n//\n// @deprecated \"use g\"\nlet f=fn(){1}", "// f は 1 を返す\n//\n// @deprecated \"use g\"\nlet f = fn() {\n\t1;\n};\n"},
+		{"x=x+1", "x = x + 1;\n"},
+		{"let m=macro(a){quote(unquote(a)+1)}", "let m = macro(a) {\n\tquote(unquote(a) + 1);\n};\n"},
+		{"while(i<3){i=i+1}", "while (i < 3) {\n\ti = i + 1;\n}\n"},
+		{"while(x){};-1", "while (x) {};\n-1;\n"},
+		{
+			"let add=fn(a,b){let c=a+b;c}",
+			"let add = fn(a, b) {\n\tlet c = a + b;\n\tc;\n};\n",
+		},
+		{
+			"if(x>1){x}else{if(y){1}}",
+			"if (x > 1) {\n\tx;\n} else {\n\tif (y) {\n\t\t1;\n\t}\n}\n",
+		},
+		{
+			"if (x) { 1 }; (y)",
+			"if (x) {\n\t1;\n}\ny;\n",
+		},
+		{
+			"if (x) { 1 }; (a + b) * 2",
+			"if (x) {\n\t1;\n};\n(a + b) * 2;\n",
+		},
+		{
+			"if (x) { 1 }; [1]",
+			"if (x) {\n\t1;\n};\n[1];\n",
+		},
+		{
+			"if (x) { 1 }; -1",
+			"if (x) {\n\t1;\n};\n-1;\n",
+		},
+		{
+			"if (x) { 1 }; let y = 2;",
+			"if (x) {\n\t1;\n}\nlet y = 2;\n",
+		},
+	}
+
+	for _, tt := range tests {
+		formatted := format(t, tt.input)
+		if formatted != tt.expected {
+			t.Errorf("format(%q) wrong.\nwant=%q\ngot =%q", tt.input, tt.expected, formatted)
+			continue
+		}
+
+		// 整形結果をもう一度整形しても変わらないこと
+		if again := format(t, formatted); again != formatted {
+			t.Errorf("format is not idempotent for %q.\nfirst =%q\nsecond=%q", tt.input, formatted, again)
+		}
+	}
+}
+
+func format(t *testing.T, input string) string {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return Format(program)
+}
@@ -0,0 +1,193 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/printer"
+)
+
+// Editor は :edit が呼ぶ、path のファイルを利用者に編集させる関数。
+// 既定では $EDITOR (設定されていなければ vi) を端末で開き、閉じるまで待つ。テストや埋め込み先で差し替えられる
+var Editor = func(path string) error {
+	args := strings.Fields(os.Getenv("EDITOR"))
+	if len(args) == 0 {
+		args = []string{"vi"}
+	}
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// session は REPL の1回の実行の状態
+type session struct {
+	out      io.Writer
+	scanner  *bufio.Scanner // :explore のようにコマンドの中で入力を読むときにも使う
+	engine   engine
+	macroEnv *object.Environment
+	compat   object.Compat
+	// scratch は名前なしの :edit で最後に編集したソース
+	scratch string
+	// transcript はこれまでの入力と出力。コマンドの行は含まない
+	transcript []entry
+}
+
+// entry は REPL の1回分の入力と、それに対する出力 (値またはエラー)
+type entry struct {
+	input  string
+	output string
+}
+
+func newSession(out io.Writer, e engine, compat object.Compat) *session {
+	macroEnv := object.NewEnvironment()
+	macroEnv.SetCompat(compat)
+	return &session{out: out, engine: e, macroEnv: macroEnv, compat: compat}
+}
+
+// command は : で始まる行を実行し、続けて評価するソースを返す。評価するものがなければ false
+func (s *session) command(line string) (string, bool) {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ":edit":
+		return s.edit(fields[1:])
+	case ":export":
+		s.export(fields[1:])
+		return "", false
+	case ":explore":
+		s.explore(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), ":explore")))
+		return "", false
+	default:
+		fmt.Fprintf(s.out, "ERROR: unknown command %s\n", fields[0])
+		return "", false
+	}
+}
+
+// edit は :edit [name] を実行する。name があればその関数を整形したソースを、
+// なければ前回の続きを Editor で開き、保存されたソースを返す
+func (s *session) edit(args []string) (string, bool) {
+	if len(args) > 1 {
+		fmt.Fprintf(s.out, "ERROR: usage: :edit [name]\n")
+		return "", false
+	}
+
+	initial := s.scratch
+	if len(args) == 1 {
+		name := args[0]
+		obj, ok := s.engine.lookup(name)
+		if !ok {
+			fmt.Fprintf(s.out, "ERROR: identifier not found: %s\n", name)
+			return "", false
+		}
+		fn, ok := functionLiteral(obj)
+		if !ok {
+			fmt.Fprintf(s.out, "ERROR: %s is not a function, got %s\n", name, obj.Type())
+			return "", false
+		}
+		initial = "let " + name + " = " + printer.Format(fn) + ";\n"
+	}
+
+	f, err := os.CreateTemp("", "monkey-edit-*.monkey")
+	if err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return "", false
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	_, err = f.WriteString(initial)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return "", false
+	}
+
+	if err := Editor(path); err != nil {
+		fmt.Fprintf(s.out, "ERROR: editor: %s\n", err)
+		return "", false
+	}
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return "", false
+	}
+	src := string(edited)
+	if len(args) == 0 {
+		s.scratch = src
+	}
+	if strings.TrimSpace(src) == "" {
+		return "", false
+	}
+	return src, true
+}
+
+// export は :export FILE を実行し、これまでのセッションを Markdown で FILE に書き出す
+func (s *session) export(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(s.out, "ERROR: usage: :export FILE\n")
+		return
+	}
+	if err := os.WriteFile(args[0], []byte(s.markdown()), 0644); err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return
+	}
+	fmt.Fprintf(s.out, "exported %d inputs to %s\n", len(s.transcript), args[0])
+}
+
+// markdown はセッションを、入力を monkey のコードブロック、出力をテキストのコードブロックにした Markdown にする
+func (s *session) markdown() string {
+	var out strings.Builder
+	out.WriteString("# Monkey REPL session\n")
+	for _, e := range s.transcript {
+		out.WriteString("\n")
+		writeFenced(&out, "monkey", e.input)
+		if e.output != "" {
+			writeFenced(&out, "text", e.output)
+		}
+	}
+	return out.String()
+}
+
+// writeFenced は code をコードブロックにして書く。code の中の ``` で閉じてしまわないよう、
+// code に現れるより長いバッククォートの並びで囲む
+func writeFenced(out *strings.Builder, lang, code string) {
+	longest, run := 0, 0
+	for _, ch := range code {
+		if ch == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	fence := "```"
+	if longest >= len(fence) {
+		fence = strings.Repeat("`", longest+1)
+	}
+	out.WriteString(fence + lang + "\n")
+	out.WriteString(strings.TrimSuffix(code, "\n") + "\n")
+	out.WriteString(fence + "\n")
+}
+
+// functionLiteral は評価器の関数と VM のクロージャから関数リテラルを組み立て直す
+func functionLiteral(obj object.Object) (*ast.FunctionLiteral, bool) {
+	switch fn := obj.(type) {
+	case *object.Function:
+		return &ast.FunctionLiteral{Parameters: fn.Parameters, Body: fn.Body}, true
+	case *object.Closure:
+		if fn.Fn.Literal == nil {
+			return nil, false
+		}
+		return fn.Fn.Literal, true
+	default:
+		return nil, false
+	}
+}
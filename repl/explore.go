@@ -0,0 +1,254 @@
+package repl
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/parser"
+	"github.com/kurarrr/monkey/token"
+)
+
+const exploreHelp = `commands:
+  j, <enter>  next node
+  k           previous node
+  l           expand the node
+  h           collapse the node, or go to its parent
+  a           expand every node
+  q           quit
+`
+
+// treeNode は :explore で表示する構文木の1ノード
+type treeNode struct {
+	label    string // 親から見た名前。"left", "condition" など
+	node     ast.Node
+	parent   *treeNode
+	children []*treeNode
+	expanded bool
+	depth    int
+}
+
+// explore は :explore EXPR を実行する。EXPR を構文解析し、その木をコマンドで開いたり閉じたりしながら見せる。
+// 演算子の優先順位でどう組み立てられたかを学ぶためのもの
+func (s *session) explore(src string) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors(), s.compat)
+		return
+	}
+
+	// 式が1つだけならその式を根にする
+	var root ast.Node = program
+	if len(program.Statements) == 1 {
+		if es, ok := program.Statements[0].(*ast.ExpressionStatement); ok {
+			root = es.Expression
+		}
+	}
+	tree := buildTree("", root, nil, 0)
+	tree.expanded = true
+	cur := tree
+
+	show := func() {
+		for _, n := range visibleNodes(tree) {
+			marker := "  "
+			if n == cur {
+				marker = "> "
+			}
+			fmt.Fprintf(s.out, "%s%s%s\n", marker, strings.Repeat("  ", n.depth), describe(n))
+		}
+	}
+
+	fmt.Fprint(s.out, exploreHelp)
+	show()
+	for {
+		fmt.Fprint(s.out, "explore> ")
+		if !s.scanner.Scan() {
+			return
+		}
+		cmd := strings.TrimSpace(s.scanner.Text())
+
+		visible := visibleNodes(tree)
+		i := indexOf(visible, cur)
+		switch cmd {
+		case "", "j":
+			if i+1 < len(visible) {
+				cur = visible[i+1]
+			}
+		case "k":
+			if i > 0 {
+				cur = visible[i-1]
+			}
+		case "l":
+			cur.expanded = true
+		case "h":
+			if cur.expanded && len(cur.children) > 0 {
+				cur.expanded = false
+			} else if cur.parent != nil {
+				cur = cur.parent
+			}
+		case "a":
+			expandAll(tree)
+		case "q":
+			return
+		default:
+			fmt.Fprint(s.out, exploreHelp)
+			continue
+		}
+		show()
+	}
+}
+
+func buildTree(label string, node ast.Node, parent *treeNode, depth int) *treeNode {
+	n := &treeNode{label: label, node: node, parent: parent, depth: depth}
+	for _, c := range children(node) {
+		n.children = append(n.children, buildTree(c.label, c.node, n, depth+1))
+	}
+	return n
+}
+
+func visibleNodes(n *treeNode) []*treeNode {
+	nodes := []*treeNode{n}
+	if n.expanded {
+		for _, c := range n.children {
+			nodes = append(nodes, visibleNodes(c)...)
+		}
+	}
+	return nodes
+}
+
+func expandAll(n *treeNode) {
+	n.expanded = true
+	for _, c := range n.children {
+		expandAll(c)
+	}
+}
+
+func indexOf(nodes []*treeNode, n *treeNode) int {
+	for i, m := range nodes {
+		if m == n {
+			return i
+		}
+	}
+	return 0
+}
+
+// describe はノードを1行で表す。[+] は閉じていて子があるノード、[-] は開いているノード
+func describe(n *treeNode) string {
+	var out strings.Builder
+	switch {
+	case len(n.children) == 0:
+		out.WriteString("    ")
+	case n.expanded:
+		out.WriteString("[-] ")
+	default:
+		out.WriteString("[+] ")
+	}
+	if n.label != "" {
+		out.WriteString(n.label + ": ")
+	}
+	out.WriteString(strings.TrimPrefix(fmt.Sprintf("%T", n.node), "*ast."))
+	switch node := n.node.(type) {
+	case *ast.InfixExpression:
+		fmt.Fprintf(&out, " %s", node.Operator)
+	case *ast.PrefixExpression:
+		fmt.Fprintf(&out, " %s", node.Operator)
+	}
+	fmt.Fprintf(&out, "  %s", n.node.String())
+	if tok, ok := nodeToken(n.node); ok && tok.Line > 0 {
+		fmt.Fprintf(&out, "  @%d:%d", tok.Line, tok.Column)
+	}
+	return out.String()
+}
+
+// nodeToken はノードの Token フィールドを返す。Program のように持たないノードでは false
+func nodeToken(node ast.Node) (token.Token, bool) {
+	v := reflect.ValueOf(node)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return token.Token{}, false
+	}
+	f := v.Elem().FieldByName("Token")
+	if !f.IsValid() {
+		return token.Token{}, false
+	}
+	tok, ok := f.Interface().(token.Token)
+	return tok, ok
+}
+
+type child struct {
+	label string
+	node  ast.Node
+}
+
+// children はノードの子を、ソースに現れる順に名前を付けて返す
+func children(node ast.Node) []child {
+	var cs []child
+	add := func(label string, n ast.Node) {
+		if n != nil && !reflect.ValueOf(n).IsNil() {
+			cs = append(cs, child{label, n})
+		}
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for i, s := range node.Statements {
+			add(fmt.Sprintf("statement %d", i+1), s)
+		}
+	case *ast.BlockStatement:
+		for i, s := range node.Statements {
+			add(fmt.Sprintf("statement %d", i+1), s)
+		}
+	case *ast.ExpressionStatement:
+		add("expression", node.Expression)
+	case *ast.LetStatement:
+		add("name", node.Name)
+		add("value", node.Value)
+	case *ast.AssignStatement:
+		add("name", node.Name)
+		add("value", node.Value)
+	case *ast.ReturnStatement:
+		add("value", node.ReturnValue)
+	case *ast.PrefixExpression:
+		add("right", node.Right)
+	case *ast.InfixExpression:
+		add("left", node.Left)
+		add("right", node.Right)
+	case *ast.IfExpression:
+		add("condition", node.Condition)
+		add("consequence", node.Consequence)
+		add("alternative", node.Alternative)
+	case *ast.WhileExpression:
+		add("condition", node.Condition)
+		add("body", node.Body)
+	case *ast.FunctionLiteral:
+		for i, p := range node.Parameters {
+			add(fmt.Sprintf("parameter %d", i+1), p)
+		}
+		add("body", node.Body)
+	case *ast.MacroLiteral:
+		for i, p := range node.Parameters {
+			add(fmt.Sprintf("parameter %d", i+1), p)
+		}
+		add("body", node.Body)
+	case *ast.CallExpression:
+		add("function", node.Function)
+		for i, a := range node.Arguments {
+			add(fmt.Sprintf("argument %d", i+1), a)
+		}
+	case *ast.ArrayLiteral:
+		for i, e := range node.Elements {
+			add(fmt.Sprintf("element %d", i), e)
+		}
+	case *ast.IndexExpression:
+		add("left", node.Left)
+		add("index", node.Index)
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			add("key", pair.Key)
+			add("value", pair.Value)
+		}
+	}
+	return cs
+}
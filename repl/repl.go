@@ -2,27 +2,319 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
+	"strings"
 
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/compiler"
+	"github.com/kurarrr/monkey/evaluator"
 	"github.com/kurarrr/monkey/lexer"
-	"github.com/kurarrr/monkey/token"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/parser"
+	"github.com/kurarrr/monkey/vm"
 )
 
 const PROMPT = ">> "
 
+// MONKEY_FACE は本の Monkey と同じ振る舞いのときに、構文エラーの前に出す
+const MONKEY_FACE = `            __,__
+   .--.  .-"     "-.  .--.
+  / .. \/  .-. .-.  \/ .. \
+ | |  '|  /   Y   \  |'  | |
+ | \   \  \ 0 | 0 /  /   / |
+  \ '- ,\.-"""""""-./, -' /
+   ''-' /_   ^ ^   _\ '-''
+       |  \._   _./  |
+       \   \ '~' /   /
+        '._ '-=-' _.'
+           '-----'
+`
+
+// InitFile はカレントディレクトリにあれば REPL の開始時に読み込むファイル。
+// プロジェクト用の補助関数をいつでも使えるようにしておくためのもの
+const InitFile = "repl_init.mk"
+
+// Options は REPL を始めるときの設定
+type Options struct {
+	// Engine は "eval", "vm", "rvm" のどれか。空なら "eval"
+	Engine string
+	// Preload は最初のプロンプトの前に順に読み込むファイル。値は表示せず、エラーだけを表示する
+	Preload []string
+	// FS は Preload を読むファイルシステム。nil なら OS のファイルシステム
+	FS fs.FS
+	// Compat はどの Monkey と同じに振る舞うか
+	Compat object.Compat
+}
+
+// Start は in から1行ずつ読み込んで評価し、結果を out に書き出す。
+// 環境は行をまたいで保持される。
+// : で始まる行はコマンドで、:edit [name] は関数か下書きをエディタで編集してから評価する。
+// :export FILE はそれまでの入力と出力を Markdown で FILE に書き出す。
+// :explore EXPR は EXPR の構文木を開いたり閉じたりしながら見る
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	StartWithEnvironment(in, out, object.NewEnvironment())
+}
+
+// StartWithEnvironment は Start と同じだが、env の中で評価する。
+// 実行時エラーの起きた環境を調べる事後デバッグで使う
+func StartWithEnvironment(in io.Reader, out io.Writer, env *object.Environment) {
+	newSession(out, &evalEngine{env: env}, env.Compat()).loop(in)
+}
+
+// StartVM は Start と同じ入出力で、バイトコードにコンパイルして VM で実行する。
+// シンボルテーブル・定数・グローバル変数は行をまたいで保持される。
+func StartVM(in io.Reader, out io.Writer) {
+	newSession(out, newVMEngine(false, object.CompatNone), object.CompatNone).loop(in)
+}
+
+// StartRVM は StartVM と同じく行をまたいで状態を保持し、レジスタ VM で実行する
+func StartRVM(in io.Reader, out io.Writer) {
+	newSession(out, newVMEngine(true, object.CompatNone), object.CompatNone).loop(in)
+}
+
+// StartWithOptions は opts.Engine のエンジンで、opts.Preload を読み込んでから REPL を始める
+func StartWithOptions(in io.Reader, out io.Writer, opts Options) {
+	var e engine
+	switch opts.Engine {
+	case "vm":
+		e = newVMEngine(false, opts.Compat)
+	case "rvm":
+		e = newVMEngine(true, opts.Compat)
+	default:
+		env := object.NewEnvironment()
+		env.SetCompat(opts.Compat)
+		e = &evalEngine{env: env}
+	}
+	s := newSession(out, e, opts.Compat)
+	for _, path := range opts.Preload {
+		s.load(opts.FS, path)
+	}
+	s.loop(in)
+}
+
+// engine は REPL が1回の入力を実行するもの。エンジンごとの状態は入力をまたいで持ち続ける
+type engine interface {
+	// run は program を実行し、表示する値を返す。表示するものがなければ nil
+	run(program *ast.Program) (object.Object, error)
+	// lookup はグローバルに束縛された値を名前で引く
+	lookup(name string) (object.Object, bool)
+}
+
+// loop はプロンプトを出して1行ずつ読み、入力が終わるまで実行する
+func (s *session) loop(in io.Reader) {
+	s.scanner = bufio.NewScanner(in)
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
+		fmt.Fprintf(s.out, PROMPT)
+		scanned := s.scanner.Scan()
 		if !scanned {
 			return
 		}
-		line := scanner.Text()
-		l := lexer.New(line)
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+
+		line := s.scanner.Text()
+		if strings.HasPrefix(line, ":") {
+			src, ok := s.command(line)
+			if !ok {
+				continue
+			}
+			line = src
+		}
+
+		// :export のために、入力ごとの出力を書き出しながら覚えておく
+		out := s.out
+		var output strings.Builder
+		s.out = io.MultiWriter(out, &output)
+		s.eval(line)
+		s.out = out
+		s.transcript = append(s.transcript, entry{input: line, output: output.String()})
+	}
+}
+
+// eval は1回分の入力を実行し、値かエラーを表示する
+func (s *session) eval(src string) {
+	program, ok := s.parse(src, "")
+	if !ok {
+		return
+	}
+	result, err := s.engine.run(program)
+	if err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return
+	}
+	if result != nil {
+		io.WriteString(s.out, object.Format(result, object.DisplayFormat))
+		io.WriteString(s.out, "\n")
+	}
+}
+
+// parse は src を構文解析してマクロを展開する。エラーがあれば表示して false を返す。
+// name が空でなければ、構文エラーの前にファイル名として付ける
+func (s *session) parse(src, name string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		if name != "" {
+			for _, err := range p.Errors() {
+				fmt.Fprintf(s.out, "%s: %s\n", name, err)
+			}
+			return nil, false
+		}
+		printParserErrors(s.out, p.Errors(), s.compat)
+		return nil, false
+	}
+
+	program, err := expandMacros(program, s.macroEnv)
+	if err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return nil, false
+	}
+	return program, true
+}
+
+// load は path のファイルを読み込んで実行する。値は表示しない
+func (s *session) load(fsys fs.FS, path string) {
+	var src []byte
+	var err error
+	if fsys == nil {
+		src, err = os.ReadFile(path)
+	} else {
+		src, err = fs.ReadFile(fsys, path)
+	}
+	if err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return
+	}
+
+	program, ok := s.parse(string(src), path)
+	if !ok {
+		return
+	}
+	if _, err := s.engine.run(program); err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s: %s\n", path, err)
+	}
+}
+
+// evalEngine は木をたどる評価器で実行する
+type evalEngine struct {
+	env *object.Environment
+}
+
+func (e *evalEngine) run(program *ast.Program) (object.Object, error) {
+	evaluated := evaluator.Eval(program, e.env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, errors.New(errObj.Message)
+	}
+	return evaluated, nil
+}
+
+func (e *evalEngine) lookup(name string) (object.Object, bool) {
+	return e.env.Get(name)
+}
+
+// vmEngine はバイトコードにコンパイルしてスタック VM かレジスタ VM で実行する
+type vmEngine struct {
+	register    bool
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
+	compat      object.Compat
+}
+
+func newVMEngine(register bool, compat object.Compat) *vmEngine {
+	return &vmEngine{
+		register:    register,
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		symbolTable: compiler.NewSymbolTableWithCompat(compat),
+		compat:      compat,
+	}
+}
+
+func (e *vmEngine) run(program *ast.Program) (object.Object, error) {
+	if e.register {
+		comp := compiler.NewRegisterCompilerWithState(e.symbolTable, e.constants)
+		if err := comp.Compile(program); err != nil {
+			return nil, err
+		}
+		code := comp.Program()
+		e.constants = code.Constants
+
+		machine := vm.NewRegisterVMWithGlobalsStore(code, e.globals)
+		machine.SetCompat(e.compat)
+		if err := machine.Run(); err != nil {
+			return nil, err
+		}
+		if !producesValue(program) {
+			return nil, nil
 		}
+		return machine.LastEvaluated(), nil
+	}
+
+	comp := compiler.NewWithState(e.symbolTable, e.constants)
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	code := comp.Bytecode()
+	e.constants = code.Constants
+
+	machine := vm.NewWithGlobalsStore(code, e.globals)
+	machine.SetCompat(e.compat)
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+	// 最後が let 文の行は値を残さないので表示しない
+	if !producesValue(program) {
+		return nil, nil
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+func (e *vmEngine) lookup(name string) (object.Object, bool) {
+	sym, ok := e.symbolTable.Resolve(name)
+	if !ok || sym.Scope != compiler.GlobalScope || e.globals[sym.Index] == nil {
+		return nil, false
+	}
+	return e.globals[sym.Index], true
+}
+
+// expandMacros は program のマクロ定義を macroEnv に移し、マクロ呼び出しを展開する。
+// マクロは行をまたいで macroEnv に残る
+func expandMacros(program *ast.Program, macroEnv *object.Environment) (*ast.Program, error) {
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		return nil, err
+	}
+	return expanded.(*ast.Program), nil
+}
+
+func producesValue(program *ast.Program) bool {
+	for _, s := range program.Statements {
+		if _, ok := s.(*ast.ReturnStatement); ok {
+			return true
+		}
+	}
+	if len(program.Statements) == 0 {
+		return false
+	}
+	_, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func printParserErrors(out io.Writer, errors []parser.ParseError, compat object.Compat) {
+	if compat == object.CompatBook {
+		io.WriteString(out, MONKEY_FACE)
+		io.WriteString(out, "Woops! We ran into some monkey business here!\n")
+		io.WriteString(out, " parser errors:\n")
+		for _, err := range errors {
+			io.WriteString(out, "\t"+err.Msg+"\n")
+		}
+		return
+	}
+	for _, err := range errors {
+		io.WriteString(out, err.Error()+"\n")
 	}
 }
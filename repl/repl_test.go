@@ -0,0 +1,223 @@
+package repl
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kurarrr/monkey/object"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestGolden feeds each testdata/*.monkey file through the REPL and compares
+// the transcript with the matching .golden file. Run with -update to
+// regenerate the golden files after an intended output change.
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.monkey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no testdata/*.monkey files found")
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".monkey")
+		t.Run(name, func(t *testing.T) {
+			src, err := ioutil.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			Start(bytes.NewReader(src), &out)
+
+			golden := strings.TrimSuffix(input, ".monkey") + ".golden"
+			if *update {
+				if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("missing golden file (run go test -update): %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), expected) {
+				t.Errorf("output mismatch for %s\n--- got ---\n%s\n--- want ---\n%s",
+					input, out.String(), expected)
+			}
+
+			// VM とレジスタ VM でも同じ出力になること
+			var vmOut bytes.Buffer
+			StartVM(bytes.NewReader(src), &vmOut)
+			if !bytes.Equal(vmOut.Bytes(), expected) {
+				t.Errorf("vm output mismatch for %s\n--- got ---\n%s\n--- want ---\n%s",
+					input, vmOut.String(), expected)
+			}
+
+			var rvmOut bytes.Buffer
+			StartRVM(bytes.NewReader(src), &rvmOut)
+			if !bytes.Equal(rvmOut.Bytes(), expected) {
+				t.Errorf("rvm output mismatch for %s\n--- got ---\n%s\n--- want ---\n%s",
+					input, rvmOut.String(), expected)
+			}
+		})
+	}
+}
+
+func TestEdit(t *testing.T) {
+	defer func(saved func(string) error) { Editor = saved }(Editor)
+
+	// 編集の内容は呼ばれた回数で決める。開いたときの内容は opened に残す
+	var opened []string
+	edits := []string{
+		"let double = fn(x) {\n  x * 2\n};\ndouble(4)\n",
+		"let double = fn(x) { x * 3 };",
+		"",
+	}
+	Editor = func(path string) error {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		opened = append(opened, string(data))
+		return ioutil.WriteFile(path, []byte(edits[len(opened)-1]), 0644)
+	}
+
+	input := ":edit\n:edit double\ndouble(4)\n:edit\n:edit nothing\n:edit 1 2\n:bogus\n"
+	expected := ">> 8\n>> >> 12\n>> >> ERROR: identifier not found: nothing\n" +
+		">> ERROR: usage: :edit [name]\n>> ERROR: unknown command :bogus\n>> "
+	starts := map[string]func(io.Reader, io.Writer){"eval": Start, "vm": StartVM, "rvm": StartRVM}
+	for engine, start := range starts {
+		opened = nil
+		var out bytes.Buffer
+		start(strings.NewReader(input), &out)
+		if out.String() != expected {
+			t.Errorf("%s: wrong output.\nwant=%q\ngot =%q", engine, expected, out.String())
+		}
+		// 2回目は関数を整形して、3回目は前回の下書きを開く
+		if len(opened) != 3 || opened[1] != "let double = fn(x) {\n\tx * 2;\n};\n" || opened[2] != edits[0] {
+			t.Errorf("%s: wrong editor contents: %q", engine, opened)
+		}
+	}
+}
+
+func TestPreload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"helpers.mk": {Data: []byte("let square = fn(x) { x * x };\nsquare(2);\n")},
+		"more.mk":    {Data: []byte("let cube = fn(x) { x * square(x) };")},
+		"broken.mk":  {Data: []byte("let = 1;")},
+		"failing.mk": {Data: []byte("let y = 1; y + true;")},
+	}
+	opts := Options{Preload: []string{"helpers.mk", "more.mk", "broken.mk", "failing.mk", "absent.mk"}, FS: fsys}
+
+	expected := "broken.mk: parse error at 1:5: expected next token to be IDENT, got = instead\n" +
+		"broken.mk: parse error at 1:5: no prefix parse function for = found\n" +
+		"ERROR: failing.mk: type mismatch: INTEGER + BOOLEAN\n" +
+		"ERROR: open absent.mk: file does not exist\n" +
+		">> 27\n>> 1\n>> "
+	for _, engine := range []string{"eval", "vm", "rvm"} {
+		opts.Engine = engine
+		var out bytes.Buffer
+		StartWithOptions(strings.NewReader("cube(3)\ny\n"), &out, opts)
+		if out.String() != expected {
+			t.Errorf("%s: wrong output.\nwant=%q\ngot =%q", engine, expected, out.String())
+		}
+	}
+}
+
+func TestBookParserErrors(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader("let = 1\n"), &out, Options{Compat: object.CompatBook})
+	expected := ">> " + MONKEY_FACE +
+		"Woops! We ran into some monkey business here!\n" +
+		" parser errors:\n" +
+		"\texpected next token to be IDENT, got = instead\n" +
+		"\tno prefix parse function for = found\n>> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.md")
+	input := "let x = 2;\nx * 21\nx + true\nlet = 1\n\"```\"\n:export\n:export " + path + "\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	if !strings.Contains(out.String(), ">> ERROR: usage: :export FILE\n>> exported 5 inputs to "+path+"\n") {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# Monkey REPL session\n" +
+		"\n```monkey\nlet x = 2;\n```\n" +
+		"\n```monkey\nx * 21\n```\n```text\n42\n```\n" +
+		"\n```monkey\nx + true\n```\n```text\nERROR: type mismatch: INTEGER + BOOLEAN\n```\n" +
+		"\n```monkey\nlet = 1\n```\n```text\n" +
+		"parse error at 1:5: expected next token to be IDENT, got = instead\n" +
+		"parse error at 1:5: no prefix parse function for = found\n```\n" +
+		"\n````monkey\n\"```\"\n````\n````text\n```\n````\n"
+	if string(got) != expected {
+		t.Errorf("wrong markdown.\nwant=%q\ngot =%q", expected, string(got))
+	}
+}
+
+func TestExplore(t *testing.T) {
+	input := ":explore 1 + 2 * 3\nj\nj\nl\nh\nh\nh\nq\n:explore let = 1\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	screens := strings.Split(out.String(), "explore> ")
+	expected := []string{
+		exploreHelp +
+			"> [-] InfixExpression +  (1 + (2 * 3))  @1:3\n" +
+			"        left: IntegerLiteral  1  @1:1\n" +
+			"    [+] right: InfixExpression *  (2 * 3)  @1:7\n",
+		// j
+		"  [-] InfixExpression +  (1 + (2 * 3))  @1:3\n" +
+			">       left: IntegerLiteral  1  @1:1\n" +
+			"    [+] right: InfixExpression *  (2 * 3)  @1:7\n",
+		// j
+		"  [-] InfixExpression +  (1 + (2 * 3))  @1:3\n" +
+			"        left: IntegerLiteral  1  @1:1\n" +
+			">   [+] right: InfixExpression *  (2 * 3)  @1:7\n",
+		// l で開く
+		"  [-] InfixExpression +  (1 + (2 * 3))  @1:3\n" +
+			"        left: IntegerLiteral  1  @1:1\n" +
+			">   [-] right: InfixExpression *  (2 * 3)  @1:7\n" +
+			"          left: IntegerLiteral  2  @1:5\n" +
+			"          right: IntegerLiteral  3  @1:9\n",
+		// h で閉じる
+		"  [-] InfixExpression +  (1 + (2 * 3))  @1:3\n" +
+			"        left: IntegerLiteral  1  @1:1\n" +
+			">   [+] right: InfixExpression *  (2 * 3)  @1:7\n",
+		// 閉じたノードで h を押すと親へ
+		"> [-] InfixExpression +  (1 + (2 * 3))  @1:3\n" +
+			"        left: IntegerLiteral  1  @1:1\n" +
+			"    [+] right: InfixExpression *  (2 * 3)  @1:7\n",
+		"> [+] InfixExpression +  (1 + (2 * 3))  @1:3\n",
+		">> parse error at 1:5: expected next token to be IDENT, got = instead\n" +
+			"parse error at 1:5: no prefix parse function for = found\n>> ",
+	}
+	screens[0] = strings.TrimPrefix(screens[0], ">> ")
+	if len(screens) != len(expected) {
+		t.Fatalf("wrong number of screens. want=%d, got=%d\n%s", len(expected), len(screens), out.String())
+	}
+	for i, want := range expected {
+		if screens[i] != want {
+			t.Errorf("screen %d wrong.\nwant=%q\ngot =%q", i, want, screens[i])
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package spec は言語の適合テストを読み、エンジンで実行して確かめる。
+//
+// テストは JSON の配列で書き、1つの要素が1つのケースになる。ケースはソースと、期待する
+// 構文木 (ast.Program の String)、構文エラー、最後の式の値 (Inspect)、実行時エラー、
+// puts の出力のうち必要なものを持つ。書かなかった項目は確かめない。構文エラーがあるか、
+// 値も実行時エラーも出力も書いていないケースは実行しない。
+// 同じファイルを評価器と2つの VM で実行し、どれも仕様どおりに動くかを見る。別の実装も
+// このファイルを読めば同じ基準で確かめられる。testdata に言語全体のケースがある。
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/compiler"
+	"github.com/kurarrr/monkey/evaluator"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/parser"
+	"github.com/kurarrr/monkey/vm"
+)
+
+// Case は適合テストの1ケース
+type Case struct {
+	Name  string `json:"name"`
+	Input string `json:"input"`
+
+	AST         string   `json:"ast,omitempty"`         // 構文木の String()
+	ParseErrors []string `json:"parseErrors,omitempty"` // 構文エラーのメッセージ。あれば実行しない
+	Result      string   `json:"result,omitempty"`      // 最後の式の値の Inspect
+	Error       string   `json:"error,omitempty"`       // 実行時エラーのメッセージ
+	Output      *string  `json:"output,omitempty"`      // puts が書き出す内容
+
+	// Engines はこのケースを実行するエンジン。空なら全てのエンジン
+	Engines []string `json:"engines,omitempty"`
+}
+
+// Engines は Run が扱えるエンジン
+var Engines = []string{"eval", "vm", "rvm"}
+
+// Load は fsys の path にある JSON のケースの配列を読む
+func Load(fsys fs.FS, path string) ([]Case, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return cases, nil
+}
+
+// Applies は c を engine で実行するかどうかを返す
+func (c Case) Applies(engine string) bool {
+	if len(c.Engines) == 0 {
+		return true
+	}
+	for _, e := range c.Engines {
+		if e == engine {
+			return true
+		}
+	}
+	return false
+}
+
+// Run は c を engine で実行し、仕様と違うところがあればエラーで返す。
+// puts の出力を受け取るため object.Stdout を一時的に差し替えるので、並行には呼べない
+func Run(c Case, engine string) error {
+	p := parser.New(lexer.New(c.Input))
+	program := p.ParseProgram()
+
+	var parseErrors []string
+	for _, err := range p.Errors() {
+		parseErrors = append(parseErrors, err.Msg)
+	}
+	if err := compare("parse errors", parseErrors, c.ParseErrors); err != nil {
+		return err
+	}
+	if len(parseErrors) != 0 {
+		return nil
+	}
+	if c.AST != "" && program.String() != c.AST {
+		return fmt.Errorf("ast: got %q, want %q", program.String(), c.AST)
+	}
+	// 値もエラーも出力も書いていないケースは構文だけを確かめる
+	if c.Result == "" && c.Error == "" && c.Output == nil {
+		return nil
+	}
+
+	var out bytes.Buffer
+	saved := object.Stdout
+	object.Stdout = &out
+	result, runErr := execute(program, engine)
+	object.Stdout = saved
+
+	got := ""
+	if runErr != nil {
+		got = runErr.Error()
+	}
+	if got != c.Error {
+		return fmt.Errorf("error: got %q, want %q", got, c.Error)
+	}
+	if c.Result != "" {
+		if result == nil {
+			return fmt.Errorf("result: got none, want %q", c.Result)
+		}
+		if result.Inspect() != c.Result {
+			return fmt.Errorf("result: got %q, want %q", result.Inspect(), c.Result)
+		}
+	}
+	if c.Output != nil && out.String() != *c.Output {
+		return fmt.Errorf("output: got %q, want %q", out.String(), *c.Output)
+	}
+	return nil
+}
+
+// execute はマクロを展開してから program を engine で実行し、最後の式文の値を返す
+func execute(program *ast.Program, engine string) (object.Object, error) {
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		return nil, err
+	}
+	program = expanded.(*ast.Program)
+
+	var result object.Object
+	switch engine {
+	case "vm":
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			return nil, err
+		}
+		machine := vm.New(compiler.Optimize(comp.Bytecode()))
+		if err := machine.Run(); err != nil {
+			return nil, err
+		}
+		result = machine.LastPoppedStackElem()
+	case "rvm":
+		comp := compiler.NewRegisterCompiler()
+		if err := comp.Compile(program); err != nil {
+			return nil, err
+		}
+		machine := vm.NewRegisterVM(comp.Program())
+		if err := machine.Run(); err != nil {
+			return nil, err
+		}
+		result = machine.LastEvaluated()
+	case "eval":
+		var err error
+		result, err = evaluator.SafeEval(program, object.NewEnvironment())
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := result.(*object.Error); ok {
+			return nil, fmt.Errorf("%s", e.Message)
+		}
+	default:
+		return nil, fmt.Errorf("unknown engine: %s", engine)
+	}
+
+	// 最後の文が式でなければ値はない
+	if n := len(program.Statements); n == 0 {
+		return nil, nil
+	} else if _, ok := program.Statements[n-1].(*ast.ExpressionStatement); !ok {
+		return nil, nil
+	}
+	return result, nil
+}
+
+func compare(what string, got, want []string) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("%s: got %q, want %q", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return fmt.Errorf("%s: got %q, want %q", what, got, want)
+		}
+	}
+	return nil
+}
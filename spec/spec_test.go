@@ -0,0 +1,85 @@
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestCorpus は testdata の全てのケースを全てのエンジンで実行する
+func TestCorpus(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no testdata/*.json files found")
+	}
+
+	for _, path := range paths {
+		cases, err := Load(os.DirFS("."), filepath.ToSlash(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cases {
+			for _, engine := range Engines {
+				if !c.Applies(engine) {
+					continue
+				}
+				if err := Run(c, engine); err != nil {
+					t.Errorf("%s: %s (%s): %s", path, c.Name, engine, err)
+				}
+			}
+		}
+	}
+}
+
+func TestRunReportsMismatch(t *testing.T) {
+	output := "1\n"
+	tests := []struct {
+		c   Case
+		err string
+	}{
+		{Case{Input: "1 + 2", AST: "(1 + 2)", Result: "3"}, ""},
+		{Case{Input: "1 + 2", AST: "(2 + 1)"}, `ast: got "(1 + 2)", want "(2 + 1)"`},
+		{Case{Input: "1 + 2", Result: "4"}, `result: got "3", want "4"`},
+		{Case{Input: "let x = 1;", Result: "1"}, `result: got none, want "1"`},
+		{Case{Input: "1 + true", Result: "2"}, `error: got "type mismatch: INTEGER + BOOLEAN", want ""`},
+		{Case{Input: "1 + true", AST: "(1 + true)"}, ""},
+		{Case{Input: "let x 1"}, `parse errors: got ["expected next token to be =, got INT instead"], want []`},
+		{Case{Input: "puts(2)", Output: &output}, `output: got "2\n", want "1\n"`},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range Engines {
+			err := Run(tt.c, engine)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.err {
+				t.Errorf("%q (%s): got %q, want %q", tt.c.Input, engine, got, tt.err)
+			}
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ok.json":  {Data: []byte(`[{"name": "one", "input": "1", "result": "1", "engines": ["vm"]}]`)},
+		"bad.json": {Data: []byte(`{"name": "one"}`)},
+	}
+
+	cases, err := Load(fsys, "ok.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 1 || cases[0].Name != "one" || !cases[0].Applies("vm") || cases[0].Applies("eval") {
+		t.Errorf("wrong cases: %+v", cases)
+	}
+	if _, err := Load(fsys, "bad.json"); err == nil || !strings.HasPrefix(err.Error(), "bad.json: ") {
+		t.Errorf("expected an error naming the file, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package token
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Pos は FileSet の中の位置。ファイルの Base にファイル内のバイトオフセットを足したもの。
+// 複数のファイルの位置を1つの整数で区別できるので、構文木や解析結果に持たせやすい
+type Pos int
+
+// NoPos は位置がないことを表す
+const NoPos Pos = 0
+
+func (p Pos) IsValid() bool { return p != NoPos }
+
+// Position は人が読む形の位置
+type Position struct {
+	Filename string
+	Offset   int // 0始まりのバイトオフセット
+	Line     int // 1始まりの行番号
+	Column   int // 1始まりの列番号(バイト単位)
+}
+
+func (pos Position) IsValid() bool { return pos.Line > 0 }
+
+// String は file:line:column の形で返す。ファイル名がなければ line:column
+func (pos Position) String() string {
+	if !pos.IsValid() {
+		if pos.Filename == "" {
+			return "-"
+		}
+		return pos.Filename
+	}
+	if pos.Filename == "" {
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", pos.Filename, pos.Line, pos.Column)
+}
+
+// File は1つのファイルの行の先頭のオフセットを持ち、オフセットを行と列に変換する。
+// 行は AddLine で足していく。lexer.NewFile で作った Lexer は読みながら足す
+type File struct {
+	name  string
+	base  int
+	size  int
+	lines []int // 各行の先頭のオフセット。lines[0] は常に 0
+}
+
+func (f *File) Name() string { return f.name }
+func (f *File) Base() int    { return f.base }
+func (f *File) Size() int    { return f.size }
+
+// LineCount は分かっている行の数
+func (f *File) LineCount() int { return len(f.lines) }
+
+// AddLine は offset から新しい行が始まることを記録する。
+// 最後の行より前のオフセットは無視するので、同じ所を読み直しても行は増えない。
+// offset が Size を超えていればファイルが伸びたものとする
+func (f *File) AddLine(offset int) {
+	if offset <= f.lines[len(f.lines)-1] {
+		return
+	}
+	f.lines = append(f.lines, offset)
+	if offset > f.size {
+		f.size = offset
+	}
+}
+
+// SetSize は大きさの分からないまま読んでいたファイルの大きさを決める
+func (f *File) SetSize(size int) {
+	if size > f.size {
+		f.size = size
+	}
+}
+
+// SetLinesForContent は src の改行から全ての行を記録する
+func (f *File) SetLinesForContent(src []byte) {
+	for i, b := range src {
+		if b == '\n' {
+			f.AddLine(i + 1)
+		}
+	}
+	f.SetSize(len(src))
+}
+
+// Pos はファイル内のオフセットを Pos に変換する
+func (f *File) Pos(offset int) Pos {
+	return Pos(f.base + offset)
+}
+
+// Offset は Pos をファイル内のオフセットに変換する
+func (f *File) Offset(p Pos) int {
+	return int(p) - f.base
+}
+
+// Position は p の行と列を返す
+func (f *File) Position(p Pos) Position {
+	if !p.IsValid() {
+		return Position{}
+	}
+	offset := f.Offset(p)
+	line := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	return Position{
+		Filename: f.name,
+		Offset:   offset,
+		Line:     line + 1,
+		Column:   offset - f.lines[line] + 1,
+	}
+}
+
+// FileSet は複数のファイルに重ならない Pos の範囲を割り当てる。
+// 構文解析器、解析器、整形器、エラーの表示が同じ FileSet を共有すれば、Pos だけで位置を受け渡せる
+type FileSet struct {
+	files []*File
+}
+
+func NewFileSet() *FileSet {
+	return &FileSet{}
+}
+
+// Base は次に AddFile するファイルの Base。0 は NoPos なので 1 から始める
+func (s *FileSet) Base() int {
+	if len(s.files) == 0 {
+		return 1
+	}
+	last := s.files[len(s.files)-1]
+	return last.base + last.size + 1
+}
+
+// AddFile は大きさ size のファイルを加える。大きさの分からないまま読むファイルは 0 を渡し、
+// 読み終えてから次のファイルを加える
+func (s *FileSet) AddFile(name string, size int) *File {
+	f := &File{name: name, base: s.Base(), size: size, lines: []int{0}}
+	s.files = append(s.files, f)
+	return f
+}
+
+// File は p を含むファイルを返す。なければ nil
+func (s *FileSet) File(p Pos) *File {
+	if !p.IsValid() {
+		return nil
+	}
+	for _, f := range s.files {
+		if f.base <= int(p) && int(p) <= f.base+f.size {
+			return f
+		}
+	}
+	return nil
+}
+
+// Position は p の位置を返す。どのファイルにもなければ無効な Position
+func (s *FileSet) Position(p Pos) Position {
+	if f := s.File(p); f != nil {
+		return f.Position(p)
+	}
+	return Position{}
+}
@@ -5,25 +5,36 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // 1始まりの行番号
+	Column  int // 1始まりの列番号(バイト単位)
+	Offset  int // 0始まりのバイトオフセット。File.Pos で Pos にできる
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
 
-	IDENT = "IDENT" // add, forbar, x, y..
-	INT   = "INT"
+	// COMMENT は Lexer の EmitComments が true のときだけ返る
+	COMMENT = "COMMENT"
+
+	IDENT  = "IDENT" // add, forbar, x, y..
+	INT    = "INT"
+	FLOAT  = "FLOAT" // 1.5
+	STRING = "STRING"
 
 	ASSIGN = "="
 	PLUS   = "+"
 
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 
-	LPAREN = "("
-	RPAREN = ")"
-	LBRACE = "{"
-	RBRACE = "}"
+	LPAREN   = "("
+	RPAREN   = ")"
+	LBRACE   = "{"
+	RBRACE   = "}"
+	LBRACKET = "["
+	RBRACKET = "]"
 
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
@@ -43,6 +54,8 @@ const (
 	IF     = "IF"
 	ELSE   = "ELSE"
 	RETURN = "RETURN"
+	WHILE  = "WHILE"
+	MACRO  = "MACRO"
 )
 
 var keywords = map[string]TokenType{
@@ -53,6 +66,8 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"while":  WHILE,
+	"macro":  MACRO,
 }
 
 func LookupIdent(ident string) TokenType {
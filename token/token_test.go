@@ -0,0 +1,49 @@
+package token
+
+import "testing"
+
+func TestFileSet(t *testing.T) {
+	fset := NewFileSet()
+	a := fset.AddFile("a.monkey", 0)
+	a.SetLinesForContent([]byte("let x = 1;\nlet y = 2;\n\nx + y"))
+	b := fset.AddFile("b.monkey", 0)
+	// 読みながら行を足していくファイル
+	b.AddLine(4)
+	b.AddLine(4)
+	b.SetSize(10)
+
+	tests := []struct {
+		pos      Pos
+		expected string
+	}{
+		{a.Pos(0), "a.monkey:1:1"},
+		{a.Pos(8), "a.monkey:1:9"},
+		{a.Pos(11), "a.monkey:2:1"},
+		{a.Pos(22), "a.monkey:3:1"},
+		{a.Pos(27), "a.monkey:4:5"},
+		{b.Pos(0), "b.monkey:1:1"},
+		{b.Pos(6), "b.monkey:2:3"},
+		{b.Pos(10), "b.monkey:2:7"},
+		{NoPos, "-"},
+		{Pos(1000), "-"},
+	}
+
+	for _, tt := range tests {
+		if got := fset.Position(tt.pos).String(); got != tt.expected {
+			t.Errorf("Position(%d) wrong. want=%q, got=%q", tt.pos, tt.expected, got)
+		}
+	}
+
+	if b.Base() != a.Base()+a.Size()+1 {
+		t.Errorf("files overlap. a=%d+%d, b=%d", a.Base(), a.Size(), b.Base())
+	}
+	if b.LineCount() != 2 {
+		t.Errorf("wrong line count. want=2, got=%d", b.LineCount())
+	}
+	if f := fset.File(b.Pos(3)); f != b {
+		t.Errorf("File returned %v", f)
+	}
+	if offset := b.Offset(b.Pos(7)); offset != 7 {
+		t.Errorf("Offset wrong. want=7, got=%d", offset)
+	}
+}
@@ -0,0 +1,296 @@
+// Package trace は評価器の実行を記録し、後から1文ずつたどれるようにする。
+//
+// 記録は1行に1つの JSON の Event を並べたもの (JSON Lines)。文を評価し始めるたびに
+// 新しい step の Event を書き、let や代入で変数に値が入ると、その文の step を付けた Event を書く。
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/printer"
+)
+
+// Event は記録の1行。Stmt が空でなければ文の評価の始まり、Set が空でなければ変数の変化を表す
+type Event struct {
+	Step  int    `json:"step"`
+	Line  int    `json:"line,omitempty"`
+	Stmt  string `json:"stmt,omitempty"`
+	Set   string `json:"set,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// Recorder は evaluator.Tracer として評価器に渡し、Event を w に書き出す
+type Recorder struct {
+	enc   *json.Encoder
+	step  int
+	stack []int // 評価中の文の step。関数呼び出しで入れ子になる
+	err   error
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+func (r *Recorder) Enter(s ast.Statement) {
+	r.step++
+	r.stack = append(r.stack, r.step)
+	r.write(Event{Step: r.step, Line: statementLine(s), Stmt: oneLine(printer.Format(s))})
+}
+
+func (r *Recorder) Leave(s ast.Statement) {
+	r.stack = r.stack[:len(r.stack)-1]
+}
+
+func (r *Recorder) Set(name string, val object.Object) {
+	step := 0
+	if len(r.stack) > 0 {
+		step = r.stack[len(r.stack)-1]
+	}
+	r.write(Event{Step: step, Set: name, Value: oneLine(val.Inspect())})
+}
+
+// Err は書き出しで最初に起きたエラーを返す
+func (r *Recorder) Err() error {
+	return r.err
+}
+
+func (r *Recorder) write(e Event) {
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode(e)
+}
+
+var lineBreak = regexp.MustCompile(`\s*\n\s*`)
+
+// oneLine は改行とその前後の字下げを空白1つにまとめ、記録の1行に収まるようにする
+func oneLine(s string) string {
+	return lineBreak.ReplaceAllString(s, " ")
+}
+
+func statementLine(s ast.Statement) int {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		return s.Token.Line
+	case *ast.AssignStatement:
+		return s.Token.Line
+	case *ast.ReturnStatement:
+		return s.Token.Line
+	case *ast.ExpressionStatement:
+		return s.Token.Line
+	case *ast.BlockStatement:
+		return s.Token.Line
+	}
+	return 0
+}
+
+// Read は Recorder が書き出した記録を読み込む
+func Read(r io.Reader) ([]Event, error) {
+	events := []Event{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("trace: line %d: %s", n, err)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+const viewHelp = `commands:
+  n, <enter>  next statement
+  b           previous statement
+  g N         go to step N
+  v           latest value of every variable up to this point
+  watch NAME  report every change of NAME while stepping (watch alone lists them)
+  history NAME
+              every value NAME took, with the step and line of each change
+  q           quit
+`
+
+// View は in から1行ずつコマンドを読み、記録を1文ずつ out に表示する
+func View(events []Event, in io.Reader, out io.Writer) {
+	// 文の Event の位置。各文の表示には、次の文までに起きた変数の変化も含める
+	stmts := []int{}
+	for i, e := range events {
+		if e.Stmt != "" {
+			stmts = append(stmts, i)
+		}
+	}
+	if len(stmts) == 0 {
+		fmt.Fprintln(out, "trace is empty")
+		return
+	}
+
+	cur := 0
+	watches := []string{}
+	show := func() {
+		start := stmts[cur]
+		end := nextStatement(stmts, cur, len(events))
+		e := events[start]
+		fmt.Fprintf(out, "[%d/%d] line %d: %s\n", cur+1, len(stmts), e.Line, e.Stmt)
+		for i := start + 1; i < end; i++ {
+			set := events[i]
+			if set.Step == e.Step {
+				fmt.Fprintf(out, "  %s = %s\n", set.Set, set.Value)
+			} else {
+				fmt.Fprintf(out, "  %s = %s (step %d)\n", set.Set, set.Value, set.Step)
+			}
+			if contains(watches, set.Set) {
+				fmt.Fprintf(out, "  watch %s: %s -> %s\n", set.Set, previousValue(events[:i], set.Set), set.Value)
+			}
+		}
+	}
+
+	fmt.Fprint(out, viewHelp)
+	show()
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "trace> ")
+		if !scanner.Scan() {
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		cmd := ""
+		if len(fields) > 0 {
+			cmd = fields[0]
+		}
+
+		switch cmd {
+		case "", "n":
+			if cur+1 >= len(stmts) {
+				fmt.Fprintln(out, "end of trace")
+				continue
+			}
+			cur++
+			show()
+		case "b":
+			if cur == 0 {
+				fmt.Fprintln(out, "start of trace")
+				continue
+			}
+			cur--
+			show()
+		case "g":
+			var n int
+			if len(fields) != 2 {
+				fmt.Fprintln(out, "usage: g N")
+				continue
+			}
+			if _, err := fmt.Sscanf(fields[1], "%d", &n); err != nil || n < 1 || n > len(stmts) {
+				fmt.Fprintf(out, "no step %s\n", fields[1])
+				continue
+			}
+			cur = n - 1
+			show()
+		case "v":
+			printValues(events[:nextStatement(stmts, cur, len(events))], out)
+		case "watch":
+			switch {
+			case len(fields) == 1 && len(watches) == 0:
+				fmt.Fprintln(out, "no watches")
+			case len(fields) == 1:
+				fmt.Fprintf(out, "watching %s\n", strings.Join(watches, ", "))
+			case len(fields) == 2:
+				if !contains(watches, fields[1]) {
+					watches = append(watches, fields[1])
+				}
+				fmt.Fprintf(out, "watching %s\n", strings.Join(watches, ", "))
+			default:
+				fmt.Fprintln(out, "usage: watch [NAME]")
+			}
+		case "history":
+			if len(fields) != 2 {
+				fmt.Fprintln(out, "usage: history NAME")
+				continue
+			}
+			printHistory(events, fields[1], out)
+		case "q":
+			return
+		default:
+			fmt.Fprintf(out, "unknown command: %s\n", cmd)
+			fmt.Fprint(out, viewHelp)
+		}
+	}
+}
+
+// nextStatement は cur 番目の文の次の文の位置を返す。最後の文なら記録の終わり
+func nextStatement(stmts []int, cur, end int) int {
+	if cur+1 < len(stmts) {
+		return stmts[cur+1]
+	}
+	return end
+}
+
+// printHistory は name に入った値を記録の順に、変わる前の値と一緒に表示する。スコープは区別しない
+func printHistory(events []Event, name string, out io.Writer) {
+	lines := map[int]int{}
+	found := false
+	for i, e := range events {
+		if e.Stmt != "" {
+			lines[e.Step] = e.Line
+		}
+		if e.Set != name {
+			continue
+		}
+		found = true
+		fmt.Fprintf(out, "  step %d line %d: %s -> %s\n", e.Step, lines[e.Step], previousValue(events[:i], name), e.Value)
+	}
+	if !found {
+		fmt.Fprintf(out, "%s was never set\n", name)
+	}
+}
+
+// previousValue は events の中で name に最後に入った値を返す。まだ入っていなければ "(unset)"
+func previousValue(events []Event, name string) string {
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Set == name {
+			return events[i].Value
+		}
+	}
+	return "(unset)"
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// printValues は events までに記録された各変数の最後の値を名前順に表示する。スコープは区別しない
+func printValues(events []Event, out io.Writer) {
+	values := map[string]string{}
+	for _, e := range events {
+		if e.Set != "" {
+			values[e.Set] = e.Value
+		}
+	}
+	if len(values) == 0 {
+		fmt.Fprintln(out, "no variables yet")
+		return
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s = %s\n", name, values[name])
+	}
+}
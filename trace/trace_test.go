@@ -0,0 +1,131 @@
+package trace
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kurarrr/monkey/evaluator"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/parser"
+)
+
+const script = `let double = fn(x) {
+  let y = x * 2;
+  y
+};
+let a = double(3);
+a = a + 1;
+`
+
+func record(t *testing.T, input string) []Event {
+	t.Helper()
+
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+	evaluator.SetTracer(recorder)
+	defer evaluator.SetTracer(nil)
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	evaluator.Eval(program, object.NewEnvironment())
+	if err := recorder.Err(); err != nil {
+		t.Fatalf("recorder error: %s", err)
+	}
+
+	events, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read error: %s", err)
+	}
+	return events
+}
+
+func TestRecord(t *testing.T) {
+	expected := []Event{
+		{Step: 1, Line: 1, Stmt: "let double = fn(x) { let y = x * 2; y; };"},
+		{Step: 1, Set: "double", Value: "fn(x) { let y = (x * 2);y }"},
+		{Step: 2, Line: 5, Stmt: "let a = double(3);"},
+		{Step: 3, Line: 2, Stmt: "let y = x * 2;"},
+		{Step: 3, Set: "y", Value: "6"},
+		{Step: 4, Line: 3, Stmt: "y;"},
+		// a への let は関数呼び出しの後だが、let 文の step に付く
+		{Step: 2, Set: "a", Value: "6"},
+		{Step: 5, Line: 6, Stmt: "a = a + 1;"},
+		{Step: 5, Set: "a", Value: "7"},
+	}
+
+	events := record(t, script)
+	if len(events) != len(expected) {
+		t.Fatalf("wrong number of events. want=%d, got=%d: %+v", len(expected), len(events), events)
+	}
+	for i, e := range expected {
+		if events[i] != e {
+			t.Errorf("event %d: want=%+v, got=%+v", i, e, events[i])
+		}
+	}
+}
+
+func TestView(t *testing.T) {
+	events := record(t, script)
+
+	var out bytes.Buffer
+	View(events, strings.NewReader("n\n\nv\nb\ng 5\nn\ng 9\nx\nq\n"), &out)
+
+	expected := viewHelp +
+		"[1/5] line 1: let double = fn(x) { let y = x * 2; y; };\n" +
+		"  double = fn(x) { let y = (x * 2);y }\n" +
+		"trace> [2/5] line 5: let a = double(3);\n" +
+		"trace> [3/5] line 2: let y = x * 2;\n" +
+		"  y = 6\n" +
+		"trace>   double = fn(x) { let y = (x * 2);y }\n" +
+		"  y = 6\n" +
+		"trace> [2/5] line 5: let a = double(3);\n" +
+		"trace> [5/5] line 6: a = a + 1;\n" +
+		"  a = 7\n" +
+		"trace> end of trace\n" +
+		"trace> no step 9\n" +
+		"trace> unknown command: x\n" + viewHelp +
+		"trace> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestWatch(t *testing.T) {
+	events := record(t, script)
+
+	var out bytes.Buffer
+	View(events, strings.NewReader("watch\nwatch a\nn\nn\nn\nn\nhistory a\nhistory y\nhistory z\nhistory\n"), &out)
+
+	expected := viewHelp +
+		"[1/5] line 1: let double = fn(x) { let y = x * 2; y; };\n" +
+		"  double = fn(x) { let y = (x * 2);y }\n" +
+		"trace> no watches\n" +
+		"trace> watching a\n" +
+		"trace> [2/5] line 5: let a = double(3);\n" +
+		"trace> [3/5] line 2: let y = x * 2;\n" +
+		"  y = 6\n" +
+		"trace> [4/5] line 3: y;\n" +
+		"  a = 6 (step 2)\n" +
+		"  watch a: (unset) -> 6\n" +
+		"trace> [5/5] line 6: a = a + 1;\n" +
+		"  a = 7\n" +
+		"  watch a: 6 -> 7\n" +
+		"trace>   step 2 line 5: (unset) -> 6\n" +
+		"  step 5 line 6: 6 -> 7\n" +
+		"trace>   step 3 line 2: (unset) -> 6\n" +
+		"trace> z was never set\n" +
+		"trace> usage: history NAME\n" +
+		"trace> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestReadError(t *testing.T) {
+	_, err := Read(strings.NewReader("{\"step\":1}\nnot json\n"))
+	expected := "trace: line 2: invalid character 'o' in literal null (expecting 'u')"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package usagestats は CLI のサブコマンドや組み込み関数がどれだけ使われたかを手元のファイルに記録する。
+//
+// 社内向けに monkey を配布する埋め込み先が、利用者の頼っている機能を知るためのもの。
+// 既定では何も記録せず、記録はホストが Hook を渡したときだけ行う。
+// 記録はどこにも送らない。FileHook はローカルの JSON ファイルに回数を足していくだけ。
+package usagestats
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/kurarrr/monkey/object"
+)
+
+// Event は CLI を1回実行したときの記録
+type Event struct {
+	Command  string         // "run", "repl", "fmt" など
+	Engine   string         // "eval", "vm", "rvm"。エンジンを使わないコマンドでは空
+	Builtins map[string]int // 呼ばれた組み込み関数とその回数
+}
+
+// Hook は Event を受け取って記録するもの
+type Hook interface {
+	Record(Event) error
+}
+
+// Stats は FileHook が書き出す集計
+type Stats struct {
+	Commands map[string]int `json:"commands"`
+	Engines  map[string]int `json:"engines"`
+	Builtins map[string]int `json:"builtins"`
+}
+
+// FileHook は Event の回数を Path の JSON ファイルに足していく Hook
+type FileHook struct {
+	Path string
+}
+
+func (h FileHook) Record(ev Event) error {
+	stats, err := ReadStats(h.Path)
+	if err != nil {
+		return err
+	}
+	stats.Commands[ev.Command]++
+	if ev.Engine != "" {
+		stats.Engines[ev.Engine]++
+	}
+	for name, n := range ev.Builtins {
+		stats.Builtins[name] += n
+	}
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 途中で止まっても壊れたファイルが残らないよう、一時ファイルに書いてから置き換える
+	tmp := h.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.Path)
+}
+
+// ReadStats は FileHook の書いたファイルを読む。ファイルがなければ空の集計を返す
+func ReadStats(path string) (*Stats, error) {
+	stats := &Stats{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, stats); err != nil {
+			return nil, &os.PathError{Op: "read", Path: filepath.Clean(path), Err: err}
+		}
+	}
+	if stats.Commands == nil {
+		stats.Commands = map[string]int{}
+	}
+	if stats.Engines == nil {
+		stats.Engines = map[string]int{}
+	}
+	if stats.Builtins == nil {
+		stats.Builtins = map[string]int{}
+	}
+	return stats, nil
+}
+
+// CountBuiltins は object.Builtins の全ての組み込み関数を呼ばれた回数を数えるように包む。
+// 評価器と VM は同じ Builtin を使うので、どちらのエンジンでも数えられる。
+// 返す関数は包む前に戻し、それまでの回数を返す。数えている間は RegisterBuiltin を呼ばないこと
+func CountBuiltins() func() map[string]int {
+	var mu sync.Mutex
+	counts := map[string]int{}
+	originals := make([]object.BuiltinFunction, len(object.Builtins))
+	for i, def := range object.Builtins {
+		name, fn := def.Name, def.Builtin.Fn
+		originals[i] = fn
+		def.Builtin.Fn = func(args ...object.Object) object.Object {
+			mu.Lock()
+			counts[name]++
+			mu.Unlock()
+			return fn(args...)
+		}
+	}
+
+	return func() map[string]int {
+		for i, def := range object.Builtins[:len(originals)] {
+			def.Builtin.Fn = originals[i]
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return counts
+	}
+}
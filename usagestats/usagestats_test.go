@@ -0,0 +1,64 @@
+package usagestats
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kurarrr/monkey/object"
+)
+
+func TestFileHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	hook := FileHook{Path: path}
+
+	events := []Event{
+		{Command: "run", Engine: "vm", Builtins: map[string]int{"puts": 2, "len": 1}},
+		{Command: "run", Engine: "eval", Builtins: map[string]int{"puts": 1}},
+		{Command: "fmt"},
+	}
+	for _, ev := range events {
+		if err := hook.Record(ev); err != nil {
+			t.Fatalf("Record error: %s", err)
+		}
+	}
+
+	stats, err := ReadStats(path)
+	if err != nil {
+		t.Fatalf("ReadStats error: %s", err)
+	}
+	expected := &Stats{
+		Commands: map[string]int{"run": 2, "fmt": 1},
+		Engines:  map[string]int{"vm": 1, "eval": 1},
+		Builtins: map[string]int{"puts": 3, "len": 1},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("wrong stats. want=%+v, got=%+v", expected, stats)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.Record(events[0]); err == nil {
+		t.Errorf("expected an error for a broken file")
+	}
+}
+
+func TestCountBuiltins(t *testing.T) {
+	length := object.GetBuiltinByName("len")
+	original := length.Fn
+
+	stop := CountBuiltins()
+	length.Fn(&object.String{Value: "ab"})
+	length.Fn(&object.Array{})
+	object.GetBuiltinByName("type").Fn(&object.Integer{Value: 1})
+	counts := stop()
+
+	if want := map[string]int{"len": 2, "type": 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("wrong counts. want=%v, got=%v", want, counts)
+	}
+	if reflect.ValueOf(length.Fn).Pointer() != reflect.ValueOf(original).Pointer() {
+		t.Errorf("builtin was not restored")
+	}
+}
@@ -0,0 +1,257 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/object"
+)
+
+// 命令ごとの処理を関数の表に並べて呼び出す実行ループ(Run の switch と比べるための実験)。
+// Run では使わず、switch と同じ結果になるかのテストとベンチマークのためにだけ置く。
+// Go には computed goto がないので、表引きと間接呼び出しで近いものを作る。
+// ハンドラは ip をオペランドの直後まで進める。ジャンプは飛び先の1つ手前に合わせる。
+
+type opHandler func(vm *VM, f *Frame, ins code.Instructions, ip int) error
+
+var opHandlers [256]opHandler
+
+func init() {
+	opHandlers[code.OpConstant] = opConstant
+	opHandlers[code.OpAdd] = opBinary
+	opHandlers[code.OpSub] = opBinary
+	opHandlers[code.OpMul] = opBinary
+	opHandlers[code.OpDiv] = opBinary
+	opHandlers[code.OpEqual] = opComparison
+	opHandlers[code.OpNotEqual] = opComparison
+	opHandlers[code.OpGreaterThan] = opComparison
+	opHandlers[code.OpLessThan] = opComparison
+	opHandlers[code.OpAddConstant] = opBinaryConstant
+	opHandlers[code.OpSubConstant] = opBinaryConstant
+	opHandlers[code.OpEqualJumpNotTruthy] = opComparisonJump
+	opHandlers[code.OpNotEqualJumpNotTruthy] = opComparisonJump
+	opHandlers[code.OpGreaterThanJumpNotTruthy] = opComparisonJump
+	opHandlers[code.OpLessThanJumpNotTruthy] = opComparisonJump
+	opHandlers[code.OpBang] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		return vm.executeBangOperator()
+	}
+	opHandlers[code.OpMinus] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		return vm.executeMinusOperator()
+	}
+	opHandlers[code.OpPop] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		vm.sp--
+		return nil
+	}
+	opHandlers[code.OpTrue] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		return vm.push(True)
+	}
+	opHandlers[code.OpFalse] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		return vm.push(False)
+	}
+	opHandlers[code.OpNull] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		return vm.push(Null)
+	}
+	opHandlers[code.OpJump] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+		return nil
+	}
+	opHandlers[code.OpJumpNotTruthy] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 2
+		if !isTruthy(vm.pop()) {
+			f.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+		}
+		return nil
+	}
+	opHandlers[code.OpSetGlobal] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 2
+		vm.globals[code.ReadUint16(ins[ip+1:])] = vm.pop()
+		return nil
+	}
+	opHandlers[code.OpGetGlobal] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 2
+		return vm.push(vm.globals[code.ReadUint16(ins[ip+1:])])
+	}
+	opHandlers[code.OpSetLocal] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 1
+		vm.stack[f.basePointer+int(ins[ip+1])] = vm.pop()
+		return nil
+	}
+	opHandlers[code.OpGetLocal] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 1
+		return vm.push(vm.stack[f.basePointer+int(ins[ip+1])])
+	}
+	opHandlers[code.OpGetBuiltin] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 1
+		return vm.push(object.Builtins[ins[ip+1]].Builtin)
+	}
+	opHandlers[code.OpGetFree] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 1
+		return vm.push(f.cl.Free[ins[ip+1]])
+	}
+	opHandlers[code.OpArray] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		numElements := int(code.ReadUint16(ins[ip+1:]))
+		f.ip += 2
+
+		array := vm.buildArray(vm.sp-numElements, vm.sp)
+		vm.sp = vm.sp - numElements
+		return vm.push(array)
+	}
+	opHandlers[code.OpHash] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		numElements := int(code.ReadUint16(ins[ip+1:]))
+		f.ip += 2
+
+		hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+		if err != nil {
+			return err
+		}
+		vm.sp = vm.sp - numElements
+		return vm.push(hash)
+	}
+	opHandlers[code.OpIndex] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		index := vm.pop()
+		left := vm.pop()
+		return vm.executeIndexExpression(left, index)
+	}
+	opHandlers[code.OpCall] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 1
+		return vm.executeCall(int(ins[ip+1]))
+	}
+	opHandlers[code.OpReturnValue] = opReturnValue
+	opHandlers[code.OpReturn] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		frame := vm.popFrame()
+		vm.sp = frame.basePointer - 1
+		return vm.push(Null)
+	}
+	opHandlers[code.OpClosure] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 3
+		return vm.pushClosure(int(code.ReadUint16(ins[ip+1:])), int(ins[ip+3]))
+	}
+	opHandlers[code.OpCurrentClosure] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		return vm.push(f.cl)
+	}
+	opHandlers[code.OpMakeCell] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 1
+		vm.makeCell(f, int(ins[ip+1]))
+		return nil
+	}
+	opHandlers[code.OpGetLocalCell] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 1
+		return vm.push(vm.stack[f.basePointer+int(ins[ip+1])].(*object.Cell).Value)
+	}
+	opHandlers[code.OpSetLocalCell] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 1
+		vm.stack[f.basePointer+int(ins[ip+1])].(*object.Cell).Value = vm.pop()
+		return nil
+	}
+	opHandlers[code.OpGetFreeCell] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 1
+		return vm.push(f.cl.Free[ins[ip+1]].(*object.Cell).Value)
+	}
+	opHandlers[code.OpSetFreeCell] = func(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+		f.ip += 1
+		f.cl.Free[ins[ip+1]].(*object.Cell).Value = vm.pop()
+		return nil
+	}
+}
+
+// runTable は run と同じ命令列を opHandlers の表引きで実行する。run と同じく実行した命令を数える。
+// 実行中のフレームと命令列は呼び出し・戻りのときだけ取り直す
+func (vm *VM) runTable() error {
+	f := vm.currentFrame()
+	ins := f.Instructions()
+
+	for f.ip < len(ins)-1 {
+		f.ip++
+		vm.steps++
+		ip := f.ip
+
+		handler := opHandlers[ins[ip]]
+		if handler == nil {
+			return fmt.Errorf("unknown opcode %d", ins[ip])
+		}
+		if err := handler(vm, f, ins, ip); err != nil {
+			if err == errHalt {
+				return nil
+			}
+			return err
+		}
+
+		if current := vm.frames[vm.framesIndex-1]; current != f {
+			f = current
+			ins = f.Instructions()
+		}
+	}
+
+	return nil
+}
+
+// errHalt はトップレベルの return で実行を終えるためにハンドラが返す
+var errHalt = errors.New("halt")
+
+func opConstant(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+	f.ip += 2
+	return vm.push(vm.constants[code.ReadUint16(ins[ip+1:])])
+}
+
+// opBinary は整数どうしの演算だけ Type() を呼ばずに済ませ、それ以外は Run と同じ処理に任せる
+func opBinary(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+	op := code.Opcode(ins[ip])
+	l, lok := vm.stack[vm.sp-2].(*object.Integer)
+	r, rok := vm.stack[vm.sp-1].(*object.Integer)
+	if !lok || !rok || (op == code.OpDiv && r.Value == 0) {
+		return vm.executeBinaryOperation(op)
+	}
+
+	var result int64
+	var ok bool
+	switch op {
+	case code.OpAdd:
+		result, ok = object.AddInt(l.Value, r.Value)
+	case code.OpSub:
+		result, ok = object.SubInt(l.Value, r.Value)
+	case code.OpMul:
+		result, ok = object.MulInt(l.Value, r.Value)
+	default:
+		result, ok = object.DivInt(l.Value, r.Value)
+	}
+	if !ok {
+		return vm.executeBinaryOperation(op)
+	}
+	vm.sp--
+	vm.stack[vm.sp-1] = &object.Integer{Value: result}
+	return nil
+}
+
+func opComparison(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+	return vm.executeComparison(code.Opcode(ins[ip]))
+}
+
+func opBinaryConstant(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+	f.ip += 2
+	return vm.executeBinaryConstantOperation(code.Opcode(ins[ip]), vm.constants[code.ReadUint16(ins[ip+1:])])
+}
+
+func opComparisonJump(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+	f.ip += 2
+	truthy, err := vm.executeComparisonForJump(code.Opcode(ins[ip]))
+	if err != nil {
+		return err
+	}
+	if !truthy {
+		f.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+	}
+	return nil
+}
+
+func opReturnValue(vm *VM, f *Frame, ins code.Instructions, ip int) error {
+	returnValue := vm.pop()
+
+	if vm.framesIndex == 1 {
+		return errHalt
+	}
+
+	frame := vm.popFrame()
+	vm.sp = frame.basePointer - 1
+	return vm.push(returnValue)
+}
@@ -0,0 +1,25 @@
+package vm
+
+import (
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/object"
+)
+
+// Frame は関数呼び出し1回分の実行状態
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{
+		cl:          cl,
+		ip:          -1,
+		basePointer: basePointer,
+	}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,355 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/compiler"
+	"github.com/kurarrr/monkey/logging"
+	"github.com/kurarrr/monkey/metrics"
+	"github.com/kurarrr/monkey/object"
+)
+
+// RegisterFileSize はレジスタ VM が全フレームで共有するレジスタの数
+const RegisterFileSize = 65536
+
+// RegisterVM は compiler.RegisterCompiler の出力を実行する実験的な VM (--engine=rvm)。
+// 各フレームはレジスタファイルの base 以降を自分のレジスタとして使う。
+// 呼び出し先の base は呼び出し元の RCall の A の1つ後ろなので、引数はコピーせずにそのまま引数のレジスタになる
+type RegisterVM struct {
+	constants []object.Object
+	globals   []object.Object
+
+	regs []object.Object
+
+	frames      []registerFrame
+	framesIndex int
+
+	last object.Object
+
+	steps int64 // 実行した命令の数。Run の終わりに metrics に足す
+
+	poisoned *object.InternalError // Run 中に panic していれば、そのエラー
+
+	// ops は型ごとの演算やエラーメッセージをスタック VM と共有するための作業用 VM。
+	// 使うのはオペランド2つ分のスタックだけ
+	ops *VM
+}
+
+type registerFrame struct {
+	cl   *object.Closure
+	ip   int
+	base int
+}
+
+func NewRegisterVM(program *compiler.RegisterProgram) *RegisterVM {
+	frames := make([]registerFrame, MaxFrames)
+	frames[0] = registerFrame{cl: &object.Closure{Fn: program.Main}}
+
+	return &RegisterVM{
+		constants:   program.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		regs:        make([]object.Object, RegisterFileSize),
+		frames:      frames,
+		framesIndex: 1,
+		ops:         &VM{stack: make([]object.Object, 2)},
+	}
+}
+
+// NewRegisterVMWithGlobalsStore は REPL のように実行をまたいでグローバル変数を引き継ぐときに使う
+func NewRegisterVMWithGlobalsStore(program *compiler.RegisterProgram, s []object.Object) *RegisterVM {
+	vm := NewRegisterVM(program)
+	vm.globals = s
+	return vm
+}
+
+// SetCompat は c の振る舞いで実行するようにする。Run の前に呼ぶ
+func (vm *RegisterVM) SetCompat(c object.Compat) {
+	vm.ops.compat = c
+}
+
+// LastEvaluated はトップレベルで最後に評価した式文の値を返す。何も評価していなければ nil
+func (vm *RegisterVM) LastEvaluated() object.Object {
+	return vm.last
+}
+
+// Run はプログラムを実行する。実行中に Go の panic が起きれば *object.InternalError にして返し、
+// この VM はそれ以降 *object.PoisonedError を返して何も実行しない
+func (vm *RegisterVM) Run() (err error) {
+	if vm.poisoned != nil {
+		return &object.PoisonedError{Cause: vm.poisoned}
+	}
+	metrics.Evaluations.Inc()
+	metrics.Active.Inc()
+	defer func() {
+		if r := recover(); r != nil {
+			vm.poisoned = object.NewInternalError(r)
+			logging.Debug("vm: panic", "engine", "register", "err", vm.poisoned, "stack", string(vm.poisoned.Stack))
+			err = vm.poisoned
+		}
+		metrics.Active.Dec()
+		metrics.Instructions.Add(vm.steps)
+		vm.steps = 0
+		if err != nil {
+			metrics.Errors.Inc()
+			logging.Debug("vm: run failed", "engine", "register", "err", err)
+		}
+	}()
+	return vm.run()
+}
+
+func (vm *RegisterVM) run() error {
+	if vm.frames[0].cl.Fn.NumRegisters > len(vm.regs) {
+		limitReached("registers", len(vm.regs))
+		return fmt.Errorf("stack overflow")
+	}
+
+	f := &vm.frames[0]
+	ins := f.cl.Fn.RegisterCode
+	r := vm.regs[f.base:]
+
+	for f.ip < len(ins) {
+		in := ins[f.ip]
+		f.ip++
+		vm.steps++
+
+		switch in.Op {
+		case code.RLoadConstant:
+			r[in.A] = vm.constants[in.B]
+		case code.RLoadTrue:
+			r[in.A] = True
+		case code.RLoadFalse:
+			r[in.A] = False
+		case code.RLoadNull:
+			r[in.A] = Null
+		case code.RMove:
+			r[in.A] = r[in.B]
+
+		case code.RGetGlobal:
+			r[in.A] = vm.globals[in.B]
+		case code.RSetGlobal:
+			vm.globals[in.A] = r[in.B]
+		case code.RGetBuiltin:
+			r[in.A] = object.Builtins[in.B].Builtin
+		case code.RGetFree:
+			r[in.A] = f.cl.Free[in.B]
+		case code.RCurrentClosure:
+			r[in.A] = f.cl
+
+		case code.RAdd, code.RSub, code.RMul, code.RDiv:
+			left, lok := r[in.B].(*object.Integer)
+			right, rok := r[in.C].(*object.Integer)
+			if lok && rok && in.Op != code.RDiv {
+				// 整数の加減乗算だけはその場で計算する。桁あふれしたら vm.binary で BIGINT にする
+				var result int64
+				var ok bool
+				switch in.Op {
+				case code.RAdd:
+					result, ok = object.AddInt(left.Value, right.Value)
+				case code.RSub:
+					result, ok = object.SubInt(left.Value, right.Value)
+				default:
+					result, ok = object.MulInt(left.Value, right.Value)
+				}
+				if ok {
+					r[in.A] = &object.Integer{Value: result}
+					continue
+				}
+			}
+			result, err := vm.binary(in.Op, r[in.B], r[in.C])
+			if err != nil {
+				return err
+			}
+			r[in.A] = result
+
+		case code.REqual, code.RNotEqual, code.RGreaterThan, code.RLessThan:
+			left, lok := r[in.B].(*object.Integer)
+			right, rok := r[in.C].(*object.Integer)
+			if lok && rok {
+				switch in.Op {
+				case code.REqual:
+					r[in.A] = nativeBoolToBooleanObject(left.Value == right.Value)
+				case code.RNotEqual:
+					r[in.A] = nativeBoolToBooleanObject(left.Value != right.Value)
+				case code.RLessThan:
+					r[in.A] = nativeBoolToBooleanObject(left.Value < right.Value)
+				default:
+					r[in.A] = nativeBoolToBooleanObject(left.Value > right.Value)
+				}
+				continue
+			}
+			result, err := vm.binary(in.Op, r[in.B], r[in.C])
+			if err != nil {
+				return err
+			}
+			r[in.A] = result
+
+		case code.RBang:
+			result, err := vm.unary(vm.ops.executeBangOperator, r[in.B])
+			if err != nil {
+				return err
+			}
+			r[in.A] = result
+		case code.RMinus:
+			result, err := vm.unary(vm.ops.executeMinusOperator, r[in.B])
+			if err != nil {
+				return err
+			}
+			r[in.A] = result
+
+		case code.RJump:
+			f.ip = in.A
+		case code.RJumpIfFalse:
+			if !isTruthy(r[in.A]) {
+				f.ip = in.B
+			}
+
+		case code.RArray:
+			elements := make([]object.Object, in.C)
+			copy(elements, r[in.B:in.B+in.C])
+			r[in.A] = &object.Array{Elements: elements}
+		case code.RHash:
+			pairs := make(map[object.HashKey]object.HashPair)
+			for i := in.B; i < in.B+in.C; i += 2 {
+				key, ok := r[i].(object.Hashable)
+				if !ok {
+					return fmt.Errorf("unusable as hash key: %s", r[i].Type())
+				}
+				pairs[key.HashKey()] = object.HashPair{Key: r[i], Value: r[i+1]}
+			}
+			r[in.A] = &object.Hash{Pairs: pairs}
+		case code.RIndex:
+			vm.ops.sp = 0
+			if err := vm.ops.executeIndexExpression(r[in.B], r[in.C]); err != nil {
+				return err
+			}
+			r[in.A] = vm.ops.pop()
+
+		case code.RCall:
+			switch callee := r[in.A].(type) {
+			case *object.Closure:
+				if in.B != callee.Fn.NumParameters {
+					return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+						callee.Fn.NumParameters, in.B)
+				}
+				if vm.framesIndex >= MaxFrames {
+					limitReached("frames", MaxFrames)
+					return fmt.Errorf("stack overflow: more than %d nested calls", MaxFrames)
+				}
+				base := f.base + in.A + 1
+				if base+callee.Fn.NumRegisters > len(vm.regs) {
+					limitReached("registers", len(vm.regs))
+					return fmt.Errorf("stack overflow")
+				}
+				vm.frames[vm.framesIndex] = registerFrame{cl: callee, base: base}
+				vm.framesIndex++
+
+				f = &vm.frames[vm.framesIndex-1]
+				ins = callee.Fn.RegisterCode
+				r = vm.regs[base:]
+			case *object.Builtin:
+				args := make([]object.Object, in.B)
+				copy(args, r[in.A+1:in.A+1+in.B])
+				result := callee.Fn(args...)
+				if err, ok := result.(*object.Error); ok {
+					return fmt.Errorf("%s", err.Message)
+				}
+				if result == nil {
+					result = Null
+				}
+				r[in.A] = result
+			default:
+				return fmt.Errorf("not a function: %s", callee.Type())
+			}
+
+		case code.RReturn, code.RReturnNull:
+			var result object.Object = Null
+			if in.Op == code.RReturn {
+				result = r[in.A]
+			}
+			if vm.framesIndex == 1 {
+				// トップレベルの return はそこで実行を終える
+				vm.last = result
+				return nil
+			}
+			vm.framesIndex--
+			vm.regs[f.base-1] = result
+
+			f = &vm.frames[vm.framesIndex-1]
+			ins = f.cl.Fn.RegisterCode
+			r = vm.regs[f.base:]
+
+		case code.RClosure:
+			function, ok := vm.constants[in.B].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("not a function: %+v", vm.constants[in.B])
+			}
+			free := make([]object.Object, in.C)
+			copy(free, r[in.A+1:in.A+1+in.C])
+			r[in.A] = &object.Closure{Fn: function, Free: free}
+
+		case code.RMakeCell:
+			var value object.Object = Null
+			if in.A < f.cl.Fn.NumParameters {
+				value = r[in.A]
+			}
+			r[in.A] = &object.Cell{Value: value}
+		case code.RGetCell:
+			r[in.A] = r[in.B].(*object.Cell).Value
+		case code.RSetCell:
+			r[in.A].(*object.Cell).Value = r[in.B]
+		case code.RGetFreeCell:
+			r[in.A] = f.cl.Free[in.B].(*object.Cell).Value
+		case code.RSetFreeCell:
+			f.cl.Free[in.A].(*object.Cell).Value = r[in.B]
+
+		case code.RSetLast:
+			vm.last = r[in.A]
+
+		default:
+			return fmt.Errorf("unknown register opcode: %s", in.Op)
+		}
+	}
+
+	return nil
+}
+
+// registerToStackOpcode はレジスタ命令を、同じ演算をするスタック VM の命令に対応させる
+var registerToStackOpcode = map[code.RegisterOpcode]code.Opcode{
+	code.RAdd:         code.OpAdd,
+	code.RSub:         code.OpSub,
+	code.RMul:         code.OpMul,
+	code.RDiv:         code.OpDiv,
+	code.REqual:       code.OpEqual,
+	code.RNotEqual:    code.OpNotEqual,
+	code.RGreaterThan: code.OpGreaterThan,
+	code.RLessThan:    code.OpLessThan,
+}
+
+// binary は整数以外の二項演算を作業用 VM で計算する
+func (vm *RegisterVM) binary(op code.RegisterOpcode, left, right object.Object) (object.Object, error) {
+	vm.ops.sp = 0
+	vm.ops.push(left)
+	vm.ops.push(right)
+
+	var err error
+	switch op {
+	case code.RAdd, code.RSub, code.RMul, code.RDiv:
+		err = vm.ops.executeBinaryOperation(registerToStackOpcode[op])
+	default:
+		err = vm.ops.executeComparison(registerToStackOpcode[op])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vm.ops.pop(), nil
+}
+
+func (vm *RegisterVM) unary(execute func() error, operand object.Object) (object.Object, error) {
+	vm.ops.sp = 0
+	vm.ops.push(operand)
+	if err := execute(); err != nil {
+		return nil, err
+	}
+	return vm.ops.pop(), nil
+}
@@ -0,0 +1,774 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/compiler"
+	"github.com/kurarrr/monkey/logging"
+	"github.com/kurarrr/monkey/metrics"
+	"github.com/kurarrr/monkey/object"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+var True = &object.Boolean{Value: true}
+var False = &object.Boolean{Value: false}
+var Null = &object.Null{}
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // 常に次の空き領域を指す。スタックの先頭は stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	steps int64 // 実行した命令の数。Run の終わりに metrics に足す
+
+	poisoned *object.InternalError // Run 中に panic していれば、そのエラー
+
+	compat object.Compat
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	// 呼び出しのたびに Frame を割り当てないよう、全フレーム分をまとめて確保しておく
+	store := make([]Frame, MaxFrames)
+	frames := make([]*Frame, MaxFrames)
+	for i := range frames {
+		frames[i] = &store[i]
+	}
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// NewWithGlobalsStore は REPL のように実行をまたいでグローバル変数を引き継ぐときに使う
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// SetCompat は c の振る舞いで実行するようにする。Run の前に呼ぶ
+func (vm *VM) SetCompat(c object.Compat) {
+	vm.compat = c
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// LastPoppedStackElem は最後に OpPop で取り除かれた値を返す。式文の結果を得るのに使う
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+// Run はプログラムを実行する。実行中に Go の panic が起きれば *object.InternalError にして返し、
+// この VM はそれ以降 *object.PoisonedError を返して何も実行しない
+func (vm *VM) Run() (err error) {
+	if vm.poisoned != nil {
+		return &object.PoisonedError{Cause: vm.poisoned}
+	}
+	metrics.Evaluations.Inc()
+	metrics.Active.Inc()
+	defer func() {
+		if r := recover(); r != nil {
+			vm.poisoned = object.NewInternalError(r)
+			logging.Debug("vm: panic", "engine", "stack", "err", vm.poisoned, "stack", string(vm.poisoned.Stack))
+			err = vm.poisoned
+		}
+		metrics.Active.Dec()
+		metrics.Instructions.Add(vm.steps)
+		vm.steps = 0
+		if err != nil {
+			metrics.Errors.Inc()
+			logging.Debug("vm: run failed", "engine", "stack", "err", err)
+		}
+	}()
+	return vm.run()
+}
+
+// limitReached は VM の上限に達したことを記録する
+func limitReached(limit string, max int) {
+	logging.Debug("vm: limit reached", "limit", limit, "max", max)
+}
+
+func (vm *VM) run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+		vm.steps++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return err
+			}
+
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			err := vm.executeComparison(op)
+			if err != nil {
+				return err
+			}
+
+		case code.OpAddConstant, code.OpSubConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.executeBinaryConstantOperation(op, vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy, code.OpGreaterThanJumpNotTruthy,
+			code.OpLessThanJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			truthy, err := vm.executeComparisonForJump(op)
+			if err != nil {
+				return err
+			}
+			if !truthy {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpBang:
+			err := vm.executeBangOperator()
+			if err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			err := vm.executeMinusOperator()
+			if err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpTrue:
+			err := vm.push(True)
+			if err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			err := vm.push(False)
+			if err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			// ループの先頭で ip が1つ進むので、飛び先の1つ手前に合わせる
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(vm.globals[globalIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			definition := object.Builtins[builtinIndex]
+			err := vm.push(definition.Builtin)
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err := vm.push(array)
+			if err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// トップレベルの return はプログラムをそこで終える。値は LastPoppedStackElem で取れる
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			frame := vm.popFrame()
+			// 引数・局所変数に加えて呼び出された関数自身も取り除く
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure)
+			if err != nil {
+				return err
+			}
+
+		case code.OpMakeCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			vm.makeCell(vm.currentFrame(), localIndex)
+
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			err := vm.push(vm.stack[frame.basePointer+int(localIndex)].(*object.Cell).Value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)].(*object.Cell).Value = vm.pop()
+
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.push(vm.currentFrame().cl.Free[freeIndex].(*object.Cell).Value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.currentFrame().cl.Free[freeIndex].(*object.Cell).Value = vm.pop()
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		limitReached("stack", StackSize)
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case object.IsNumericPair(left, right):
+		result, err := object.Arith(operatorSymbol(op), left, right, vm.compat)
+		if err != nil {
+			return err
+		}
+		return vm.push(result)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case leftType != rightType:
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operatorSymbol(op), rightType)
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", leftType, operatorSymbol(op), rightType)
+	}
+}
+
+// executeBinaryConstantOperation は OpAddConstant / OpSubConstant を実行する。
+// 整数どうしで桁あふれしなければその場で計算し、それ以外は通常の二項演算に任せる
+func (vm *VM) executeBinaryConstantOperation(op code.Opcode, right object.Object) error {
+	left := vm.stack[vm.sp-1]
+
+	l, lok := left.(*object.Integer)
+	r, rok := right.(*object.Integer)
+	if lok && rok {
+		var result int64
+		var ok bool
+		if op == code.OpAddConstant {
+			result, ok = object.AddInt(l.Value, r.Value)
+		} else {
+			result, ok = object.SubInt(l.Value, r.Value)
+		}
+		if ok {
+			vm.stack[vm.sp-1] = &object.Integer{Value: result}
+			return nil
+		}
+	}
+
+	if err := vm.push(right); err != nil {
+		return err
+	}
+	if op == code.OpAddConstant {
+		return vm.executeBinaryOperation(code.OpAdd)
+	}
+	return vm.executeBinaryOperation(code.OpSub)
+}
+
+// executeComparisonForJump は比較 + OpJumpNotTruthy の比較部分を行い、結果の真偽を返す
+func (vm *VM) executeComparisonForJump(op code.Opcode) (bool, error) {
+	left := vm.stack[vm.sp-2]
+	right := vm.stack[vm.sp-1]
+
+	l, lok := left.(*object.Integer)
+	r, rok := right.(*object.Integer)
+	if lok && rok {
+		vm.sp -= 2
+		switch op {
+		case code.OpEqualJumpNotTruthy:
+			return l.Value == r.Value, nil
+		case code.OpNotEqualJumpNotTruthy:
+			return l.Value != r.Value, nil
+		case code.OpLessThanJumpNotTruthy:
+			return l.Value < r.Value, nil
+		default:
+			return l.Value > r.Value, nil
+		}
+	}
+
+	compareOp := code.OpGreaterThan
+	switch op {
+	case code.OpEqualJumpNotTruthy:
+		compareOp = code.OpEqual
+	case code.OpNotEqualJumpNotTruthy:
+		compareOp = code.OpNotEqual
+	case code.OpLessThanJumpNotTruthy:
+		compareOp = code.OpLessThan
+	}
+	if err := vm.executeComparison(compareOp); err != nil {
+		return false, err
+	}
+	return isTruthy(vm.pop()), nil
+}
+
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	if op != code.OpAdd {
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operatorSymbol(op), right.Type())
+	}
+
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	return vm.push(&object.String{Value: leftValue + rightValue})
+}
+
+func (vm *VM) executeComparison(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	switch {
+	case object.IsNumericPair(left, right):
+		result, err := object.CompareNumbers(operatorSymbol(op), left, right)
+		if err != nil {
+			return err
+		}
+		return vm.push(nativeBoolToBooleanObject(result))
+	}
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
+	default:
+		// 文字列と、object.Ordered を実装した埋め込む側の型はここで比べる
+		if c, ok := object.Compare(left, right); ok {
+			if op == code.OpLessThan {
+				return vm.push(nativeBoolToBooleanObject(c < 0))
+			}
+			return vm.push(nativeBoolToBooleanObject(c > 0))
+		}
+		if left.Type() != right.Type() {
+			return fmt.Errorf("type mismatch: %s %s %s", left.Type(), operatorSymbol(op), right.Type())
+		}
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operatorSymbol(op), right.Type())
+	}
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	negated, err := object.Negate(operand, vm.compat)
+	if err != nil {
+		return err
+	}
+	return vm.push(negated)
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		pair := object.HashPair{Key: key, Value: value}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = pair
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if i < 0 || i > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.Elements[i])
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	if vm.framesIndex >= MaxFrames {
+		limitReached("frames", MaxFrames)
+		return fmt.Errorf("stack overflow: more than %d nested calls", MaxFrames)
+	}
+	frame := vm.frames[vm.framesIndex]
+	frame.cl = cl
+	frame.ip = -1
+	frame.basePointer = vm.sp - numArgs
+	vm.framesIndex++
+
+	// 引数の上に局所変数の領域を確保する
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	if vm.sp >= StackSize {
+		limitReached("stack", StackSize)
+		return fmt.Errorf("stack overflow")
+	}
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		// 評価器と同じく、組み込み関数のエラーで実行を打ち切る
+		return fmt.Errorf("%s", err.Message)
+	}
+	if result != nil {
+		return vm.push(result)
+	}
+	return vm.push(Null)
+}
+
+// makeCell は frame の局所変数 localIndex をセルに入れる。引数なら渡された値を、
+// そうでなければ null を入れる。引数以外のスタックには前の呼び出しの値が残っている
+func (vm *VM) makeCell(frame *Frame, localIndex int) {
+	slot := frame.basePointer + localIndex
+	var value object.Object = Null
+	if localIndex < frame.cl.Fn.NumParameters {
+		value = vm.stack[slot]
+	}
+	vm.stack[slot] = &object.Cell{Value: value}
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+func operatorSymbol(op code.Opcode) string {
+	switch op {
+	case code.OpAdd:
+		return "+"
+	case code.OpSub:
+		return "-"
+	case code.OpMul:
+		return "*"
+	case code.OpDiv:
+		return "/"
+	case code.OpEqual:
+		return "=="
+	case code.OpNotEqual:
+		return "!="
+	case code.OpGreaterThan:
+		return ">"
+	case code.OpLessThan:
+		return "<"
+	default:
+		return fmt.Sprintf("op(%d)", op)
+	}
+}
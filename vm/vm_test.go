@@ -0,0 +1,613 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/kurarrr/monkey/ast"
+	"github.com/kurarrr/monkey/code"
+	"github.com/kurarrr/monkey/compiler"
+	"github.com/kurarrr/monkey/lexer"
+	"github.com/kurarrr/monkey/metrics"
+	"github.com/kurarrr/monkey/object"
+	"github.com/kurarrr/monkey/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5 + 2.25", "3.75"},
+		{"1 + 0.5", "1.5"},
+		{"-(0.5 * 4)", "-2.0"},
+		{"7 / 2.0", "3.5"},
+		{"1.5 < 2", "true"},
+		{"2.5 > 2", "true"},
+		{"2 == 2.0", "true"},
+		{"int(2.9) + float(1)", "3.0"},
+		{"2.5 - 1", "1.5"},
+		{"if (1.0 == 1) { 1.5 }", "1.5"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("%q: want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == false", false},
+		{"(1 < 2) == true", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!(if (false) { 5; })", true},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{`"a" < "b"`, true},
+		{`"b" > "a"`, true},
+		{`"b" < "a"`, false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (1 == 1) { 10 } else { 20 }", 10},
+		{"if (1 != 1) { 10 } else { 20 }", 20},
+		{`if ("a" == "a") { 10 } else { 20 }`, 10},
+		{"if (true != false) { 10 }", 10},
+		{"1 + if (true) { 5 } else { 2 }", 6},
+		{`if (if (true) { true } else { 1 == 2 }) { 10 } else { 20 }`, 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 10) { i = i + 1; }; i;", 10},
+		{"let i = 0; let sum = 0; while (i < 100000) { i = i + 1; sum = sum + i; }; sum;", 5000050000},
+		{"while (false) { 1 }", Null},
+		{"let f = fn() { let i = 0; while (true) { if (i == 3) { return i; } i = i + 1; } }; f();", 3},
+		{"let f = fn(n) { let acc = 1; while (n > 1) { acc = acc * n; n = n - 1; }; acc }; f(5);", 120},
+		// 左辺は右辺で代入される前の値
+		{"let f = fn() { let x = 1; x + if (true) { x = 10; 1 } else { 0 } }; f();", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		// let し直しの右辺は前の束縛を読む
+		{"let x = 5; let x = x + 1; x", 6},
+		{"let f = fn() { let x = 5; let x = x * 2; x }; f()", 10},
+		{"let x = 1; let f = fn() { let x = x + 1; x }; f() + x", 3},
+		{"let f = fn(n) { let n = n + 1; n }; f(1)", 2},
+		// 関数リテラルは自分の名前で再帰できる
+		{"let f = fn() { let g = fn(n) { if (n == 0) { 0 } else { g(n - 1) } }; g(3) }; f()", 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLetSelfReference(t *testing.T) {
+	inputs := []string{"let y = y", "let f = fn() { let y = y; y }"}
+	for _, input := range inputs {
+		if err := compiler.New().Compile(parse(input)); err == nil || err.Error() != "identifier not found: y" {
+			t.Errorf("%q: wrong error. got=%v", input, err)
+		}
+		if err := compiler.NewRegisterCompiler().Compile(parse(input)); err == nil || err.Error() != "identifier not found: y" {
+			t.Errorf("%q (register): wrong error. got=%v", input, err)
+		}
+	}
+}
+
+func TestStringArrayHash(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mon" + "key"`, "monkey"},
+		{"[1, 2 + 3][1]", 5},
+		{"[1, 2, 3][3]", Null},
+		{"{1: 2, 3: 4}[3]", 4},
+		{"{}[0]", Null},
+		{`let h = {"a": 1}; h["a"]`, 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn() { 5 + 10; }; f();", 15},
+		{"let f = fn() { return 99; 100; }; f();", 99},
+		{"let f = fn() { }; f();", Null},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2);", 3},
+		{"let g = 10; let f = fn(a) { a + g }; f(1) + f(2);", 23},
+		{"let newAdder = fn(a) { fn(b) { a + b } }; newAdder(2)(3);", 5},
+		{`
+		let fib = fn(x) {
+			if (x == 0) { return 0; }
+			if (x == 1) { return 1; }
+			fib(x - 1) + fib(x - 2);
+		};
+		fib(15);`, 610},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`first([])`, Null},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`first(sort(["b", "a"])) == "a"`, true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRegisteredBuiltins(t *testing.T) {
+	object.RegisterBuiltin("hostTriple", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 3}
+	})
+
+	tests := []vmTestCase{
+		{"hostTriple(5)", 15},
+		{"let f = fn(x) { hostTriple(x) + 1 }; f(2)", 7},
+		{`type([])`, "ARRAY"},
+	}
+
+	runVmTests(t, tests)
+
+	// 置き換えても添字は変わらないので、コンパイル済みのバイトコードからも新しい関数が呼ばれる
+	comp := compiler.New()
+	if err := comp.Compile(parse("hostTriple(2)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	object.RegisterBuiltin("hostTriple", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: -1}
+	})
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, "hostTriple(2)", -1, vm.LastPoppedStackElem())
+}
+
+func TestIntrospectionBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{"arity(fn(a, b) { a })", 2},
+		{"let f = fn() { 1 }; arity(f)", 0},
+		{`params(fn(x, y) { x + y })[1]`, "y"},
+		{"source(fn(x) { x * 2 })", "fn(x) {\n\tx * 2;\n}"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"true + 1", "type mismatch: BOOLEAN + INTEGER"},
+		{"if (true > 1) { 1 }", "type mismatch: BOOLEAN > INTEGER"},
+		{"true + false", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{"1 / 0", "division by zero: 1 / 0"},
+		{"1.5 / 0", "division by zero: 1.5 / 0"},
+		{"1(2)", "not a function: INTEGER"},
+		{"fn(a) { a }()", "wrong number of arguments: want=1, got=0"},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{"{[1]: 2}", "unusable as hash key: ARRAY"},
+		{"arity(1)", "argument to `arity` must be FUNCTION, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Errorf("expected VM error for %q but got none", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+
+		err = New(comp.Bytecode()).runTable()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q (table dispatch). want=%q, got=%v", tt.input, tt.expected, err)
+		}
+
+		_, err = runRegisterVM(program)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q (register VM). want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRunTable(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("let x = 1; x + 2")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	// 命令の数は run と同じに数える
+	switchVM, tableVM := New(bytecode), New(bytecode)
+	if err := switchVM.run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := tableVM.runTable(); err != nil {
+		t.Fatalf("vm error (table dispatch): %s", err)
+	}
+	if tableVM.steps == 0 || tableVM.steps != switchVM.steps {
+		t.Errorf("wrong steps. run=%d, runTable=%d", switchVM.steps, tableVM.steps)
+	}
+
+	// ハンドラのない命令は飛ばさずにエラーにする
+	bytecode = &compiler.Bytecode{Instructions: code.Instructions{255}}
+	err := New(bytecode).runTable()
+	if err == nil || err.Error() != "unknown opcode 255" {
+		t.Errorf("wrong error. want=%q, got=%v", "unknown opcode 255", err)
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	input := `
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+fib(20);
+`
+	for _, fused := range []bool{true, false} {
+		name := "plain"
+		if fused {
+			name = "fused"
+		}
+		b.Run(name, func(b *testing.B) {
+			comp := compiler.New()
+			comp.SetSuperinstructions(fused)
+			if err := comp.Compile(parse(input)); err != nil {
+				b.Fatalf("compiler error: %s", err)
+			}
+			bytecode := comp.Bytecode()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := New(bytecode).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDispatch は run の switch と runTable の表引きを比べる。どちらも命令を数えるが、
+// Run の metrics と recover の包みは runTable にないので、switch の側も run を直接呼んで揃える
+func BenchmarkDispatch(b *testing.B) {
+	input := `
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+let loop = fn(n) { let i = 0; let sum = 0; while (i < n) { i = i + 1; sum = sum + i * 2; }; sum };
+fib(20) + loop(100000);
+`
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	runs := []struct {
+		name string
+		run  func(vm *VM) error
+	}{
+		{"switch", (*VM).run},
+		{"table", (*VM).runTable},
+	}
+	for _, r := range runs {
+		b.Run(r.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := r.run(New(bytecode)); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+		testExpectedObject(t, tt.input, tt.expected, stackElem)
+
+		// 表引きの実行ループも同じ結果になること
+		tableVM := New(comp.Bytecode())
+		err = tableVM.runTable()
+		if err != nil {
+			t.Fatalf("vm error for %q (table dispatch): %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.input, tt.expected, tableVM.LastPoppedStackElem())
+
+		// 最適化したバイトコードも同じ結果になること
+		optimizedVM := New(compiler.Optimize(comp.Bytecode()))
+		err = optimizedVM.Run()
+		if err != nil {
+			t.Fatalf("vm error for %q (optimized): %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.input, tt.expected, optimizedVM.LastPoppedStackElem())
+
+		// レジスタ VM も同じ結果になること
+		last, err := runRegisterVM(program)
+		if err != nil {
+			t.Fatalf("vm error for %q (register VM): %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.input, tt.expected, last)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	program := parse("let f = fn(x) { x * 2 }; f(1) + f(2);")
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	// 同じプログラムなら毎回同じ数の命令を数える
+	counts := []int64{}
+	for i := 0; i < 2; i++ {
+		before := metrics.Instructions.Value()
+		if err := New(bytecode).Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		counts = append(counts, metrics.Instructions.Value()-before)
+	}
+	if counts[0] == 0 || counts[0] != counts[1] {
+		t.Errorf("wrong instruction counts: %v", counts)
+	}
+
+	errors := metrics.Errors.Value()
+	if _, err := runRegisterVM(parse("1 + true")); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if got := metrics.Errors.Value() - errors; got != 1 {
+		t.Errorf("wrong errors. want=1, got=%d", got)
+	}
+	if active := metrics.Active.Value(); active != 0 {
+		t.Errorf("%d interpreters still active", active)
+	}
+}
+
+func runRegisterVM(program *ast.Program) (object.Object, error) {
+	comp := compiler.NewRegisterCompiler()
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	vm := NewRegisterVM(comp.Program())
+	if err := vm.Run(); err != nil {
+		return nil, err
+	}
+	return vm.LastEvaluated(), nil
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("%q: want=%d, got=%s (%T)", input, expected, actual.Inspect(), actual)
+		}
+	case bool:
+		boolean, ok := actual.(*object.Boolean)
+		if !ok || boolean.Value != expected {
+			t.Errorf("%q: want=%t, got=%s (%T)", input, expected, actual.Inspect(), actual)
+		}
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("%q: want=%q, got=%s (%T)", input, expected, actual.Inspect(), actual)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("%q: want=%v, got=%s (%T)", input, expected, actual.Inspect(), actual)
+			return
+		}
+		for i, e := range expected {
+			testExpectedObject(t, input, e, array.Elements[i])
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%q: want=null, got=%s (%T)", input, actual.Inspect(), actual)
+		}
+	}
+}
+
+// BenchmarkEngines はスタック VM とレジスタ VM を算術の多いスクリプトで比べる
+func BenchmarkEngines(b *testing.B) {
+	input := `
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+let loop = fn(n) { let i = 0; let sum = 0; while (i < n) { i = i + 1; sum = sum + i * 2; }; sum };
+fib(20) + loop(100000);
+`
+	program := parse(input)
+
+	b.Run("stack", func(b *testing.B) {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := New(bytecode).Run(); err != nil {
+				b.Fatalf("vm error: %s", err)
+			}
+		}
+	})
+	b.Run("register", func(b *testing.B) {
+		comp := compiler.NewRegisterCompiler()
+		if err := comp.Compile(program); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		rp := comp.Program()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := NewRegisterVM(rp).Run(); err != nil {
+				b.Fatalf("vm error: %s", err)
+			}
+		}
+	})
+}
+
+// BenchmarkCalls は関数呼び出しごとの割り当てを測る
+func BenchmarkCalls(b *testing.B) {
+	benchmarks := []struct {
+		name  string
+		input string
+	}{
+		{"recursion", "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(500);"},
+		{"loop", "let id = fn(x) { x }; let i = 0; while (i < 1000) { id(i); i = i + 1; };"},
+	}
+
+	for _, bm := range benchmarks {
+		comp := compiler.New()
+		if err := comp.Compile(parse(bm.input)); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := New(bytecode).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func TestPanicRecovered(t *testing.T) {
+	object.RegisterBuiltin("vmPanic", func(args ...object.Object) object.Object {
+		panic("host builtin failed")
+	})
+	program := parse("let x = 1; vmPanic(x)")
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	rcomp := compiler.NewRegisterCompiler()
+	if err := rcomp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	active := metrics.Active.Value()
+	machines := map[string]interface{ Run() error }{
+		"stack":    New(comp.Bytecode()),
+		"register": NewRegisterVM(rcomp.Program()),
+	}
+	for name, machine := range machines {
+		err := machine.Run()
+		ierr, ok := err.(*object.InternalError)
+		if !ok {
+			t.Errorf("%s: expected *object.InternalError. got=%T (%v)", name, err, err)
+			continue
+		}
+		if ierr.Error() != "internal error: host builtin failed" {
+			t.Errorf("%s: wrong message: %q", name, ierr.Error())
+		}
+		if perr, ok := machine.Run().(*object.PoisonedError); !ok || perr.Cause != ierr {
+			t.Errorf("%s: expected *object.PoisonedError on the second Run", name)
+		}
+	}
+	if got := metrics.Active.Value(); got != active {
+		t.Errorf("active interpreters changed from %d to %d", active, got)
+	}
+}